@@ -22,10 +22,12 @@ import (
 	"knative.dev/pkg/injection/sharedmain"
 
 	"knative.dev/cache-imagewarm/pkg/reconciler"
+	"knative.dev/cache-imagewarm/pkg/reconciler/bootstrap"
 )
 
 func main() {
 	sharedmain.Main("controller",
 		reconciler.NewController,
+		bootstrap.NewController,
 	)
 }
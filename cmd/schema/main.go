@@ -28,6 +28,8 @@ import (
 // schema is a tool to dump the schema for Eventing resources.
 func main() {
 	registry.Register(&v1alpha1.ImageWarm{})
+	registry.Register(&v1alpha1.NodeImageInventory{})
+	registry.Register(&v1alpha1.NodeWarmPlan{})
 
 	if err := commands.New("knative.dev/cache-imagewarm").Execute(); err != nil {
 		log.Fatal("Error during command execution: ", err)
@@ -27,5 +27,6 @@ import (
 func main() {
 	sharedmain.Main("warmer",
 		warmer.NewWarmDaemon,
+		warmer.NewPlanWarmDaemon,
 	)
 }
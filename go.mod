@@ -5,7 +5,11 @@ go 1.14
 require (
 	github.com/Microsoft/go-winio v0.4.16 // indirect
 	github.com/containerd/containerd v1.4.4 // indirect
+	github.com/docker/distribution v2.7.1+incompatible
 	github.com/docker/docker v20.10.5+incompatible
+	github.com/google/go-cmp v0.5.5
+	github.com/google/go-containerregistry v0.4.1-0.20210128200529-19c2b639fab1
+	go.opencensus.io v0.23.0
 	go.uber.org/zap v1.16.0
 	k8s.io/api v0.19.7
 	k8s.io/apimachinery v0.19.7
@@ -18,6 +22,7 @@ require (
 	knative.dev/hack/schema v0.0.0-20210325223819-b6ab329907d3
 	knative.dev/pkg v0.0.0-20210428023153-5a308fa62139
 	knative.dev/serving v0.22.0
+	sigs.k8s.io/yaml v1.2.0
 )
 
 replace (
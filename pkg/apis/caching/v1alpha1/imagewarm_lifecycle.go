@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"knative.dev/pkg/apis"
 	duckv1 "knative.dev/pkg/apis/duck/v1"
@@ -72,3 +73,16 @@ func (is *ImageWarmStatus) MarkReadyTrue() {
 func (is *ImageWarmStatus) MarkReadyFalse(reason, message string) {
 	condSet.Manage(is).MarkFalse(ImageWarmConditionReady, reason, message)
 }
+
+// SetProgress summarizes the progress of the layers being pulled.
+func (is *ImageWarmStatus) SetProgress(layers []LayerProgress, now metav1.Time) {
+	progress := &PullProgress{Layers: layers, UpdateTime: now}
+	for _, layer := range layers {
+		progress.BytesDownloaded += layer.BytesDownloaded
+		progress.BytesTotal += layer.BytesTotal
+	}
+	if progress.BytesTotal > 0 {
+		progress.Percent = int32(progress.BytesDownloaded * 100 / progress.BytesTotal)
+	}
+	is.Progress = progress
+}
@@ -62,12 +62,111 @@ type ImageWarmSpec struct {
 	// information used by the Pods which will run this container.
 	// +optional
 	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// Archive loads the image from an archive instead of pulling it from a
+	// registry, for clusters that cannot reach one. The loaded image is tagged
+	// as Image.
+	// +optional
+	Archive *ImageArchive `json:"archive,omitempty"`
+}
+
+// ArchiveFormat is the format of an image archive.
+type ArchiveFormat string
+
+const (
+	// ArchiveFormatDocker is a tarball produced by `docker save`.
+	ArchiveFormatDocker ArchiveFormat = "docker"
+	// ArchiveFormatOCI is a tarball of an OCI image layout.
+	ArchiveFormatOCI ArchiveFormat = "oci"
+)
+
+// ImageArchive locates an image archive. Exactly one of HostPath,
+// PersistentVolumeClaim and URL must be set.
+type ImageArchive struct {
+	// Format is the format of the archive, "docker" or "oci".
+	Format ArchiveFormat `json:"format"`
+
+	// Digest is the expected digest of the loaded image, either its manifest
+	// digest or its image ID, e.g. "sha256:...".
+	Digest string `json:"digest"`
+
+	// HostPath is the path of the archive on the node, under the archive
+	// directory the warmer mounts.
+	// +optional
+	HostPath string `json:"hostPath,omitempty"`
+
+	// PersistentVolumeClaim is a claim, in the ImageWarm's namespace, bound
+	// to a hostPath or local volume on the node holding the archive, under
+	// the archive directory the warmer mounts.
+	// +optional
+	PersistentVolumeClaim *ArchiveVolumeSource `json:"persistentVolumeClaim,omitempty"`
+
+	// URL is an HTTP(S) URL the archive is served from inside the cluster,
+	// on one of the hosts the warmer allows.
+	// +optional
+	URL string `json:"url,omitempty"`
+}
+
+// ArchiveVolumeSource locates an archive on a PersistentVolumeClaim.
+type ArchiveVolumeSource struct {
+	// ClaimName is the name of the PersistentVolumeClaim.
+	ClaimName string `json:"claimName"`
+
+	// Path is the path of the archive within the volume.
+	Path string `json:"path"`
 }
 
 // ImageWarmStatus communicates the observed state of the ImageWarm (from the reconciler).
 // ImageStatus communicates the observed state of the Image (from the controller).
 type ImageWarmStatus struct {
 	duckv1.Status `json:",inline"`
+
+	// Endpoint is the registry mirror endpoint, or the upstream registry,
+	// that served the latest pull of the image.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// PeerEndpoint is the address of the node-local registry that serves the
+	// image to the warmers on other nodes.
+	// +optional
+	PeerEndpoint string `json:"peerEndpoint,omitempty"`
+
+	// Progress summarizes the progress of the pull of the image, while it is
+	// pulled. It is refreshed at a throttled rate.
+	// +optional
+	Progress *PullProgress `json:"progress,omitempty"`
+}
+
+// PullProgress summarizes the progress of the pull of an image.
+type PullProgress struct {
+	// Percent is the percentage of the bytes of the layers downloaded, out
+	// of the layers whose size is known.
+	Percent int32 `json:"percent"`
+
+	// BytesDownloaded is the number of bytes of the layers downloaded.
+	BytesDownloaded int64 `json:"bytesDownloaded"`
+
+	// BytesTotal is the size of the layers whose size is known.
+	BytesTotal int64 `json:"bytesTotal"`
+
+	// Layers is the progress of every layer of the image.
+	// +optional
+	Layers []LayerProgress `json:"layers,omitempty"`
+
+	// UpdateTime is when the progress was last refreshed.
+	UpdateTime metav1.Time `json:"updateTime"`
+}
+
+// LayerProgress is the progress of the download of a layer.
+type LayerProgress struct {
+	// ID is the short ID of the layer reported by the runtime.
+	ID string `json:"id"`
+
+	// BytesDownloaded is the number of bytes of the layer downloaded.
+	BytesDownloaded int64 `json:"bytesDownloaded"`
+
+	// BytesTotal is the size of the layer, 0 until it is known.
+	BytesTotal int64 `json:"bytesTotal"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -18,14 +18,75 @@ package v1alpha1
 
 import (
 	"context"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
 	"knative.dev/pkg/apis"
 )
 
+var digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
 func (rt *ImageWarm) Validate(ctx context.Context) *apis.FieldError {
 	return rt.Spec.Validate(ctx).ViaField("spec")
 }
 
 func (rs *ImageWarmSpec) Validate(ctx context.Context) (errs *apis.FieldError) {
-	// TODO zhaojizhuang
-	return nil
+	if rs.Image == "" {
+		errs = errs.Also(apis.ErrMissingField("image"))
+	}
+	if rs.Archive != nil {
+		errs = errs.Also(rs.Archive.Validate(ctx).ViaField("archive"))
+	}
+	return errs
+}
+
+func (ia *ImageArchive) Validate(ctx context.Context) (errs *apis.FieldError) {
+	switch ia.Format {
+	case ArchiveFormatDocker, ArchiveFormatOCI:
+	case "":
+		errs = errs.Also(apis.ErrMissingField("format"))
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(ia.Format, "format"))
+	}
+
+	if ia.Digest == "" {
+		errs = errs.Also(apis.ErrMissingField("digest"))
+	} else if !digestRegexp.MatchString(ia.Digest) {
+		errs = errs.Also(apis.ErrInvalidValue(ia.Digest, "digest"))
+	}
+
+	var set []string
+	if ia.HostPath != "" {
+		set = append(set, "hostPath")
+		if !path.IsAbs(ia.HostPath) || path.Clean(ia.HostPath) != ia.HostPath {
+			errs = errs.Also(apis.ErrInvalidValue(ia.HostPath, "hostPath"))
+		}
+	}
+	if ia.PersistentVolumeClaim != nil {
+		set = append(set, "persistentVolumeClaim")
+		if ia.PersistentVolumeClaim.ClaimName == "" {
+			errs = errs.Also(apis.ErrMissingField("persistentVolumeClaim.claimName"))
+		}
+		if p := ia.PersistentVolumeClaim.Path; p == "" {
+			errs = errs.Also(apis.ErrMissingField("persistentVolumeClaim.path"))
+		} else if path.IsAbs(p) || path.Clean(p) != p || strings.HasPrefix(p, "../") || p == ".." {
+			errs = errs.Also(apis.ErrInvalidValue(p, "persistentVolumeClaim.path"))
+		}
+	}
+	if ia.URL != "" {
+		set = append(set, "url")
+		if u, err := url.Parse(ia.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = errs.Also(apis.ErrInvalidValue(ia.URL, "url"))
+		}
+	}
+	switch len(set) {
+	case 0:
+		errs = errs.Also(apis.ErrMissingOneOf("hostPath", "persistentVolumeClaim", "url"))
+	case 1:
+	default:
+		errs = errs.Also(apis.ErrMultipleOneOf(set...))
+	}
+	return errs
 }
@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"github.com/docker/distribution/reference"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GetGroupVersionKind implements kmeta.OwnerRefable
+func (n *NodeImageInventory) GetGroupVersionKind() schema.GroupVersionKind {
+	return SchemeGroupVersion.WithKind("NodeImageInventory")
+}
+
+// HasImage reports whether the node holds imageRef.
+func (ns *NodeImageInventoryStatus) HasImage(imageRef string) bool {
+	for _, image := range ns.Images {
+		if image.Matches(imageRef) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether the image is the one referenced by imageRef. Digest
+// references match by digest in any repository, since the image may have been
+// pulled through a mirror; tag references match the normalized tag.
+func (ii *InventoryImage) Matches(imageRef string) bool {
+	named, err := reference.ParseNormalizedNamed(imageRef)
+	if err != nil {
+		return false
+	}
+
+	if digested, ok := named.(reference.Digested); ok {
+		for _, repoDigest := range ii.RepoDigests {
+			ref, err := reference.ParseNormalizedNamed(repoDigest)
+			if err != nil {
+				continue
+			}
+			if d, ok := ref.(reference.Digested); ok && d.Digest() == digested.Digest() {
+				return true
+			}
+		}
+		return false
+	}
+
+	want := reference.TagNameOnly(named).String()
+	for _, repoTag := range ii.RepoTags {
+		ref, err := reference.ParseNormalizedNamed(repoTag)
+		if err == nil && ref.String() == want {
+			return true
+		}
+	}
+	return false
+}
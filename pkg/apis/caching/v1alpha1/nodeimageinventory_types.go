@@ -0,0 +1,99 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/kmeta"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NodeImageInventory lists the images held by the container runtime of a
+// node. It is named after the node, and published by the warmer running there.
+type NodeImageInventory struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec holds the node the inventory describes.
+	// +optional
+	Spec NodeImageInventorySpec `json:"spec,omitempty"`
+
+	// Status holds the images last observed on the node.
+	// +optional
+	Status NodeImageInventoryStatus `json:"status,omitempty"`
+}
+
+var _ kmeta.OwnerRefable = (*NodeImageInventory)(nil)
+
+// NodeImageInventorySpec holds the node the inventory describes.
+type NodeImageInventorySpec struct {
+	// NodeName is the name of the node the inventory describes.
+	NodeName string `json:"nodeName"`
+}
+
+// NodeImageInventoryStatus holds the images last observed on the node.
+type NodeImageInventoryStatus struct {
+	duckv1.Status `json:",inline"`
+
+	// Images are the images held by the node's container runtime.
+	// +optional
+	Images []InventoryImage `json:"images,omitempty"`
+}
+
+// InventoryImage is an image held by the node's container runtime.
+type InventoryImage struct {
+	// ID is the image ID in the runtime.
+	ID string `json:"id"`
+
+	// RepoTags are the tagged references of the image.
+	// +optional
+	RepoTags []string `json:"repoTags,omitempty"`
+
+	// RepoDigests are the digest references of the image.
+	// +optional
+	RepoDigests []string `json:"repoDigests,omitempty"`
+
+	// SizeBytes is the disk space taken by the image.
+	// +optional
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
+
+	// LastUsedTime is the last time the warmer saw a running container using
+	// the image.
+	// +optional
+	LastUsedTime *metav1.Time `json:"lastUsedTime,omitempty"`
+
+	// ImageWarms are the namespace/name keys of the ImageWarms on the node
+	// owning the image, and of the Images of the NodeWarmPlan entries of the
+	// node owning it. It is empty for images the warmer did not pull.
+	// +optional
+	ImageWarms []string `json:"imageWarms,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NodeImageInventoryList is a list of NodeImageInventory resources
+type NodeImageInventoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []NodeImageInventory `json:"items"`
+}
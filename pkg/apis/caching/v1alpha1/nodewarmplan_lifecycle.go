@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+const (
+	// NodeWarmPlanConditionReady becomes true when the node holds every image
+	// of the plan.
+	NodeWarmPlanConditionReady = apis.ConditionReady
+)
+
+var planCondSet = apis.NewLivingConditionSet()
+
+// GetGroupVersionKind implements kmeta.OwnerRefable
+func (p *NodeWarmPlan) GetGroupVersionKind() schema.GroupVersionKind {
+	return SchemeGroupVersion.WithKind("NodeWarmPlan")
+}
+
+// GetConditionSet retrieves the condition set for this resource. Implements the KRShaped interface.
+func (p *NodeWarmPlan) GetConditionSet() apis.ConditionSet {
+	return planCondSet
+}
+
+// GetStatus retrieves the status of the NodeWarmPlan. Implements the KRShaped interface.
+func (p *NodeWarmPlan) GetStatus() *duckv1.Status {
+	return &p.Status.Status
+}
+
+// InitializeConditions sets the initial values to the conditions.
+func (ps *NodeWarmPlanStatus) InitializeConditions() {
+	planCondSet.Manage(ps).InitializeConditions()
+}
+
+// Entry returns the spec entry of the image warmed for owner, or nil.
+func (ps *NodeWarmPlanSpec) Entry(owner string) *PlannedImage {
+	for i := range ps.Images {
+		if ps.Images[i].Owner == owner {
+			return &ps.Images[i]
+		}
+	}
+	return nil
+}
+
+// Entry returns the status entry of the image warmed for owner, or nil.
+func (ps *NodeWarmPlanStatus) Entry(owner string) *PlannedImageStatus {
+	for i := range ps.Images {
+		if ps.Images[i].Owner == owner {
+			return &ps.Images[i]
+		}
+	}
+	return nil
+}
+
+// PropagateImagesStatus marks the plan ready when every image is ready, and
+// not ready when any of them failed.
+func (ps *NodeWarmPlanStatus) PropagateImagesStatus() {
+	for _, image := range ps.Images {
+		if image.Ready == corev1.ConditionFalse {
+			planCondSet.Manage(ps).MarkFalse(NodeWarmPlanConditionReady, image.Reason,
+				"Image %s of %s: %s", image.Image, image.Owner, image.Message)
+			return
+		}
+	}
+	for _, image := range ps.Images {
+		if image.Ready != corev1.ConditionTrue {
+			planCondSet.Manage(ps).MarkUnknown(NodeWarmPlanConditionReady, "Pulling",
+				"Image %s of %s is being pulled", image.Image, image.Owner)
+			return
+		}
+	}
+	planCondSet.Manage(ps).MarkTrue(NodeWarmPlanConditionReady)
+}
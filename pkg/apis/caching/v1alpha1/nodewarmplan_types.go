@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/kmeta"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +genreconciler
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NodeWarmPlan lists the images the warmer of a node keeps on it, in place of
+// one ImageWarm per Image and node. It is named after the node, maintained by
+// the controller, and its status by the warmer running there.
+type NodeWarmPlan struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec holds the images to keep on the node.
+	// +optional
+	Spec NodeWarmPlanSpec `json:"spec,omitempty"`
+
+	// Status holds the state of every image on the node.
+	// +optional
+	Status NodeWarmPlanStatus `json:"status,omitempty"`
+}
+
+var _ kmeta.OwnerRefable = (*NodeWarmPlan)(nil)
+
+// NodeWarmPlanSpec holds the images to keep on the node.
+type NodeWarmPlanSpec struct {
+	// NodeName is the name of the node the plan is for.
+	NodeName string `json:"nodeName"`
+
+	// Images are the images to keep on the node, one entry per Image.
+	// +optional
+	Images []PlannedImage `json:"images,omitempty"`
+}
+
+// PlannedImage is an image to keep on the node for an Image.
+type PlannedImage struct {
+	// Owner is the namespace/name key of the Image the image is warmed for.
+	Owner string `json:"owner"`
+
+	// Image is the name of the container image url to cache on the node.
+	Image string `json:"image"`
+
+	// ImagePullSecrets contains the names of the Kubernetes Secrets, in the
+	// namespace of the Owner, containing login information to pull the image.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// Archive loads the image from an archive instead of pulling it from a
+	// registry. A persistentVolumeClaim is looked up in the namespace of the Owner.
+	// +optional
+	Archive *ImageArchive `json:"archive,omitempty"`
+}
+
+// NodeWarmPlanStatus holds the state of every image on the node.
+type NodeWarmPlanStatus struct {
+	duckv1.Status `json:",inline"`
+
+	// Images holds the state of the images of the spec, in the same order.
+	// +optional
+	Images []PlannedImageStatus `json:"images,omitempty"`
+}
+
+// PlannedImageStatus is the state of an image on the node.
+type PlannedImageStatus struct {
+	// Owner is the namespace/name key of the Image the image is warmed for.
+	Owner string `json:"owner"`
+
+	// Image is the name of the container image url.
+	Image string `json:"image"`
+
+	// Ready is True when the node holds the image, False when the latest
+	// pull failed, and Unknown while the image is pulled.
+	Ready corev1.ConditionStatus `json:"ready"`
+
+	// Reason classifies the failure of the latest pull, when Ready is False.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message describes the failure of the latest pull, when Ready is False.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Endpoint is the registry mirror endpoint, or the upstream registry,
+	// that served the latest pull of the image.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// PeerEndpoint is the address of the node-local registry that serves the
+	// image to the warmers on other nodes.
+	// +optional
+	PeerEndpoint string `json:"peerEndpoint,omitempty"`
+
+	// Progress summarizes the progress of the pull of the image, while it is pulled.
+	// +optional
+	Progress *PullProgress `json:"progress,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NodeWarmPlanList is a list of NodeWarmPlan resources
+type NodeWarmPlanList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []NodeWarmPlan `json:"items"`
+}
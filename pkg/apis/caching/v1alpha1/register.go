@@ -47,6 +47,10 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&ImageWarm{},
 		&ImageWarmList{},
+		&NodeImageInventory{},
+		&NodeImageInventoryList{},
+		&NodeWarmPlan{},
+		&NodeWarmPlanList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -25,6 +25,43 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArchiveVolumeSource) DeepCopyInto(out *ArchiveVolumeSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArchiveVolumeSource.
+func (in *ArchiveVolumeSource) DeepCopy() *ArchiveVolumeSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ArchiveVolumeSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageArchive) DeepCopyInto(out *ImageArchive) {
+	*out = *in
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(ArchiveVolumeSource)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageArchive.
+func (in *ImageArchive) DeepCopy() *ImageArchive {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageArchive)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageWarm) DeepCopyInto(out *ImageWarm) {
 	*out = *in
@@ -94,6 +131,11 @@ func (in *ImageWarmSpec) DeepCopyInto(out *ImageWarmSpec) {
 		*out = make([]v1.LocalObjectReference, len(*in))
 		copy(*out, *in)
 	}
+	if in.Archive != nil {
+		in, out := &in.Archive, &out.Archive
+		*out = new(ImageArchive)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -111,6 +153,11 @@ func (in *ImageWarmSpec) DeepCopy() *ImageWarmSpec {
 func (in *ImageWarmStatus) DeepCopyInto(out *ImageWarmStatus) {
 	*out = *in
 	in.Status.DeepCopyInto(&out.Status)
+	if in.Progress != nil {
+		in, out := &in.Progress, &out.Progress
+		*out = new(PullProgress)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -123,3 +170,332 @@ func (in *ImageWarmStatus) DeepCopy() *ImageWarmStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InventoryImage) DeepCopyInto(out *InventoryImage) {
+	*out = *in
+	if in.RepoTags != nil {
+		in, out := &in.RepoTags, &out.RepoTags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RepoDigests != nil {
+		in, out := &in.RepoDigests, &out.RepoDigests
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastUsedTime != nil {
+		in, out := &in.LastUsedTime, &out.LastUsedTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ImageWarms != nil {
+		in, out := &in.ImageWarms, &out.ImageWarms
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InventoryImage.
+func (in *InventoryImage) DeepCopy() *InventoryImage {
+	if in == nil {
+		return nil
+	}
+	out := new(InventoryImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LayerProgress) DeepCopyInto(out *LayerProgress) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LayerProgress.
+func (in *LayerProgress) DeepCopy() *LayerProgress {
+	if in == nil {
+		return nil
+	}
+	out := new(LayerProgress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeImageInventory) DeepCopyInto(out *NodeImageInventory) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeImageInventory.
+func (in *NodeImageInventory) DeepCopy() *NodeImageInventory {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeImageInventory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NodeImageInventory) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeImageInventoryList) DeepCopyInto(out *NodeImageInventoryList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NodeImageInventory, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeImageInventoryList.
+func (in *NodeImageInventoryList) DeepCopy() *NodeImageInventoryList {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeImageInventoryList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NodeImageInventoryList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeImageInventorySpec) DeepCopyInto(out *NodeImageInventorySpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeImageInventorySpec.
+func (in *NodeImageInventorySpec) DeepCopy() *NodeImageInventorySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeImageInventorySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeImageInventoryStatus) DeepCopyInto(out *NodeImageInventoryStatus) {
+	*out = *in
+	in.Status.DeepCopyInto(&out.Status)
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]InventoryImage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeImageInventoryStatus.
+func (in *NodeImageInventoryStatus) DeepCopy() *NodeImageInventoryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeImageInventoryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeWarmPlan) DeepCopyInto(out *NodeWarmPlan) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeWarmPlan.
+func (in *NodeWarmPlan) DeepCopy() *NodeWarmPlan {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeWarmPlan)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NodeWarmPlan) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeWarmPlanList) DeepCopyInto(out *NodeWarmPlanList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NodeWarmPlan, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeWarmPlanList.
+func (in *NodeWarmPlanList) DeepCopy() *NodeWarmPlanList {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeWarmPlanList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NodeWarmPlanList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeWarmPlanSpec) DeepCopyInto(out *NodeWarmPlanSpec) {
+	*out = *in
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]PlannedImage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeWarmPlanSpec.
+func (in *NodeWarmPlanSpec) DeepCopy() *NodeWarmPlanSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeWarmPlanSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeWarmPlanStatus) DeepCopyInto(out *NodeWarmPlanStatus) {
+	*out = *in
+	in.Status.DeepCopyInto(&out.Status)
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]PlannedImageStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeWarmPlanStatus.
+func (in *NodeWarmPlanStatus) DeepCopy() *NodeWarmPlanStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeWarmPlanStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlannedImage) DeepCopyInto(out *PlannedImage) {
+	*out = *in
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]v1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Archive != nil {
+		in, out := &in.Archive, &out.Archive
+		*out = new(ImageArchive)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlannedImage.
+func (in *PlannedImage) DeepCopy() *PlannedImage {
+	if in == nil {
+		return nil
+	}
+	out := new(PlannedImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlannedImageStatus) DeepCopyInto(out *PlannedImageStatus) {
+	*out = *in
+	if in.Progress != nil {
+		in, out := &in.Progress, &out.Progress
+		*out = new(PullProgress)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlannedImageStatus.
+func (in *PlannedImageStatus) DeepCopy() *PlannedImageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PlannedImageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PullProgress) DeepCopyInto(out *PullProgress) {
+	*out = *in
+	if in.Layers != nil {
+		in, out := &in.Layers, &out.Layers
+		*out = make([]LayerProgress, len(*in))
+		copy(*out, *in)
+	}
+	in.UpdateTime.DeepCopyInto(&out.UpdateTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PullProgress.
+func (in *PullProgress) DeepCopy() *PullProgress {
+	if in == nil {
+		return nil
+	}
+	out := new(PullProgress)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -27,6 +27,8 @@ import (
 type CachingV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	ImageWarmsGetter
+	NodeImageInventoriesGetter
+	NodeWarmPlansGetter
 }
 
 // CachingV1alpha1Client is used to interact with features provided by the caching.knative.dev group.
@@ -38,6 +40,14 @@ func (c *CachingV1alpha1Client) ImageWarms(namespace string) ImageWarmInterface
 	return newImageWarms(c, namespace)
 }
 
+func (c *CachingV1alpha1Client) NodeImageInventories() NodeImageInventoryInterface {
+	return newNodeImageInventories(c)
+}
+
+func (c *CachingV1alpha1Client) NodeWarmPlans() NodeWarmPlanInterface {
+	return newNodeWarmPlans(c)
+}
+
 // NewForConfig creates a new CachingV1alpha1Client for the given config.
 func NewForConfig(c *rest.Config) (*CachingV1alpha1Client, error) {
 	config := *c
@@ -32,6 +32,14 @@ func (c *FakeCachingV1alpha1) ImageWarms(namespace string) v1alpha1.ImageWarmInt
 	return &FakeImageWarms{c, namespace}
 }
 
+func (c *FakeCachingV1alpha1) NodeImageInventories() v1alpha1.NodeImageInventoryInterface {
+	return &FakeNodeImageInventories{c}
+}
+
+func (c *FakeCachingV1alpha1) NodeWarmPlans() v1alpha1.NodeWarmPlanInterface {
+	return &FakeNodeWarmPlans{c}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeCachingV1alpha1) RESTClient() rest.Interface {
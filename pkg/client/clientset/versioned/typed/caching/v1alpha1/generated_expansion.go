@@ -19,3 +19,7 @@ limitations under the License.
 package v1alpha1
 
 type ImageWarmExpansion interface{}
+
+type NodeImageInventoryExpansion interface{}
+
+type NodeWarmPlanExpansion interface{}
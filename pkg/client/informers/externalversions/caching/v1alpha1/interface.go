@@ -26,6 +26,10 @@ import (
 type Interface interface {
 	// ImageWarms returns a ImageWarmInformer.
 	ImageWarms() ImageWarmInformer
+	// NodeImageInventories returns a NodeImageInventoryInformer.
+	NodeImageInventories() NodeImageInventoryInformer
+	// NodeWarmPlans returns a NodeWarmPlanInformer.
+	NodeWarmPlans() NodeWarmPlanInformer
 }
 
 type version struct {
@@ -43,3 +47,13 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 func (v *version) ImageWarms() ImageWarmInformer {
 	return &imageWarmInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// NodeImageInventories returns a NodeImageInventoryInformer.
+func (v *version) NodeImageInventories() NodeImageInventoryInformer {
+	return &nodeImageInventoryInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
+// NodeWarmPlans returns a NodeWarmPlanInformer.
+func (v *version) NodeWarmPlans() NodeWarmPlanInformer {
+	return &nodeWarmPlanInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
@@ -55,6 +55,10 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 	// Group=caching.knative.dev, Version=v1alpha1
 	case v1alpha1.SchemeGroupVersion.WithResource("imagewarms"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Caching().V1alpha1().ImageWarms().Informer()}, nil
+	case v1alpha1.SchemeGroupVersion.WithResource("nodeimageinventories"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Caching().V1alpha1().NodeImageInventories().Informer()}, nil
+	case v1alpha1.SchemeGroupVersion.WithResource("nodewarmplans"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Caching().V1alpha1().NodeWarmPlans().Informer()}, nil
 
 	}
 
@@ -25,3 +25,11 @@ type ImageWarmListerExpansion interface{}
 // ImageWarmNamespaceListerExpansion allows custom methods to be added to
 // ImageWarmNamespaceLister.
 type ImageWarmNamespaceListerExpansion interface{}
+
+// NodeImageInventoryListerExpansion allows custom methods to be added to
+// NodeImageInventoryLister.
+type NodeImageInventoryListerExpansion interface{}
+
+// NodeWarmPlanListerExpansion allows custom methods to be added to
+// NodeWarmPlanLister.
+type NodeWarmPlanListerExpansion interface{}
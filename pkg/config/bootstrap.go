@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// BootstrapConfigName is the name of the ConfigMap holding the gating of
+	// new nodes on their critical images.
+	BootstrapConfigName = "config-node-bootstrap"
+
+	startupTaintKey      = "startup-taint"
+	applyStartupTaintKey = "apply-startup-taint"
+	criticalImagesKey    = "critical-images"
+	startupTimeoutKey    = "startup-timeout"
+
+	// DefaultCriticalImages selects the critical Images by default.
+	DefaultCriticalImages = "caching.knative.dev/critical=true"
+)
+
+// Bootstrap holds the gating of new nodes: they are kept tainted until the
+// critical Images are warmed on them, or the startup timeout passes.
+type Bootstrap struct {
+	// StartupTaint is the key of the NoSchedule taint keeping the Pods off a
+	// new node until its critical Images are warmed. Empty disables gating.
+	StartupTaint string
+	// ApplyStartupTaint has the controller taint the new nodes, rather than
+	// expect them to register with the taint.
+	ApplyStartupTaint bool
+	// CriticalImages selects the Images warmed before the taint is removed.
+	CriticalImages labels.Selector
+	// StartupTimeout is how long after its creation a node is kept tainted
+	// at most.
+	StartupTimeout time.Duration
+}
+
+// Enabled reports whether new nodes are gated.
+func (b *Bootstrap) Enabled() bool {
+	return b.StartupTaint != ""
+}
+
+// NewBootstrapFromConfigMap creates a Bootstrap from the supplied ConfigMap.
+func NewBootstrapFromConfigMap(configMap *corev1.ConfigMap) (*Bootstrap, error) {
+	b := defaultBootstrapConfig()
+
+	if value, ok := configMap.Data[startupTaintKey]; ok && value != "" {
+		if errs := validation.IsQualifiedName(value); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid %q %q: %v", startupTaintKey, value, errs)
+		}
+		b.StartupTaint = value
+	}
+	if value, ok := configMap.Data[applyStartupTaintKey]; ok {
+		apply, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", applyStartupTaintKey, err)
+		}
+		b.ApplyStartupTaint = apply
+	}
+	if value, ok := configMap.Data[criticalImagesKey]; ok {
+		selector, err := labels.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", criticalImagesKey, err)
+		}
+		b.CriticalImages = selector
+	}
+	if value, ok := configMap.Data[startupTimeoutKey]; ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", startupTimeoutKey, err)
+		}
+		if timeout <= 0 {
+			return nil, fmt.Errorf("%q must be positive, was %v", startupTimeoutKey, timeout)
+		}
+		b.StartupTimeout = timeout
+	}
+	return b, nil
+}
+
+func defaultBootstrapConfig() *Bootstrap {
+	selector, _ := labels.Parse(DefaultCriticalImages)
+	return &Bootstrap{
+		CriticalImages: selector,
+		StartupTimeout: 10 * time.Minute,
+	}
+}
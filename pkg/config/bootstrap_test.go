@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewBootstrapFromConfigMap(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        map[string]string
+		wantEnabled bool
+		wantApply   bool
+		wantImages  string
+		wantTimeout time.Duration
+		wantErr     bool
+	}{{
+		name:        "empty",
+		data:        map[string]string{},
+		wantImages:  DefaultCriticalImages,
+		wantTimeout: 10 * time.Minute,
+	}, {
+		name: "gating",
+		data: map[string]string{
+			startupTaintKey:      "caching.knative.dev/warming",
+			applyStartupTaintKey: "true",
+			criticalImagesKey:    "tier in (critical,system)",
+			startupTimeoutKey:    "5m",
+		},
+		wantEnabled: true,
+		wantApply:   true,
+		wantImages:  "tier in (critical,system)",
+		wantTimeout: 5 * time.Minute,
+	}, {
+		name:    "invalid taint",
+		data:    map[string]string{startupTaintKey: "not a key"},
+		wantErr: true,
+	}, {
+		name:    "invalid apply",
+		data:    map[string]string{applyStartupTaintKey: "sometimes"},
+		wantErr: true,
+	}, {
+		name:    "invalid selector",
+		data:    map[string]string{criticalImagesKey: "tier in critical"},
+		wantErr: true,
+	}, {
+		name:    "invalid timeout",
+		data:    map[string]string{startupTimeoutKey: "0s"},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewBootstrapFromConfigMap(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: BootstrapConfigName},
+				Data:       test.data,
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewBootstrapFromConfigMap() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Enabled() != test.wantEnabled {
+				t.Errorf("Enabled() = %v, want %v", got.Enabled(), test.wantEnabled)
+			}
+			if got.ApplyStartupTaint != test.wantApply {
+				t.Errorf("ApplyStartupTaint = %v, want %v", got.ApplyStartupTaint, test.wantApply)
+			}
+			if got.CriticalImages.String() != test.wantImages {
+				t.Errorf("CriticalImages = %v, want %v", got.CriticalImages, test.wantImages)
+			}
+			if got.StartupTimeout != test.wantTimeout {
+				t.Errorf("StartupTimeout = %v, want %v", got.StartupTimeout, test.wantTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// FeaturesConfigName is the name of the ConfigMap holding the feature flags.
+	FeaturesConfigName = "config-imagewarm-features"
+
+	nodeWarmPlansKey = "node-warm-plans"
+)
+
+// Flag is the value of a feature flag.
+type Flag string
+
+const (
+	// Enabled turns a feature on.
+	Enabled Flag = "Enabled"
+	// Disabled turns a feature off.
+	Disabled Flag = "Disabled"
+)
+
+// Features holds the feature flags.
+type Features struct {
+	// NodeWarmPlans warms the images of the Images on a node through a single
+	// NodeWarmPlan listing them, instead of one ImageWarm per Image.
+	NodeWarmPlans Flag
+}
+
+// NewFeaturesFromConfigMap creates a Features from the supplied ConfigMap.
+func NewFeaturesFromConfigMap(configMap *corev1.ConfigMap) (*Features, error) {
+	f := defaultFeaturesConfig()
+
+	if value, ok := configMap.Data[nodeWarmPlansKey]; ok {
+		flag, err := parseFlag(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", nodeWarmPlansKey, err)
+		}
+		f.NodeWarmPlans = flag
+	}
+	return f, nil
+}
+
+// parseFlag parses value, case insensitively, as Enabled or Disabled.
+func parseFlag(value string) (Flag, error) {
+	for _, flag := range []Flag{Enabled, Disabled} {
+		if strings.EqualFold(strings.TrimSpace(value), string(flag)) {
+			return flag, nil
+		}
+	}
+	return "", fmt.Errorf("must be %q or %q, was %q", Enabled, Disabled, value)
+}
+
+func defaultFeaturesConfig() *Features {
+	return &Features{
+		NodeWarmPlans: Disabled,
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewFeaturesFromConfigMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    *Features
+		wantErr bool
+	}{{
+		name: "empty",
+		data: map[string]string{},
+		want: defaultFeaturesConfig(),
+	}, {
+		name: "enabled",
+		data: map[string]string{nodeWarmPlansKey: "Enabled"},
+		want: &Features{NodeWarmPlans: Enabled},
+	}, {
+		name: "case insensitive",
+		data: map[string]string{nodeWarmPlansKey: "disabled"},
+		want: &Features{NodeWarmPlans: Disabled},
+	}, {
+		name:    "invalid",
+		data:    map[string]string{nodeWarmPlansKey: "yes"},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewFeaturesFromConfigMap(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: FeaturesConfigName},
+				Data:       test.data,
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewFeaturesFromConfigMap() = %v, wantErr %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("NewFeaturesFromConfigMap() (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
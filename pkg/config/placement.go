@@ -0,0 +1,75 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// PlacementConfigName is the name of the ConfigMap holding the default
+	// choice of the nodes Images are warmed on.
+	PlacementConfigName = "config-placement"
+
+	targetNodesKey           = "target-nodes"
+	ineligibleGracePeriodKey = "ineligible-grace-period"
+)
+
+// Placement holds the policy choosing the nodes an Image is warmed on.
+type Placement struct {
+	// TargetNodes is the number, or percentage, of the eligible nodes an
+	// Image is warmed on when its Revision does not bound its scale.
+	TargetNodes Threshold
+	// IneligibleGracePeriod is how long the ImageWarms of a node that is no
+	// longer eligible, e.g. tainted or cordoned for a while, are kept
+	// suspended before being deleted. Zero deletes them right away.
+	IneligibleGracePeriod time.Duration
+}
+
+// NewPlacementFromConfigMap creates a Placement from the supplied ConfigMap.
+func NewPlacementFromConfigMap(configMap *corev1.ConfigMap) (*Placement, error) {
+	p := defaultPlacementConfig()
+
+	if value, ok := configMap.Data[targetNodesKey]; ok {
+		threshold, err := ParseThreshold(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", targetNodesKey, err)
+		}
+		p.TargetNodes = threshold
+	}
+	if value, ok := configMap.Data[ineligibleGracePeriodKey]; ok {
+		period, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", ineligibleGracePeriodKey, err)
+		}
+		if period < 0 {
+			return nil, fmt.Errorf("%q must not be negative, was %v", ineligibleGracePeriodKey, period)
+		}
+		p.IneligibleGracePeriod = period
+	}
+	return p, nil
+}
+
+func defaultPlacementConfig() *Placement {
+	return &Placement{
+		TargetNodes:           Threshold{Percent: 100, IsPercent: true},
+		IneligibleGracePeriod: 5 * time.Minute,
+	}
+}
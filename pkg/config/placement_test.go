@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewPlacementFromConfigMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    *Placement
+		wantErr bool
+	}{{
+		name: "empty",
+		data: map[string]string{},
+		want: defaultPlacementConfig(),
+	}, {
+		name: "count",
+		data: map[string]string{targetNodesKey: "5"},
+		want: &Placement{TargetNodes: Threshold{Count: 5}, IneligibleGracePeriod: 5 * time.Minute},
+	}, {
+		name: "percentage",
+		data: map[string]string{targetNodesKey: "50%"},
+		want: &Placement{TargetNodes: Threshold{Percent: 50, IsPercent: true}, IneligibleGracePeriod: 5 * time.Minute},
+	}, {
+		name:    "invalid",
+		data:    map[string]string{targetNodesKey: "half"},
+		wantErr: true,
+	}, {
+		name: "grace period",
+		data: map[string]string{ineligibleGracePeriodKey: "90s"},
+		want: &Placement{TargetNodes: Threshold{Percent: 100, IsPercent: true}, IneligibleGracePeriod: 90 * time.Second},
+	}, {
+		name: "no grace period",
+		data: map[string]string{ineligibleGracePeriodKey: "0s"},
+		want: &Placement{TargetNodes: Threshold{Percent: 100, IsPercent: true}},
+	}, {
+		name:    "invalid grace period",
+		data:    map[string]string{ineligibleGracePeriodKey: "soon"},
+		wantErr: true,
+	}, {
+		name:    "negative grace period",
+		data:    map[string]string{ineligibleGracePeriodKey: "-1m"},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewPlacementFromConfigMap(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: PlacementConfigName},
+				Data:       test.data,
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewPlacementFromConfigMap() = %v, wantErr %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("NewPlacementFromConfigMap() (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/configmap"
+)
+
+const (
+	// ReadinessConfigName is the name of the ConfigMap holding the default
+	// readiness policy of Images.
+	ReadinessConfigName = "config-readiness"
+
+	minReadyNodesKey        = "min-ready-nodes"
+	minReadyNodesPerZoneKey = "min-ready-nodes-per-zone"
+	zoneLabelKey            = "zone-label"
+)
+
+// Threshold is a number of nodes, either absolute or a percentage of the
+// eligible nodes.
+type Threshold struct {
+	// Count is the number of nodes, when Percent is not set.
+	Count int
+	// Percent is the percentage of the eligible nodes, rounded up.
+	Percent int
+	// IsPercent tells whether the threshold is a percentage.
+	IsPercent bool
+}
+
+// ParseThreshold parses a number of nodes, e.g. "3", or a percentage, e.g. "80%".
+func ParseThreshold(value string) (Threshold, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+		if err != nil || percent < 0 || percent > 100 {
+			return Threshold{}, fmt.Errorf("invalid percentage %q, must be between 0%% and 100%%", value)
+		}
+		return Threshold{Percent: percent, IsPercent: true}, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return Threshold{}, fmt.Errorf("invalid number of nodes %q, must be a non-negative integer or a percentage", value)
+	}
+	return Threshold{Count: count}, nil
+}
+
+// Of returns the number of nodes the threshold requires out of total, at most total.
+func (t Threshold) Of(total int) int {
+	if t.IsPercent {
+		return (total*t.Percent + 99) / 100
+	}
+	if t.Count > total {
+		return total
+	}
+	return t.Count
+}
+
+// String formats the threshold as ParseThreshold parses it.
+func (t Threshold) String() string {
+	if t.IsPercent {
+		return strconv.Itoa(t.Percent) + "%"
+	}
+	return strconv.Itoa(t.Count)
+}
+
+// Readiness holds the policy deciding when an Image is Ready.
+type Readiness struct {
+	// MinReadyNodes is the number of eligible nodes that must hold the image.
+	MinReadyNodes Threshold
+	// MinReadyNodesPerZone is the number of eligible nodes of every zone that
+	// must hold the image, or all the eligible nodes of a smaller zone.
+	MinReadyNodesPerZone int
+	// ZoneLabel is the node label naming the zone of the node.
+	ZoneLabel string
+}
+
+// NewReadinessFromConfigMap creates a Readiness from the supplied ConfigMap.
+func NewReadinessFromConfigMap(configMap *corev1.ConfigMap) (*Readiness, error) {
+	r := defaultReadinessConfig()
+
+	if value, ok := configMap.Data[minReadyNodesKey]; ok {
+		threshold, err := ParseThreshold(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", minReadyNodesKey, err)
+		}
+		r.MinReadyNodes = threshold
+	}
+	if err := configmap.Parse(configMap.Data,
+		configmap.AsInt(minReadyNodesPerZoneKey, &r.MinReadyNodesPerZone),
+		configmap.AsString(zoneLabelKey, &r.ZoneLabel),
+	); err != nil {
+		return nil, err
+	}
+	if r.MinReadyNodesPerZone < 0 {
+		return nil, fmt.Errorf("%q must not be negative, was %d", minReadyNodesPerZoneKey, r.MinReadyNodesPerZone)
+	}
+	if r.ZoneLabel == "" {
+		return nil, fmt.Errorf("%q must not be empty", zoneLabelKey)
+	}
+	return r, nil
+}
+
+func defaultReadinessConfig() *Readiness {
+	return &Readiness{
+		MinReadyNodes: Threshold{Percent: 100, IsPercent: true},
+		ZoneLabel:     corev1.LabelZoneFailureDomainStable,
+	}
+}
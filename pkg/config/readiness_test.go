@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewReadinessFromConfigMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    *Readiness
+		wantErr bool
+	}{{
+		name: "empty",
+		data: map[string]string{},
+		want: defaultReadinessConfig(),
+	}, {
+		name: "count",
+		data: map[string]string{
+			minReadyNodesKey:        "3",
+			minReadyNodesPerZoneKey: "1",
+			zoneLabelKey:            "example.com/zone",
+		},
+		want: &Readiness{
+			MinReadyNodes:        Threshold{Count: 3},
+			MinReadyNodesPerZone: 1,
+			ZoneLabel:            "example.com/zone",
+		},
+	}, {
+		name: "percentage",
+		data: map[string]string{minReadyNodesKey: "80%"},
+		want: &Readiness{
+			MinReadyNodes: Threshold{Percent: 80, IsPercent: true},
+			ZoneLabel:     corev1.LabelZoneFailureDomainStable,
+		},
+	}, {
+		name:    "percentage above 100",
+		data:    map[string]string{minReadyNodesKey: "120%"},
+		wantErr: true,
+	}, {
+		name:    "negative count",
+		data:    map[string]string{minReadyNodesKey: "-1"},
+		wantErr: true,
+	}, {
+		name:    "bad per-zone minimum",
+		data:    map[string]string{minReadyNodesPerZoneKey: "one"},
+		wantErr: true,
+	}, {
+		name:    "empty zone label",
+		data:    map[string]string{zoneLabelKey: ""},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewReadinessFromConfigMap(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: ReadinessConfigName},
+				Data:       test.data,
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewReadinessFromConfigMap() = %v, wantErr %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("NewReadinessFromConfigMap() (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestThresholdOf(t *testing.T) {
+	tests := []struct {
+		value string
+		total int
+		want  int
+	}{
+		{"100%", 7, 7},
+		{"80%", 7, 6},
+		{"0%", 7, 0},
+		{"3", 7, 3},
+		{"10", 7, 7},
+	}
+	for _, test := range tests {
+		threshold, err := ParseThreshold(test.value)
+		if err != nil {
+			t.Fatalf("ParseThreshold(%q) = %v", test.value, err)
+		}
+		if got := threshold.Of(test.total); got != test.want {
+			t.Errorf("ParseThreshold(%q).Of(%d) = %d, want %d", test.value, test.total, got, test.want)
+		}
+	}
+}
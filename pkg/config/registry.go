@@ -0,0 +1,183 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// RegistryConfigName is the name of the ConfigMap holding the registry mirror settings.
+	RegistryConfigName = "config-registry"
+
+	// mirrorsKey holds a YAML map from registry prefix to an ordered list of mirror endpoints.
+	mirrorsKey = "mirrors"
+
+	// pullBudgetsKey holds a YAML map from registry host to the number of
+	// pulls from it allowed to run at once across the cluster.
+	pullBudgetsKey = "pull-budgets"
+)
+
+// PullSource is a single candidate location an image can be pulled from.
+type PullSource struct {
+	// Endpoint is the mirror endpoint, or the upstream registry domain, serving the pull.
+	Endpoint string
+	// ImageRef is the image reference rewritten to point at Endpoint.
+	ImageRef string
+}
+
+// Registry holds the registry mirror configuration.
+type Registry struct {
+	// Mirrors maps a normalized registry prefix, e.g. "docker.io" or
+	// "gcr.io/knative-samples", to the mirror endpoints tried in order
+	// before falling back to the upstream registry.
+	Mirrors map[string][]string
+
+	// PullBudgets maps a registry host, e.g. "docker.io" or
+	// "mirror.example.com:5000", to the number of pulls from it allowed to
+	// run at once across the cluster. Pulls from other registries are not bounded.
+	PullBudgets map[string]int
+}
+
+// NewRegistryFromConfigMap creates a Registry from the supplied ConfigMap.
+func NewRegistryFromConfigMap(configMap *corev1.ConfigMap) (*Registry, error) {
+	r := defaultRegistryConfig()
+
+	if raw, ok := configMap.Data[pullBudgetsKey]; ok && strings.TrimSpace(raw) != "" {
+		budgets := map[string]int{}
+		if err := yaml.Unmarshal([]byte(raw), &budgets); err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", pullBudgetsKey, err)
+		}
+		for host, budget := range budgets {
+			if host == "" || strings.ContainsAny(host, "/") {
+				return nil, fmt.Errorf("%q contains an invalid registry host %q", pullBudgetsKey, host)
+			}
+			if budget <= 0 {
+				return nil, fmt.Errorf("registry %q has a pull budget of %d, must be positive", host, budget)
+			}
+			r.PullBudgets[host] = budget
+		}
+	}
+
+	raw, ok := configMap.Data[mirrorsKey]
+	if !ok || strings.TrimSpace(raw) == "" {
+		return r, nil
+	}
+
+	mirrors := map[string][]string{}
+	if err := yaml.Unmarshal([]byte(raw), &mirrors); err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", mirrorsKey, err)
+	}
+
+	for prefix, endpoints := range mirrors {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" {
+			return nil, fmt.Errorf("%q contains an empty registry prefix", mirrorsKey)
+		}
+		if len(endpoints) == 0 {
+			return nil, fmt.Errorf("registry prefix %q has no mirror endpoints", prefix)
+		}
+		for i, endpoint := range endpoints {
+			if strings.Contains(endpoint, "://") {
+				return nil, fmt.Errorf("mirror endpoint %q for %q must not contain a scheme", endpoint, prefix)
+			}
+			endpoints[i] = strings.TrimSuffix(endpoint, "/")
+			if endpoints[i] == "" {
+				return nil, fmt.Errorf("registry prefix %q has an empty mirror endpoint", prefix)
+			}
+		}
+		r.Mirrors[prefix] = endpoints
+	}
+	return r, nil
+}
+
+func defaultRegistryConfig() *Registry {
+	return &Registry{Mirrors: map[string][]string{}, PullBudgets: map[string]int{}}
+}
+
+// RegistryHost returns the host of a pull source endpoint, e.g. "docker.io"
+// or "mirror.example.com" for "mirror.example.com/dockerhub".
+func RegistryHost(endpoint string) string {
+	return strings.SplitN(endpoint, "/", 2)[0]
+}
+
+// ImageRegistry returns the registry domain of imageRef, e.g. "docker.io"
+// for "nginx:latest".
+func ImageRegistry(imageRef string) string {
+	named, err := reference.ParseNormalizedNamed(imageRef)
+	if err != nil {
+		return RegistryHost(imageRef)
+	}
+	return reference.Domain(named)
+}
+
+// PullBudget returns the number of pulls from the registry serving endpoint
+// allowed to run at once across the cluster, 0 when they are not bounded.
+func (r *Registry) PullBudget(endpoint string) int {
+	return r.PullBudgets[RegistryHost(endpoint)]
+}
+
+// Sources returns the locations imageRef should be pulled from, in order:
+// every configured mirror for the longest matching registry prefix, then the
+// upstream registry itself.
+func (r *Registry) Sources(imageRef string) []PullSource {
+	named, err := reference.ParseNormalizedNamed(imageRef)
+	if err != nil {
+		// Leave references we cannot parse to the runtime.
+		return []PullSource{{Endpoint: "", ImageRef: imageRef}}
+	}
+	upstream := PullSource{Endpoint: reference.Domain(named), ImageRef: imageRef}
+
+	full := named.String()
+	prefix := r.longestPrefix(full)
+	if prefix == "" {
+		return []PullSource{upstream}
+	}
+
+	rest := strings.TrimPrefix(strings.TrimPrefix(full, prefix), "/")
+	sources := make([]PullSource, 0, len(r.Mirrors[prefix])+1)
+	for _, endpoint := range r.Mirrors[prefix] {
+		sources = append(sources, PullSource{
+			Endpoint: endpoint,
+			ImageRef: endpoint + "/" + rest,
+		})
+	}
+	return append(sources, upstream)
+}
+
+// longestPrefix returns the configured prefix that matches name on a path
+// boundary, preferring the most specific one.
+func (r *Registry) longestPrefix(name string) string {
+	prefixes := make([]string, 0, len(r.Mirrors))
+	for prefix := range r.Mirrors {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	for _, prefix := range prefixes {
+		if name == prefix || strings.HasPrefix(name, prefix+"/") {
+			return prefix
+		}
+	}
+	return ""
+}
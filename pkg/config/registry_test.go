@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewRegistryFromConfigMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    *Registry
+		wantErr bool
+	}{{
+		name: "empty",
+		data: map[string]string{},
+		want: defaultRegistryConfig(),
+	}, {
+		name: "mirrors",
+		data: map[string]string{
+			mirrorsKey: "docker.io:\n- mirror.example.com/hub/\n- backup.example.com\n",
+		},
+		want: &Registry{Mirrors: map[string][]string{
+			"docker.io": {"mirror.example.com/hub", "backup.example.com"},
+		}, PullBudgets: map[string]int{}},
+	}, {
+		name: "pull budgets",
+		data: map[string]string{
+			pullBudgetsKey: "docker.io: 20\nmirror.example.com:5000: 100\n",
+		},
+		want: &Registry{Mirrors: map[string][]string{}, PullBudgets: map[string]int{
+			"docker.io":               20,
+			"mirror.example.com:5000": 100,
+		}},
+	}, {
+		name:    "zero pull budget",
+		data:    map[string]string{pullBudgetsKey: "docker.io: 0\n"},
+		wantErr: true,
+	}, {
+		name:    "pull budget for a prefix",
+		data:    map[string]string{pullBudgetsKey: "docker.io/library: 5\n"},
+		wantErr: true,
+	}, {
+		name:    "bad yaml",
+		data:    map[string]string{mirrorsKey: "docker.io: [\n"},
+		wantErr: true,
+	}, {
+		name:    "no endpoints",
+		data:    map[string]string{mirrorsKey: "docker.io: []\n"},
+		wantErr: true,
+	}, {
+		name:    "scheme",
+		data:    map[string]string{mirrorsKey: "docker.io:\n- https://mirror.example.com\n"},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewRegistryFromConfigMap(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: RegistryConfigName},
+				Data:       test.data,
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewRegistryFromConfigMap() = %v, wantErr %v", err, test.wantErr)
+			}
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("NewRegistryFromConfigMap() (-want, +got) = %s", cmp.Diff(test.want, got))
+			}
+		})
+	}
+}
+
+func TestRegistrySources(t *testing.T) {
+	r := &Registry{Mirrors: map[string][]string{
+		"docker.io":               {"mirror.example.com/hub", "backup.example.com"},
+		"gcr.io/knative-releases": {"knative.example.com"},
+	}}
+
+	tests := []struct {
+		name  string
+		image string
+		want  []PullSource
+	}{{
+		name:  "docker hub short name",
+		image: "nginx:1.19",
+		want: []PullSource{
+			{Endpoint: "mirror.example.com/hub", ImageRef: "mirror.example.com/hub/library/nginx:1.19"},
+			{Endpoint: "backup.example.com", ImageRef: "backup.example.com/library/nginx:1.19"},
+			{Endpoint: "docker.io", ImageRef: "nginx:1.19"},
+		},
+	}, {
+		name:  "longest prefix wins",
+		image: "gcr.io/knative-releases/queue@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb",
+		want: []PullSource{
+			{Endpoint: "knative.example.com", ImageRef: "knative.example.com/queue@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"},
+			{Endpoint: "gcr.io", ImageRef: "gcr.io/knative-releases/queue@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"},
+		},
+	}, {
+		name:  "prefix only matches on path boundary",
+		image: "gcr.io/knative-releases-fork/queue:v1",
+		want: []PullSource{
+			{Endpoint: "gcr.io", ImageRef: "gcr.io/knative-releases-fork/queue:v1"},
+		},
+	}, {
+		name:  "no mirror",
+		image: "quay.io/foo/bar:v1",
+		want: []PullSource{
+			{Endpoint: "quay.io", ImageRef: "quay.io/foo/bar:v1"},
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := r.Sources(test.image); !cmp.Equal(got, test.want) {
+				t.Errorf("Sources(%q) (-want, +got) = %s", test.image, cmp.Diff(test.want, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/configmap"
+)
+
+const (
+	// RolloutConfigName is the name of the ConfigMap holding the default
+	// rollout of the ImageWarms of new Images.
+	RolloutConfigName = "config-rollout"
+
+	canaryNodesKey      = "canary-nodes"
+	waveSizeKey         = "wave-size"
+	progressDeadlineKey = "progress-deadline"
+)
+
+// Rollout holds the policy pacing the creation of the ImageWarms of an Image.
+type Rollout struct {
+	// CanaryNodes is the number of nodes warmed first. The other nodes are
+	// warmed once the canaries hold the image. No canary when 0.
+	CanaryNodes int
+	// WaveSize is the number, or percentage, of the target nodes warmed
+	// together, once the previous wave is done.
+	WaveSize Threshold
+	// ProgressDeadline is how long a node may warm the image before it is
+	// considered stuck: a stuck canary halts the rollout, and a stuck node of
+	// a wave no longer holds the next one. Zero waits for ever.
+	ProgressDeadline time.Duration
+}
+
+// NewRolloutFromConfigMap creates a Rollout from the supplied ConfigMap.
+func NewRolloutFromConfigMap(configMap *corev1.ConfigMap) (*Rollout, error) {
+	r := defaultRolloutConfig()
+
+	if err := configmap.Parse(configMap.Data,
+		configmap.AsInt(canaryNodesKey, &r.CanaryNodes),
+	); err != nil {
+		return nil, err
+	}
+	if r.CanaryNodes < 0 {
+		return nil, fmt.Errorf("%q must not be negative, was %d", canaryNodesKey, r.CanaryNodes)
+	}
+	if value, ok := configMap.Data[waveSizeKey]; ok {
+		threshold, err := ParseThreshold(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", waveSizeKey, err)
+		}
+		r.WaveSize = threshold
+	}
+	if value, ok := configMap.Data[progressDeadlineKey]; ok {
+		deadline, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", progressDeadlineKey, err)
+		}
+		if deadline < 0 {
+			return nil, fmt.Errorf("%q must not be negative, was %v", progressDeadlineKey, deadline)
+		}
+		r.ProgressDeadline = deadline
+	}
+	return r, nil
+}
+
+func defaultRolloutConfig() *Rollout {
+	return &Rollout{
+		WaveSize:         Threshold{Percent: 100, IsPercent: true},
+		ProgressDeadline: 15 * time.Minute,
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewRolloutFromConfigMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    *Rollout
+		wantErr bool
+	}{{
+		name: "empty",
+		data: map[string]string{},
+		want: defaultRolloutConfig(),
+	}, {
+		name: "canary and waves",
+		data: map[string]string{canaryNodesKey: "1", waveSizeKey: "10%"},
+		want: &Rollout{CanaryNodes: 1, WaveSize: Threshold{Percent: 10, IsPercent: true}, ProgressDeadline: 15 * time.Minute},
+	}, {
+		name: "progress deadline",
+		data: map[string]string{progressDeadlineKey: "30m"},
+		want: &Rollout{WaveSize: Threshold{Percent: 100, IsPercent: true}, ProgressDeadline: 30 * time.Minute},
+	}, {
+		name:    "negative progress deadline",
+		data:    map[string]string{progressDeadlineKey: "-1m"},
+		wantErr: true,
+	}, {
+		name:    "negative canary",
+		data:    map[string]string{canaryNodesKey: "-1"},
+		wantErr: true,
+	}, {
+		name:    "invalid wave size",
+		data:    map[string]string{waveSizeKey: "some"},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewRolloutFromConfigMap(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: RolloutConfigName},
+				Data:       test.data,
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewRolloutFromConfigMap() = %v, wantErr %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("NewRolloutFromConfigMap() (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// SettingsConfigName is the name of the ConfigMap holding the settings of
+	// the controller and the warmer.
+	SettingsConfigName = "config-imagewarm"
+
+	controllerResyncPeriodKey    = "controller-resync-period"
+	warmerResyncPeriodKey        = "warmer-resync-period"
+	maxImagePullRequestsKey      = "max-image-pull-requests"
+	imagePullProgressDeadlineKey = "image-pull-progress-deadline"
+	dockerRuntimeURIKey          = "docker-runtime-uri"
+	dockerTimeoutKey             = "docker-timeout"
+	globalPullSecretKey          = "global-pull-secret"
+	archiveURLHostsKey           = "archive-url-hosts"
+)
+
+// Settings holds the settings of the controller and the warmer.
+type Settings struct {
+	// ControllerResyncPeriod is how often the controller reconciles every
+	// Image on top of the changes that matter to them. Zero disables it.
+	ControllerResyncPeriod time.Duration
+	// WarmerResyncPeriod is how often the warmer reconciles every ImageWarm
+	// and the NodeWarmPlan of its node. The pulls run asynchronously, and
+	// this resync is what reports them Ready once finished, and pulls again
+	// the images removed from the node meanwhile, so it must be positive.
+	WarmerResyncPeriod time.Duration
+	// MaxImagePullRequests is how many pulls may be queued on a node, the
+	// reconciliations requesting more wait for room.
+	MaxImagePullRequests int
+	// ImagePullProgressDeadline is how long a pull may make no progress
+	// before it is cancelled.
+	ImagePullProgressDeadline time.Duration
+	// DockerRuntimeURI is the address of the docker daemon on the node.
+	DockerRuntimeURI string
+	// DockerTimeout bounds the short running docker operations, by default
+	// slightly offset from 2 minutes to make the timeouts recognizable.
+	DockerTimeout time.Duration
+	// GlobalPullSecret is the Secret, in the namespace of the ImageWarm, the
+	// images of the ImageWarms without pull secrets are pulled with. Empty
+	// pulls them anonymously.
+	GlobalPullSecret string
+	// ArchiveURLHosts are the hosts, with their port if not the default one,
+	// the image archives of the ImageWarms may be downloaded from. None
+	// refuses every archive URL.
+	ArchiveURLHosts sets.String
+}
+
+// NewSettingsFromConfigMap creates a Settings from the supplied ConfigMap.
+func NewSettingsFromConfigMap(configMap *corev1.ConfigMap) (*Settings, error) {
+	s := defaultSettingsConfig()
+
+	for _, d := range []struct {
+		key      string
+		field    *time.Duration
+		positive bool
+	}{
+		{controllerResyncPeriodKey, &s.ControllerResyncPeriod, false},
+		{warmerResyncPeriodKey, &s.WarmerResyncPeriod, true},
+		{imagePullProgressDeadlineKey, &s.ImagePullProgressDeadline, true},
+		{dockerTimeoutKey, &s.DockerTimeout, true},
+	} {
+		value, ok := configMap.Data[d.key]
+		if !ok {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", d.key, err)
+		}
+		if duration < 0 || (d.positive && duration == 0) {
+			return nil, fmt.Errorf("%q must be positive, was %v", d.key, duration)
+		}
+		*d.field = duration
+	}
+
+	if value, ok := configMap.Data[maxImagePullRequestsKey]; ok {
+		max, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", maxImagePullRequestsKey, err)
+		}
+		if max <= 0 {
+			return nil, fmt.Errorf("%q must be positive, was %d", maxImagePullRequestsKey, max)
+		}
+		s.MaxImagePullRequests = max
+	}
+
+	if value, ok := configMap.Data[dockerRuntimeURIKey]; ok {
+		uri, err := url.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", dockerRuntimeURIKey, err)
+		}
+		switch uri.Scheme {
+		case "unix", "tcp", "http", "https", "npipe":
+		default:
+			return nil, fmt.Errorf("%q must be a unix, tcp, http, https or npipe URI, was %q", dockerRuntimeURIKey, value)
+		}
+		s.DockerRuntimeURI = value
+	}
+
+	if value, ok := configMap.Data[globalPullSecretKey]; ok {
+		if value != "" {
+			if errs := validation.IsDNS1123Subdomain(value); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid %q %q: %v", globalPullSecretKey, value, errs)
+			}
+		}
+		s.GlobalPullSecret = value
+	}
+
+	if value, ok := configMap.Data[archiveURLHostsKey]; ok {
+		hosts := sets.NewString()
+		for _, host := range strings.Split(value, ",") {
+			host = strings.ToLower(strings.TrimSpace(host))
+			if host == "" {
+				continue
+			}
+			if u, err := url.Parse("http://" + host); err != nil || u.Host != host {
+				return nil, fmt.Errorf("%q contains an invalid host %q", archiveURLHostsKey, host)
+			}
+			hosts.Insert(host)
+		}
+		s.ArchiveURLHosts = hosts
+	}
+	return s, nil
+}
+
+func defaultSettingsConfig() *Settings {
+	return &Settings{
+		WarmerResyncPeriod:        5 * time.Second,
+		MaxImagePullRequests:      10,
+		ImagePullProgressDeadline: 5 * time.Minute,
+		DockerRuntimeURI:          "unix:///var/run/docker.sock",
+		DockerTimeout:             2*time.Minute - time.Second,
+		GlobalPullSecret:          "pullsecret",
+		ArchiveURLHosts:           sets.NewString(),
+	}
+}
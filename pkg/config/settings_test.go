@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestNewSettingsFromConfigMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    *Settings
+		wantErr bool
+	}{{
+		name: "empty",
+		data: map[string]string{},
+		want: defaultSettingsConfig(),
+	}, {
+		name: "all set",
+		data: map[string]string{
+			controllerResyncPeriodKey:    "10m",
+			warmerResyncPeriodKey:        "10s",
+			maxImagePullRequestsKey:      "20",
+			imagePullProgressDeadlineKey: "2m",
+			dockerRuntimeURIKey:          "tcp://127.0.0.1:2375",
+			dockerTimeoutKey:             "30s",
+			globalPullSecretKey:          "",
+			archiveURLHostsKey:           "archives.default.svc, Archives.example.com:8080,",
+		},
+		want: &Settings{
+			ControllerResyncPeriod:    10 * time.Minute,
+			WarmerResyncPeriod:        10 * time.Second,
+			MaxImagePullRequests:      20,
+			ImagePullProgressDeadline: 2 * time.Minute,
+			DockerRuntimeURI:          "tcp://127.0.0.1:2375",
+			DockerTimeout:             30 * time.Second,
+			ArchiveURLHosts:           sets.NewString("archives.default.svc", "archives.example.com:8080"),
+		},
+	}, {
+		name:    "invalid period",
+		data:    map[string]string{warmerResyncPeriodKey: "often"},
+		wantErr: true,
+	}, {
+		name:    "negative period",
+		data:    map[string]string{controllerResyncPeriodKey: "-1m"},
+		wantErr: true,
+	}, {
+		name:    "zero warmer resync period",
+		data:    map[string]string{warmerResyncPeriodKey: "0s"},
+		wantErr: true,
+	}, {
+		name:    "zero docker timeout",
+		data:    map[string]string{dockerTimeoutKey: "0s"},
+		wantErr: true,
+	}, {
+		name:    "zero pull requests",
+		data:    map[string]string{maxImagePullRequestsKey: "0"},
+		wantErr: true,
+	}, {
+		name:    "invalid pull requests",
+		data:    map[string]string{maxImagePullRequestsKey: "many"},
+		wantErr: true,
+	}, {
+		name:    "invalid runtime uri",
+		data:    map[string]string{dockerRuntimeURIKey: "/var/run/docker.sock"},
+		wantErr: true,
+	}, {
+		name:    "invalid pull secret",
+		data:    map[string]string{globalPullSecretKey: "Pull_Secret"},
+		wantErr: true,
+	}, {
+		name:    "invalid archive url host",
+		data:    map[string]string{archiveURLHostsKey: "http://archives.example.com/images"},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewSettingsFromConfigMap(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: SettingsConfigName},
+				Data:       test.data,
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewSettingsFromConfigMap() = %v, wantErr %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("NewSettingsFromConfigMap() (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
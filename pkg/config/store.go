@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+
+	"knative.dev/pkg/configmap"
+)
+
+type cfgKey struct{}
+
+// Config holds the collection of configurations that we attach to contexts.
+// Values are treated as immutable once they have been constructed.
+type Config struct {
+	Registry  *Registry
+	Readiness *Readiness
+	Placement *Placement
+	Rollout   *Rollout
+	Features  *Features
+	Bootstrap *Bootstrap
+	Settings  *Settings
+}
+
+// FromContext extracts a Config from the provided context.
+func FromContext(ctx context.Context) *Config {
+	x, ok := ctx.Value(cfgKey{}).(*Config)
+	if ok {
+		return x
+	}
+	return nil
+}
+
+// FromContextOrDefaults is like FromContext, but when no Config is attached it
+// returns a Config populated with the defaults for each of the Config fields.
+func FromContextOrDefaults(ctx context.Context) *Config {
+	cfg := FromContext(ctx)
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	if cfg.Registry == nil {
+		cfg.Registry = defaultRegistryConfig()
+	}
+	if cfg.Readiness == nil {
+		cfg.Readiness = defaultReadinessConfig()
+	}
+	if cfg.Placement == nil {
+		cfg.Placement = defaultPlacementConfig()
+	}
+	if cfg.Rollout == nil {
+		cfg.Rollout = defaultRolloutConfig()
+	}
+	if cfg.Features == nil {
+		cfg.Features = defaultFeaturesConfig()
+	}
+	if cfg.Bootstrap == nil {
+		cfg.Bootstrap = defaultBootstrapConfig()
+	}
+	if cfg.Settings == nil {
+		cfg.Settings = defaultSettingsConfig()
+	}
+	return cfg
+}
+
+// ToContext attaches the provided Config to the provided context, returning the
+// new context with the Config attached.
+func ToContext(ctx context.Context, c *Config) context.Context {
+	return context.WithValue(ctx, cfgKey{}, c)
+}
+
+// Store is a typed wrapper around configmap.UntypedStore to handle our configmaps.
+type Store struct {
+	*configmap.UntypedStore
+}
+
+// NewStore creates a new store of Configs and optionally calls functions when ConfigMaps are updated.
+func NewStore(logger configmap.Logger, onAfterStore ...func(name string, value interface{})) *Store {
+	return &Store{
+		UntypedStore: configmap.NewUntypedStore(
+			"imagewarm",
+			logger,
+			configmap.Constructors{
+				RegistryConfigName:  NewRegistryFromConfigMap,
+				ReadinessConfigName: NewReadinessFromConfigMap,
+				PlacementConfigName: NewPlacementFromConfigMap,
+				RolloutConfigName:   NewRolloutFromConfigMap,
+				FeaturesConfigName:  NewFeaturesFromConfigMap,
+				BootstrapConfigName: NewBootstrapFromConfigMap,
+				SettingsConfigName:  NewSettingsFromConfigMap,
+			},
+			onAfterStore...,
+		),
+	}
+}
+
+// ToContext attaches the current Config state to the provided context.
+func (s *Store) ToContext(ctx context.Context) context.Context {
+	return ToContext(ctx, s.Load())
+}
+
+// Load creates a Config from the current config state of the Store.
+func (s *Store) Load() *Config {
+	return &Config{
+		Registry:  s.UntypedLoad(RegistryConfigName).(*Registry),
+		Readiness: s.UntypedLoad(ReadinessConfigName).(*Readiness),
+		Placement: s.UntypedLoad(PlacementConfigName).(*Placement),
+		Rollout:   s.UntypedLoad(RolloutConfigName).(*Rollout),
+		Features:  s.UntypedLoad(FeaturesConfigName).(*Features),
+		Bootstrap: s.UntypedLoad(BootstrapConfigName).(*Bootstrap),
+		Settings:  s.UntypedLoad(SettingsConfigName).(*Settings),
+	}
+}
+
+// LoadSettings returns the current Settings of the Store, or the defaults
+// until the ConfigMap is loaded, for the components running before.
+func (s *Store) LoadSettings() *Settings {
+	if settings, ok := s.UntypedLoad(SettingsConfigName).(*Settings); ok {
+		return settings
+	}
+	return defaultSettingsConfig()
+}
+
+// LoadRegistry returns the current Registry of the Store, or the defaults
+// until the ConfigMap is loaded, for the components running outside of a
+// reconcile.
+func (s *Store) LoadRegistry() *Registry {
+	if registry, ok := s.UntypedLoad(RegistryConfigName).(*Registry); ok {
+		return registry
+	}
+	return defaultRegistryConfig()
+}
+
+// LoadBootstrap returns the current Bootstrap of the Store, or the defaults
+// until the ConfigMap is loaded, for the event handlers running outside of a
+// reconcile.
+func (s *Store) LoadBootstrap() *Bootstrap {
+	if bootstrap, ok := s.UntypedLoad(BootstrapConfigName).(*Bootstrap); ok {
+		return bootstrap
+	}
+	return defaultBootstrapConfig()
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pullbudget
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	coordinationlisters "k8s.io/client-go/listers/coordination/v1"
+	"k8s.io/client-go/util/retry"
+	"knative.dev/pkg/logging"
+)
+
+// releaseTimeout bounds releasing a slot, after the pull is done.
+const releaseTimeout = 10 * time.Second
+
+// Acquirer acquires the pull slots of the registries for a warmer.
+type Acquirer struct {
+	client    kubernetes.Interface
+	lister    coordinationlisters.LeaseLister
+	namespace string
+	// identity is the holder identity of the slots acquired, the node name.
+	identity string
+}
+
+// NewAcquirer creates an Acquirer of the pull slots in namespace, listed by
+// lister, holding them as identity.
+func NewAcquirer(client kubernetes.Interface, lister coordinationlisters.LeaseLister, namespace, identity string) *Acquirer {
+	return &Acquirer{
+		client:    client,
+		lister:    lister,
+		namespace: namespace,
+		identity:  identity,
+	}
+}
+
+// TryAcquire acquires a free pull slot of the registry host, if any, without
+// waiting for one. The slot is renewed until the returned func releases it.
+func (a *Acquirer) TryAcquire(ctx context.Context, host string) (func(), bool, error) {
+	slots, err := a.lister.Leases(a.namespace).List(registrySelector(host))
+	if err != nil {
+		return nil, false, err
+	}
+	// Look at the slots in random order, so that warmers do not all race for
+	// the same one.
+	rand.Shuffle(len(slots), func(i, j int) { slots[i], slots[j] = slots[j], slots[i] })
+	for _, slot := range slots {
+		if !free(slot, time.Now()) {
+			continue
+		}
+		acquired := slot.DeepCopy()
+		hold(acquired, a.identity, time.Now())
+		if _, err := a.client.CoordinationV1().Leases(a.namespace).Update(ctx, acquired, metav1.UpdateOptions{}); err != nil {
+			// Another warmer got the slot first, or the lister is stale.
+			continue
+		}
+		logging.FromContext(ctx).Infof("Acquired pull slot %s of registry %s", slot.Name, host)
+		return a.renew(ctx, slot.Name), true, nil
+	}
+	return nil, false, nil
+}
+
+// renew renews the slot until the returned func is called, which releases it.
+func (a *Acquirer) renew(ctx context.Context, name string) func() {
+	logger := logging.FromContext(ctx)
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(renewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				if err := a.update(context.Background(), name, func(slot *coordinationv1.Lease) bool {
+					if holder(slot) != a.identity {
+						return false
+					}
+					hold(slot, a.identity, time.Now())
+					return true
+				}); err != nil {
+					logger.Warnw("Failed to renew pull slot "+name, "error", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopCh)
+			<-doneCh
+			if err := a.releaseSlot(name); err != nil {
+				logger.Warnw("Failed to release pull slot "+name, "error", err)
+			}
+		})
+	}
+}
+
+// ReleaseAll releases the slots held by the identity, e.g. by the previous
+// instance of the warmer that died while pulling.
+func (a *Acquirer) ReleaseAll(ctx context.Context) error {
+	slots, err := a.client.CoordinationV1().Leases(a.namespace).List(ctx, metav1.ListOptions{LabelSelector: RegistryLabelKey})
+	if err != nil {
+		return err
+	}
+	for _, slot := range slots.Items {
+		if holder(&slot) == a.identity {
+			if err := a.releaseSlot(slot.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Acquirer) releaseSlot(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	return a.update(ctx, name, func(slot *coordinationv1.Lease) bool {
+		if holder(slot) != a.identity {
+			return false
+		}
+		release(slot)
+		return true
+	})
+}
+
+// update applies mutate to the latest version of the slot, when mutate
+// reports a change, retrying on conflicts.
+func (a *Acquirer) update(ctx context.Context, name string, mutate func(*coordinationv1.Lease) bool) error {
+	leases := a.client.CoordinationV1().Leases(a.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		slot, err := leases.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !mutate(slot) {
+			return nil
+		}
+		_, err = leases.Update(ctx, slot, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pullbudget
+
+import (
+	"context"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	"knative.dev/pkg/logging"
+)
+
+// syncInterval is how often the Manager syncs the pull slots.
+const syncInterval = 10 * time.Second
+
+// Manager keeps the pull slots of the budgeted registries in line with their
+// budgets, and reclaims the slots whose holder stopped renewing them.
+type Manager struct {
+	client    kubernetes.Interface
+	namespace string
+	// budgets returns the current budget of every registry host.
+	budgets func() map[string]int
+}
+
+// NewManager creates a Manager of the pull slots in namespace.
+func NewManager(client kubernetes.Interface, namespace string, budgets func() map[string]int) *Manager {
+	return &Manager{
+		client:    client,
+		namespace: namespace,
+		budgets:   budgets,
+	}
+}
+
+// Start syncs the pull slots periodically, until ctx is done, whenever
+// isLeader reports this replica leads, so that a single replica manages them.
+func (m *Manager) Start(ctx context.Context, isLeader func() bool) {
+	logger := logging.FromContext(ctx)
+
+	go func() {
+		ticker := time.NewTicker(syncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !isLeader() {
+					continue
+				}
+				if err := m.Sync(ctx); err != nil {
+					logger.Errorw("Failed to sync the pull slots", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Sync creates the missing pull slots, deletes those of registries no longer
+// budgeted or beyond their budget, and frees the expired ones.
+func (m *Manager) Sync(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+	leases := m.client.CoordinationV1().Leases(m.namespace)
+
+	wanted := map[string]*coordinationv1.Lease{}
+	for host, budget := range m.budgets() {
+		for index := 0; index < budget; index++ {
+			slot := makeSlot(m.namespace, host, index)
+			wanted[slot.Name] = slot
+		}
+	}
+	existing, err := leases.List(ctx, metav1.ListOptions{LabelSelector: RegistryLabelKey})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	now := time.Now()
+	for k := range existing.Items {
+		slot := &existing.Items[k]
+		if _, ok := wanted[slot.Name]; !ok {
+			if err := leases.Delete(ctx, slot.Name, metav1.DeleteOptions{}); err != nil && !apierrs.IsNotFound(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		delete(wanted, slot.Name)
+		if holder(slot) != "" && expired(slot, now) {
+			logger.Infof("Reclaiming pull slot %s from %s", slot.Name, holder(slot))
+			release(slot)
+			// A conflict means the slot was renewed or acquired meanwhile.
+			if _, err := leases.Update(ctx, slot, metav1.UpdateOptions{}); err != nil && !apierrs.IsConflict(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	for _, slot := range wanted {
+		if _, err := leases.Create(ctx, slot, metav1.CreateOptions{}); err != nil && !apierrs.IsAlreadyExists(err) {
+			errs = append(errs, err)
+		}
+	}
+	if len(wanted) > 0 {
+		logger.Infof("Created %d pull slots", len(wanted))
+	}
+	return utilerrors.NewAggregate(errs)
+}
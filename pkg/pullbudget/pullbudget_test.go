@@ -0,0 +1,164 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pullbudget
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	coordinationlisters "k8s.io/client-go/listers/coordination/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const namespace = "knative-serving"
+
+func slotNames(t *testing.T, client *fake.Clientset) []string {
+	t.Helper()
+	slots, err := client.CoordinationV1().Leases(namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	var names []string
+	for _, slot := range slots.Items {
+		names = append(names, slot.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestManagerSync(t *testing.T) {
+	stale := makeSlot(namespace, "docker.io", 0)
+	hold(stale, "node-1", time.Now().Add(-time.Hour))
+	client := fake.NewSimpleClientset(stale, makeSlot(namespace, "docker.io", 5), makeSlot(namespace, "quay.io", 0))
+
+	budgets := map[string]int{"docker.io": 2, "registry.example.com:5000": 1}
+	m := NewManager(client, namespace, func() map[string]int { return budgets })
+	if err := m.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+
+	want := []string{"pull-docker.io-0", "pull-docker.io-1", "pull-registry.example.com-5000-0"}
+	if diff := cmp.Diff(want, slotNames(t, client)); diff != "" {
+		t.Errorf("slots (-want, +got) = %s", diff)
+	}
+	reclaimed, err := client.CoordinationV1().Leases(namespace).Get(context.Background(), stale.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() = %v", err)
+	}
+	if got := holder(reclaimed); got != "" {
+		t.Errorf("holder of the expired slot = %q, want it reclaimed", got)
+	}
+}
+
+func TestTryAcquire(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset(makeSlot(namespace, "docker.io", 0))
+	factory := kubeinformers.NewSharedInformerFactoryWithOptions(client, 0, kubeinformers.WithNamespace(namespace))
+	leaseInformer := factory.Coordination().V1().Leases()
+	leaseInformer.Informer()
+	factory.Start(ctx.Done())
+	cache.WaitForCacheSync(ctx.Done(), leaseInformer.Informer().HasSynced)
+
+	node1 := NewAcquirer(client, leaseInformer.Lister(), namespace, "node-1")
+	node2 := NewAcquirer(client, leaseInformer.Lister(), namespace, "node-2")
+
+	release, ok, err := node1.TryAcquire(ctx, "docker.io")
+	if err != nil || !ok {
+		t.Fatalf("TryAcquire() = %v, %v, want a slot", ok, err)
+	}
+	if got := slotHolder(t, client); got != "node-1" {
+		t.Errorf("holder = %q, want node-1", got)
+	}
+	// The fake client does not detect conflicting updates, wait for the
+	// lister to see the slot held.
+	waitForHolder(t, leaseInformer.Lister(), "node-1")
+
+	// The only slot is held, node-2 gets none.
+	if _, ok, err := node2.TryAcquire(ctx, "docker.io"); err != nil || ok {
+		t.Fatalf("TryAcquire() = %v, %v while the slot is held, want no slot", ok, err)
+	}
+
+	release()
+	if got := slotHolder(t, client); got != "" {
+		t.Errorf("holder = %q after release, want none", got)
+	}
+	waitForHolder(t, leaseInformer.Lister(), "")
+	release, ok, err = node2.TryAcquire(ctx, "docker.io")
+	if err != nil || !ok {
+		t.Fatalf("TryAcquire() = %v, %v, want a slot", ok, err)
+	}
+	defer release()
+	if got := slotHolder(t, client); got != "node-2" {
+		t.Errorf("holder = %q, want node-2", got)
+	}
+}
+
+func TestReleaseAll(t *testing.T) {
+	held := makeSlot(namespace, "docker.io", 0)
+	hold(held, "node-1", time.Now())
+	client := fake.NewSimpleClientset(held)
+
+	if err := NewAcquirer(client, nil, namespace, "node-1").ReleaseAll(context.Background()); err != nil {
+		t.Fatalf("ReleaseAll() = %v", err)
+	}
+	if got := slotHolder(t, client); got != "" {
+		t.Errorf("holder = %q, want none", got)
+	}
+}
+
+func waitForHolder(t *testing.T, lister coordinationlisters.LeaseLister, want string) {
+	t.Helper()
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		slot, err := lister.Leases(namespace).Get("pull-docker.io-0")
+		return err == nil && holder(slot) == want, nil
+	}); err != nil {
+		t.Fatalf("The lister did not see the slot held by %q: %v", want, err)
+	}
+}
+
+func slotHolder(t *testing.T, client *fake.Clientset) string {
+	t.Helper()
+	slot, err := client.CoordinationV1().Leases(namespace).Get(context.Background(), "pull-docker.io-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() = %v", err)
+	}
+	return holder(slot)
+}
+
+func TestFree(t *testing.T) {
+	now := time.Now()
+	slot := &coordinationv1.Lease{}
+	if !free(slot, now) {
+		t.Error("free() = false for a slot never held")
+	}
+	hold(slot, "node-1", now)
+	if free(slot, now.Add(LeaseDuration/2)) {
+		t.Error("free() = true for a slot renewed recently")
+	}
+	if !free(slot, now.Add(2*LeaseDuration)) {
+		t.Error("free() = false for an expired slot")
+	}
+}
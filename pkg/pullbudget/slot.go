@@ -0,0 +1,129 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package pullbudget bounds the pulls from a registry running at once across
+// the cluster. The controller keeps one Lease, a pull slot, per pull allowed
+// from every budgeted registry, and the warmers hold a slot while pulling.
+package pullbudget
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"knative.dev/pkg/kmeta"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching"
+)
+
+const (
+	// RegistryLabelKey labels the pull slot Leases with the registry they
+	// bound the pulls from.
+	RegistryLabelKey = caching.GroupName + "/pullRegistry"
+	// RegistryAnnotationKey holds the registry host of a pull slot Lease.
+	RegistryAnnotationKey = caching.GroupName + "/pullRegistry"
+
+	// LeaseDuration is how long a pull slot stays held when its holder stops
+	// renewing it, e.g. because its warmer died.
+	LeaseDuration = 30 * time.Second
+	// renewInterval is how often the holder of a pull slot renews it.
+	renewInterval = LeaseDuration / 3
+)
+
+// registryKey returns the label value identifying the registry host, which
+// may contain a port.
+func registryKey(host string) string {
+	key := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, host)
+	return kmeta.ChildName(key, "")
+}
+
+// registrySelector selects the pull slots of the registry host.
+func registrySelector(host string) labels.Selector {
+	return labels.SelectorFromSet(labels.Set{RegistryLabelKey: registryKey(host)})
+}
+
+// makeSlot returns the index-th pull slot of the registry host.
+func makeSlot(namespace, host string, index int) *coordinationv1.Lease {
+	key := registryKey(host)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        kmeta.ChildName("pull-"+key, "-"+strconv.Itoa(index)),
+			Labels:      map[string]string{RegistryLabelKey: key},
+			Annotations: map[string]string{RegistryAnnotationKey: host},
+		},
+	}
+}
+
+// holder returns the identity of the holder of the slot, empty when it is free.
+func holder(slot *coordinationv1.Lease) string {
+	if slot.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *slot.Spec.HolderIdentity
+}
+
+// expired reports whether the holder of the slot stopped renewing it.
+func expired(slot *coordinationv1.Lease, now time.Time) bool {
+	if slot.Spec.RenewTime == nil {
+		return true
+	}
+	duration := LeaseDuration
+	if slot.Spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*slot.Spec.LeaseDurationSeconds) * time.Second
+	}
+	return slot.Spec.RenewTime.Add(duration).Before(now)
+}
+
+// free reports whether the slot can be acquired.
+func free(slot *coordinationv1.Lease, now time.Time) bool {
+	return holder(slot) == "" || expired(slot, now)
+}
+
+// hold makes identity the holder of the slot, renewed at now.
+func hold(slot *coordinationv1.Lease, identity string, now time.Time) {
+	renewTime := metav1.NewMicroTime(now)
+	duration := int32(LeaseDuration / time.Second)
+	if holder(slot) != identity {
+		transitions := int32(0)
+		if slot.Spec.LeaseTransitions != nil {
+			transitions = *slot.Spec.LeaseTransitions + 1
+		}
+		slot.Spec.HolderIdentity = &identity
+		slot.Spec.AcquireTime = &renewTime
+		slot.Spec.LeaseTransitions = &transitions
+	}
+	slot.Spec.RenewTime = &renewTime
+	slot.Spec.LeaseDurationSeconds = &duration
+}
+
+// release frees the slot.
+func release(slot *coordinationv1.Lease) {
+	slot.Spec.HolderIdentity = nil
+	slot.Spec.AcquireTime = nil
+	slot.Spec.RenewTime = nil
+}
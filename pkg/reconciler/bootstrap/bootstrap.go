@@ -0,0 +1,259 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/reconciler"
+
+	"knative.dev/cache-imagewarm/pkg/config"
+)
+
+const (
+	// ImagesWarmedCondition is the Node condition recording whether the
+	// critical Images were warmed on the node before its startup taint was
+	// removed.
+	ImagesWarmedCondition corev1.NodeConditionType = "ImagesWarmed"
+
+	// WarmedReason is the reason of the condition when the critical Images
+	// were warmed.
+	WarmedReason = "CriticalImagesWarmed"
+	// TimedOutReason is the reason of the condition when the startup timeout
+	// passed first.
+	TimedOutReason = "StartupTimeout"
+)
+
+// PendingImages reports the critical Images not warmed on a node yet.
+type PendingImages interface {
+	PendingCriticalImages(ctx context.Context, node *corev1.Node) ([]*v1alpha1.Image, error)
+}
+
+// Reconciler implements controller.Reconciler for Node resources, keeping the
+// startup taint on the new nodes until their critical Images are warmed.
+type Reconciler struct {
+	reconciler.LeaderAwareFuncs
+
+	KubeClient  kubernetes.Interface
+	NodeLister  corelisters.NodeLister
+	Images      PendingImages
+	ConfigStore reconciler.ConfigStore
+	// EnqueueAfter enqueues the node again after the delay, once its startup
+	// timeout passes.
+	EnqueueAfter func(key types.NamespacedName, after time.Duration)
+}
+
+// Check that our Reconciler implements controller.Reconciler.
+var _ controller.Reconciler = (*Reconciler)(nil)
+
+// Reconcile taints the new node when the controller applies the startup
+// taint, and removes the taint once the critical Images are warmed on the
+// node or the startup timeout passed, recording the outcome in its status.
+func (r *Reconciler) Reconcile(ctx context.Context, key string) error {
+	logger := logging.FromContext(ctx)
+
+	_, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		logger.Errorf("invalid resource key: %s", key)
+		return nil
+	}
+	if !r.IsLeaderFor(types.NamespacedName{Name: name}) {
+		return nil
+	}
+	ctx = r.ConfigStore.ToContext(ctx)
+	bootstrap := config.FromContextOrDefaults(ctx).Bootstrap
+	if !bootstrap.Enabled() {
+		return nil
+	}
+
+	node, err := r.NodeLister.Get(name)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	left := bootstrap.StartupTimeout - time.Since(node.CreationTimestamp.Time)
+	if !hasTaint(node, bootstrap.StartupTaint) {
+		// Only the new nodes whose outcome is not recorded yet are tainted.
+		if !bootstrap.ApplyStartupTaint || left <= 0 || condition(node) != nil {
+			return nil
+		}
+		logger.Infof("Tainting new Node %s with %s until its critical images are warmed", name, bootstrap.StartupTaint)
+		return r.updateTaints(ctx, name, func(taints []corev1.Taint) []corev1.Taint {
+			return append(taints, corev1.Taint{Key: bootstrap.StartupTaint, Effect: corev1.TaintEffectNoSchedule})
+		})
+	}
+
+	// The eligibility of a node that is not Ready yet, e.g. still tainted
+	// not-ready, tells nothing about the Images to wait for.
+	ready := nodeReady(node)
+	var pending []string
+	if ready {
+		if pending, err = r.pending(ctx, node); err != nil {
+			return err
+		}
+	}
+
+	var outcome corev1.NodeCondition
+	switch {
+	case ready && len(pending) == 0:
+		outcome = corev1.NodeCondition{
+			Type:    ImagesWarmedCondition,
+			Status:  corev1.ConditionTrue,
+			Reason:  WarmedReason,
+			Message: "The critical images are warmed",
+		}
+	case left <= 0:
+		message := fmt.Sprintf("The node did not become Ready within %v", bootstrap.StartupTimeout)
+		if ready {
+			message = fmt.Sprintf("The critical images %s were not warmed within %v",
+				strings.Join(pending, ", "), bootstrap.StartupTimeout)
+		}
+		outcome = corev1.NodeCondition{
+			Type:    ImagesWarmedCondition,
+			Status:  corev1.ConditionFalse,
+			Reason:  TimedOutReason,
+			Message: message,
+		}
+	default:
+		if r.EnqueueAfter != nil {
+			r.EnqueueAfter(types.NamespacedName{Name: name}, left)
+		}
+		return nil
+	}
+
+	// The outcome is recorded first, so that the node is not tainted again.
+	if err := r.recordOutcome(ctx, name, outcome); err != nil {
+		return err
+	}
+	logger.Infof("Removing the taint %s of Node %s: %s", bootstrap.StartupTaint, name, outcome.Message)
+	return r.updateTaints(ctx, name, func(taints []corev1.Taint) []corev1.Taint {
+		kept := taints[:0]
+		for _, taint := range taints {
+			if taint.Key != bootstrap.StartupTaint {
+				kept = append(kept, taint)
+			}
+		}
+		return kept
+	})
+}
+
+// pending returns the namespace/name keys of the critical Images not warmed
+// on the node yet.
+func (r *Reconciler) pending(ctx context.Context, node *corev1.Node) ([]string, error) {
+	images, err := r.Images.PendingCriticalImages(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(images))
+	for _, i := range images {
+		keys = append(keys, i.Namespace+"/"+i.Name)
+	}
+	return keys, nil
+}
+
+// updateTaints applies mutate to the taints of the node read from the API
+// server, and updates the node when they changed, retrying on conflicts.
+func (r *Reconciler) updateTaints(ctx context.Context, name string, mutate func([]corev1.Taint) []corev1.Taint) error {
+	nodes := r.KubeClient.CoreV1().Nodes()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := nodes.Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		before := len(node.Spec.Taints)
+		node.Spec.Taints = mutate(node.Spec.Taints)
+		if len(node.Spec.Taints) == before {
+			return nil
+		}
+		if _, err := nodes.Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update the taints of node %s, err: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// recordOutcome sets the ImagesWarmed condition of the node.
+func (r *Reconciler) recordOutcome(ctx context.Context, name string, outcome corev1.NodeCondition) error {
+	now := metav1.Now()
+	outcome.LastHeartbeatTime = now
+	outcome.LastTransitionTime = now
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []corev1.NodeCondition{outcome},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := r.KubeClient.CoreV1().Nodes().PatchStatus(ctx, name, patch); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to record the outcome of the startup of node %s, err: %w", name, err)
+	}
+	return nil
+}
+
+// hasTaint reports whether the node has a taint with the key.
+func hasTaint(node *corev1.Node, key string) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// condition returns the ImagesWarmed condition of the node, if any.
+func condition(node *corev1.Node) *corev1.NodeCondition {
+	for k := range node.Status.Conditions {
+		if node.Status.Conditions[k].Type == ImagesWarmedCondition {
+			return &node.Status.Conditions[k]
+		}
+	}
+	return nil
+}
+
+// nodeReady reports whether the kubelet of the node reports it Ready, and
+// the node lifecycle controller removed its not-ready taints accordingly.
+func nodeReady(node *corev1.Node) bool {
+	if hasTaint(node, corev1.TaintNodeNotReady) || hasTaint(node, corev1.TaintNodeUnreachable) {
+		return false
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
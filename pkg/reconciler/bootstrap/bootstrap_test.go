@@ -0,0 +1,196 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/pkg/reconciler"
+	"sigs.k8s.io/yaml"
+
+	"knative.dev/cache-imagewarm/pkg/config"
+)
+
+const startupTaint = "caching.knative.dev/warming"
+
+type configStore struct {
+	bootstrap *config.Bootstrap
+}
+
+func (s configStore) ToContext(ctx context.Context) context.Context {
+	return config.ToContext(ctx, &config.Config{Bootstrap: s.bootstrap})
+}
+
+type pendingImages []*v1alpha1.Image
+
+func (p pendingImages) PendingCriticalImages(context.Context, *corev1.Node) ([]*v1alpha1.Image, error) {
+	return p, nil
+}
+
+func TestReconcile(t *testing.T) {
+	helloworld := &v1alpha1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "helloworld"}}
+	node := func(age time.Duration, tainted, ready bool, conditions ...corev1.NodeCondition) *corev1.Node {
+		n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:              "node-1",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		}}
+		if tainted {
+			n.Spec.Taints = []corev1.Taint{{Key: startupTaint, Effect: corev1.TaintEffectNoSchedule}}
+		}
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		n.Status.Conditions = append(conditions, corev1.NodeCondition{Type: corev1.NodeReady, Status: status})
+		return n
+	}
+	recorded := corev1.NodeCondition{Type: ImagesWarmedCondition, Status: corev1.ConditionTrue}
+
+	tests := []struct {
+		name        string
+		node        *corev1.Node
+		apply       bool
+		pending     pendingImages
+		wantTainted bool
+		wantReason  string
+		wantRequeue bool
+	}{{
+		name:        "expected taint, images pending",
+		node:        node(time.Minute, true, true),
+		pending:     pendingImages{helloworld},
+		wantTainted: true,
+		wantRequeue: true,
+	}, {
+		name:       "expected taint, images warmed",
+		node:       node(time.Minute, true, true),
+		wantReason: WarmedReason,
+	}, {
+		name:        "expected taint, not ready",
+		node:        node(time.Minute, true, false),
+		wantTainted: true,
+		wantRequeue: true,
+	}, {
+		name:       "expected taint, timed out",
+		node:       node(time.Hour, true, true),
+		pending:    pendingImages{helloworld},
+		wantReason: TimedOutReason,
+	}, {
+		name: "untainted new node",
+		node: node(time.Minute, false, true),
+	}, {
+		name:        "applied taint",
+		node:        node(time.Minute, false, false),
+		apply:       true,
+		wantTainted: true,
+	}, {
+		name:  "applied taint, old node",
+		node:  node(time.Hour, false, true),
+		apply: true,
+	}, {
+		name:  "applied taint, outcome recorded",
+		node:  node(time.Minute, false, true, recorded),
+		apply: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			nodes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			nodes.Add(test.node)
+			client := kubefake.NewSimpleClientset(test.node)
+			requeued := false
+			r := &Reconciler{
+				KubeClient: client,
+				NodeLister: corelisters.NewNodeLister(nodes),
+				Images:     test.pending,
+				ConfigStore: configStore{&config.Bootstrap{
+					StartupTaint:      startupTaint,
+					ApplyStartupTaint: test.apply,
+					StartupTimeout:    10 * time.Minute,
+				}},
+				EnqueueAfter: func(types.NamespacedName, time.Duration) { requeued = true },
+			}
+			r.Promote(reconciler.UniversalBucket(), func(reconciler.Bucket, types.NamespacedName) {})
+
+			if err := r.Reconcile(ctx, "node-1"); err != nil {
+				t.Fatalf("Reconcile() = %v", err)
+			}
+
+			got, err := client.CoreV1().Nodes().Get(ctx, "node-1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Get() = %v", err)
+			}
+			if tainted := hasTaint(got, startupTaint); tainted != test.wantTainted {
+				t.Errorf("tainted = %v, want %v", tainted, test.wantTainted)
+			}
+			if requeued != test.wantRequeue {
+				t.Errorf("requeued = %v, want %v", requeued, test.wantRequeue)
+			}
+			var reason string
+			if cond := condition(got); cond != nil {
+				reason = cond.Reason
+			}
+			if reason != test.wantReason {
+				t.Errorf("ImagesWarmed reason = %q, want %q", reason, test.wantReason)
+			}
+			if nodeReady(got) != nodeReady(test.node) {
+				t.Errorf("Ready condition = %v, want it kept", got.Status.Conditions)
+			}
+		})
+	}
+}
+
+func TestWarmerToleratesStartupTaint(t *testing.T) {
+	raw, err := ioutil.ReadFile("../../../config/401-daemonset.yaml")
+	if err != nil {
+		t.Fatal("ReadFile() =", err)
+	}
+	var daemonSet appsv1.DaemonSet
+	if err := yaml.Unmarshal(raw, &daemonSet); err != nil {
+		t.Fatal("Unmarshal() =", err)
+	}
+
+	// Nodes registered with the taint only get Pods tolerating it, while the
+	// cordoned nodes, and those kept for other Pods, are left alone.
+	tolerates := func(taint *corev1.Taint) bool {
+		for _, toleration := range daemonSet.Spec.Template.Spec.Tolerations {
+			if toleration.ToleratesTaint(taint) {
+				return true
+			}
+		}
+		return false
+	}
+	if !tolerates(&corev1.Taint{Key: startupTaint, Effect: corev1.TaintEffectNoSchedule}) {
+		t.Errorf("the warmer DaemonSet does not tolerate the startup taint %s", startupTaint)
+	}
+	for _, key := range []string{corev1.TaintNodeUnschedulable, "dedicated"} {
+		if tolerates(&corev1.Taint{Key: key, Effect: corev1.TaintEffectNoSchedule}) {
+			t.Errorf("the warmer DaemonSet tolerates the taint %s", key)
+		}
+	}
+}
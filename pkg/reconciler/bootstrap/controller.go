@@ -0,0 +1,117 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	imagecacheinformer "knative.dev/caching/pkg/client/injection/informers/caching/v1alpha1/image"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	nodeinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/node"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/reconciler"
+	revisioninformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/revision"
+
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	imagewarmerinformer "knative.dev/cache-imagewarm/pkg/client/injection/informers/caching/v1alpha1/imagewarm"
+	inventoryinformer "knative.dev/cache-imagewarm/pkg/client/injection/informers/caching/v1alpha1/nodeimageinventory"
+	nodewarmplaninformer "knative.dev/cache-imagewarm/pkg/client/injection/informers/caching/v1alpha1/nodewarmplan"
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/reconciler/image"
+)
+
+// NewController creates the Reconciler gating the new nodes on their critical
+// Images, and returns its controller.Impl.
+func NewController(
+	ctx context.Context,
+	cmw configmap.Watcher,
+) *controller.Impl {
+	logger := logging.FromContext(ctx)
+
+	nodeInformer := nodeinformer.Get(ctx)
+	imageWarmInformer := imagewarmerinformer.Get(ctx)
+	imageCacheInformer := imagecacheinformer.Get(ctx)
+	inventoryInformer := inventoryinformer.Get(ctx)
+	revisionInformer := revisioninformer.Get(ctx)
+	planInformer := nodewarmplaninformer.Get(ctx)
+
+	configStore := config.NewStore(logger.Named("config-store"))
+	configStore.WatchConfigs(cmw)
+
+	nodeLister := nodeInformer.Lister()
+	r := &Reconciler{
+		LeaderAwareFuncs: reconciler.LeaderAwareFuncs{
+			PromoteFunc: func(bkt reconciler.Bucket, enq func(reconciler.Bucket, types.NamespacedName)) error {
+				nodes, err := nodeLister.List(labels.Everything())
+				if err != nil {
+					return err
+				}
+				for _, node := range nodes {
+					enq(bkt, types.NamespacedName{Name: node.Name})
+				}
+				return nil
+			},
+		},
+		KubeClient: kubeclient.Get(ctx),
+		NodeLister: nodeLister,
+		Images: &image.Reconciler{
+			ImageWarmerLister:  imageWarmInformer.Lister(),
+			ImageCacheLister:   imageCacheInformer.Lister(),
+			NodeLister:         nodeLister,
+			InventoryLister:    inventoryInformer.Lister(),
+			RevisionLister:     revisionInformer.Lister(),
+			NodeWarmPlanLister: planInformer.Lister(),
+		},
+		ConfigStore: configStore,
+	}
+	impl := controller.NewImpl(r, logger, "NodeBootstrap")
+	r.EnqueueAfter = impl.EnqueueKeyAfter
+
+	logger.Info("Setting up event handlers.")
+
+	nodeInformer.Informer().AddEventHandler(controller.HandleAll(impl.Enqueue))
+
+	// The ImageWarms and NodeWarmPlans getting Ready may end the startup of
+	// their node.
+	imageWarmInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueueNodeOf(impl.EnqueueKey),
+		UpdateFunc: controller.PassNew(enqueueNodeOf(impl.EnqueueKey)),
+	})
+	planInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueueNodeOf(impl.EnqueueKey),
+		UpdateFunc: controller.PassNew(enqueueNodeOf(impl.EnqueueKey)),
+	})
+
+	return impl
+}
+
+// enqueueNodeOf enqueues the node of the ImageWarm or NodeWarmPlan.
+func enqueueNodeOf(h func(types.NamespacedName)) func(obj interface{}) {
+	return func(obj interface{}) {
+		switch o := obj.(type) {
+		case *cachingv1alpha1.ImageWarm:
+			h(types.NamespacedName{Name: o.Spec.NodeName})
+		case *cachingv1alpha1.NodeWarmPlan:
+			h(types.NamespacedName{Name: o.Spec.NodeName})
+		}
+	}
+}
@@ -20,23 +20,30 @@ import (
 	"context"
 	"time"
 
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/cache"
-	"knative.dev/caching/pkg/apis/caching/v1alpha1"
 	imagecacheinformer "knative.dev/caching/pkg/client/injection/informers/caching/v1alpha1/image"
 	cachereconciler "knative.dev/caching/pkg/client/injection/reconciler/caching/v1alpha1/image"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
 	nodeinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/node"
+	podinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/pod"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
+	"knative.dev/pkg/system"
+	revisioninformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/revision"
 
 	servingclient "knative.dev/cache-imagewarm/pkg/client/injection/client"
 	imagewarmerinformer "knative.dev/cache-imagewarm/pkg/client/injection/informers/caching/v1alpha1/imagewarm"
+	inventoryinformer "knative.dev/cache-imagewarm/pkg/client/injection/informers/caching/v1alpha1/nodeimageinventory"
+	nodewarmplaninformer "knative.dev/cache-imagewarm/pkg/client/injection/informers/caching/v1alpha1/nodewarmplan"
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/pullbudget"
 	"knative.dev/cache-imagewarm/pkg/reconciler/image"
+	"knative.dev/cache-imagewarm/pkg/resync"
+	"knative.dev/cache-imagewarm/pkg/tracing"
 )
 
-// Recheck image every 10 minutes
-const ControllerResyncPerion = 10 * time.Second
-
 // NewController creates a Reconciler and returns the result of NewImpl.
 func NewController(
 	ctx context.Context,
@@ -47,32 +54,98 @@ func NewController(
 	imageWarmInformer := imagewarmerinformer.Get(ctx)
 	imageCacheInformer := imagecacheinformer.Get(ctx)
 	nodeInformer := nodeinformer.Get(ctx)
+	inventoryInformer := inventoryinformer.Get(ctx)
+	revisionInformer := revisioninformer.Get(ctx)
+	podInformer := podinformer.Get(ctx)
+	planInformer := nodewarmplaninformer.Get(ctx)
+
+	if err := imageWarmInformer.Informer().AddIndexers(image.ImageWarmIndexers); err != nil {
+		logger.Fatalf("Failed to add the ImageWarm indexers, err: %v", err)
+	}
+	if err := planInformer.Informer().AddIndexers(image.NodeWarmPlanIndexers); err != nil {
+		logger.Fatalf("Failed to add the NodeWarmPlan indexers, err: %v", err)
+	}
+	if err := podInformer.Informer().AddIndexers(image.PodIndexers); err != nil {
+		logger.Fatalf("Failed to add the Pod indexers, err: %v", err)
+	}
 
 	r := &image.Reconciler{
-		ImageWarmerLister: imageWarmInformer.Lister(),
-		ImageCacheLister:  imageCacheInformer.Lister(),
-		ImageWarmClient:   servingclient.Get(ctx),
-		NodeLister:        nodeInformer.Lister(),
+		ImageWarmerLister:   imageWarmInformer.Lister(),
+		ImageCacheLister:    imageCacheInformer.Lister(),
+		ImageWarmClient:     servingclient.Get(ctx),
+		NodeLister:          nodeInformer.Lister(),
+		InventoryLister:     inventoryInformer.Lister(),
+		RevisionLister:      revisionInformer.Lister(),
+		NodeWarmPlanLister:  planInformer.Lister(),
+		ImageWarmIndexer:    imageWarmInformer.Informer().GetIndexer(),
+		NodeWarmPlanIndexer: planInformer.Informer().GetIndexer(),
+		PodIndexer:          podInformer.Informer().GetIndexer(),
+		IneligibleNodes:     image.NewIneligibleNodes(),
+		WarmStarts:          image.NewWarmStarts(),
+	}
+	configStore := config.NewStore(logger.Named("config-store"))
+	impl := cachereconciler.NewImpl(ctx, r, func(impl *controller.Impl) controller.Options {
+		logger.Info("Setting up ConfigMap receivers")
+		configStore.WatchConfigs(cmw)
+		return controller.Options{ConfigStore: configStore}
+	})
+	r.EnqueueAfter = impl.EnqueueAfter
+	r.LoadBootstrap = configStore.LoadBootstrap
+
+	// The budgets are read on every sync of the slots, which follows the edits
+	// of the ConfigMap.
+	pullbudget.NewManager(kubeclient.Get(ctx), system.Namespace(), func() map[string]int {
+		return configStore.LoadRegistry().PullBudgets
+	}).Start(ctx, leaderFor(impl, "pull-budgets"))
+
+	if err := tracing.Setup(ctx, cmw, "controller"); err != nil {
+		logger.Errorf("Failed to set up tracing, err: %v", err)
 	}
-	impl := cachereconciler.NewImpl(ctx, r)
 
 	logger.Info("Setting up event handlers.")
 
-	imageCacheInformer.Informer().AddEventHandlerWithResyncPeriod(controller.HandleAll(impl.Enqueue), ControllerResyncPerion)
-
-	imageWarmInformer.Informer().AddEventHandlerWithResyncPeriod(cache.FilteringResourceEventHandler{
-		FilterFunc: controller.FilterControllerGK(v1alpha1.Kind("Image")),
-		Handler: cache.ResourceEventHandlerFuncs{
-			AddFunc:    impl.EnqueueControllerOf,
-			UpdateFunc: controller.PassNew(impl.EnqueueControllerOf),
-		},
-	}, ControllerResyncPerion)
-
-	nodeInformer.Informer().AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
+	// Images are reconciled on the changes that matter to them, and only
+	// periodically when the controller-resync-period is set.
+	imageCacheInformer.Informer().AddEventHandler(controller.HandleAll(impl.Enqueue))
+	resync.Every(ctx, func() time.Duration {
+		return configStore.LoadSettings().ControllerResyncPeriod
+	}, func() {
+		impl.GlobalResync(imageCacheInformer.Informer())
+	})
+	imageCacheInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: r.DeleteImage(ctx),
+	})
+
+	imageWarmInformer.Informer().AddEventHandler(image.ImageWarmHandler(impl.EnqueueControllerOf))
+
+	planInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    image.EnqueuePlannedImages(impl.EnqueueKey),
+		UpdateFunc: controller.PassNew(image.EnqueuePlannedImages(impl.EnqueueKey)),
+		DeleteFunc: image.EnqueuePlannedImages(impl.EnqueueKey),
+	})
+
+	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    r.AddNode(ctx, impl.Enqueue),
 		UpdateFunc: r.UpdateNode(ctx, impl.Enqueue),
-		DeleteFunc: r.AddNode(ctx, impl.Enqueue),
-	}, ControllerResyncPerion)
+		DeleteFunc: r.DeleteNode(ctx, impl.Enqueue),
+	})
+
+	r.SweepOrphans(ctx, leaderFor(impl, "orphans"))
+
+	inventoryInformer.Informer().AddEventHandler(r.InventoryHandler(ctx, impl.Enqueue))
 
 	return impl
 }
+
+// leaderFor returns whether this replica leads the bucket of the key name in
+// the system namespace, for the work of the controller that is not keyed by
+// an Image and must only run on one replica at a time.
+func leaderFor(impl *controller.Impl, name string) func() bool {
+	key := types.NamespacedName{Namespace: system.Namespace(), Name: name}
+	return func() bool {
+		la, ok := impl.Reconciler.(interface {
+			IsLeaderFor(types.NamespacedName) bool
+		})
+		return !ok || la.IsLeaderFor(key)
+	}
+}
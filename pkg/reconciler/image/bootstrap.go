@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+
+	"knative.dev/cache-imagewarm/pkg/config"
+)
+
+// PendingCriticalImages returns the critical Images the new node is eligible
+// for, and whose image it neither holds nor has warmed yet.
+func (r Reconciler) PendingCriticalImages(ctx context.Context, node *v1.Node) ([]*v1alpha1.Image, error) {
+	bootstrap := config.FromContextOrDefaults(ctx).Bootstrap
+	images, err := r.ImageCacheLister.List(bootstrap.CriticalImages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the critical imageCaches, err: %w", err)
+	}
+
+	var pending []*v1alpha1.Image
+	for _, i := range images {
+		if !i.DeletionTimestamp.IsZero() {
+			continue
+		}
+		revision, err := r.owningRevision(i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the revision of imageCache :%s/%s, err: %w", i.Namespace, i.Name, err)
+		}
+		scheduling, err := r.scheduling(i, revision)
+		if err != nil {
+			// Never warmed, the Image does not hold the node.
+			continue
+		}
+		tolerateStartupTaint(i, scheduling, bootstrap)
+		if !nodeEligible(node, scheduling) || r.imagePresent(i, node) {
+			continue
+		}
+		if warm, err := r.listedWarm(ctx, i, node.Name); err == nil && warm.Status.IsReady() {
+			continue
+		}
+		pending = append(pending, i)
+	}
+	return pending, nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	imagecachelisters "knative.dev/caching/pkg/client/listers/caching/v1alpha1"
+	servinglisters "knative.dev/serving/pkg/client/listers/serving/v1"
+
+	imagewarmlisters "knative.dev/cache-imagewarm/pkg/client/listers/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+)
+
+func TestPendingCriticalImages(t *testing.T) {
+	critical := func(name, image string) *v1alpha1.Image {
+		return &v1alpha1.Image{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+				Labels:    map[string]string{"caching.knative.dev/critical": "true"},
+			},
+			Spec: v1alpha1.ImageSpec{Image: image},
+		}
+	}
+	pending := critical("pending", "pending:v1")
+	warmed := critical("warmed", "warmed:v1")
+	present := critical("present", "docker.io/library/present:v1")
+	other := &v1alpha1.Image{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "other"},
+		Spec:       v1alpha1.ImageSpec{Image: "other:v1"},
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Spec: corev1.NodeSpec{Taints: []corev1.Taint{{
+			Key:    "caching.knative.dev/warming",
+			Effect: corev1.TaintEffectNoSchedule,
+		}}},
+		Status: corev1.NodeStatus{Images: []corev1.ContainerImage{{Names: []string{"docker.io/library/present:v1"}}}},
+	}
+
+	images := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, i := range []*v1alpha1.Image{pending, warmed, present, other} {
+		images.Add(i)
+	}
+	warm := imagewarm.MakeImageWarm(warmed, "node-1")
+	warm.Status.MarkReadyTrue()
+	imageWarms := cache.NewIndexer(cache.MetaNamespaceKeyFunc, ImageWarmIndexers)
+	imageWarms.Add(warm)
+	r := Reconciler{
+		ImageCacheLister:  imagecachelisters.NewImageLister(images),
+		ImageWarmerLister: imagewarmlisters.NewImageWarmLister(imageWarms),
+		RevisionLister:    servinglisters.NewRevisionLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+	}
+
+	bootstrap, err := config.NewBootstrapFromConfigMap(&corev1.ConfigMap{Data: map[string]string{
+		"startup-taint": "caching.knative.dev/warming",
+	}})
+	if err != nil {
+		t.Fatalf("NewBootstrapFromConfigMap() = %v", err)
+	}
+	ctx := config.ToContext(context.Background(), &config.Config{Bootstrap: bootstrap})
+	got, err := r.PendingCriticalImages(ctx, node)
+	if err != nil {
+		t.Fatalf("PendingCriticalImages() = %v", err)
+	}
+	var names []string
+	for _, i := range got {
+		names = append(names, i.Name)
+	}
+	if diff := cmp.Diff([]string{"pending"}, names); diff != "" {
+		t.Errorf("PendingCriticalImages() (-want, +got) = %s", diff)
+	}
+}
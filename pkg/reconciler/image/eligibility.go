@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
+	schedulinghelper "k8s.io/kubernetes/pkg/scheduler/framework/plugins/helper"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching"
+	"knative.dev/cache-imagewarm/pkg/config"
+)
+
+// TolerationsAnnotation is the Image annotation holding, as a JSON list, the
+// tolerations of the Pods running the image. When it is not set, the
+// tolerations of the Revision owning the Image are used.
+const TolerationsAnnotation = caching.GroupName + "/tolerations"
+
+// scheduling returns the constraints on the nodes the Pods running the image
+// can be scheduled on: the node selector, node affinity and tolerations of
+// the Revision owning the Image, if any, the tolerations possibly overridden by the
+// annotation of the Image.
+func (r Reconciler) scheduling(i *v1alpha1.Image, revision *servingv1.Revision) (*corev1.PodSpec, error) {
+	spec := &corev1.PodSpec{}
+	if revision != nil {
+		spec.NodeSelector = revision.Spec.NodeSelector
+		spec.Affinity = revision.Spec.Affinity
+		spec.Tolerations = revision.Spec.Tolerations
+	}
+
+	if value, ok := i.Annotations[TolerationsAnnotation]; ok {
+		var tolerations []corev1.Toleration
+		if err := json.Unmarshal([]byte(value), &tolerations); err != nil {
+			return nil, fmt.Errorf("invalid annotation %s: %w", TolerationsAnnotation, err)
+		}
+		spec.Tolerations = tolerations
+	}
+	return spec, nil
+}
+
+// tolerateStartupTaint has the critical Images tolerate the startup taint of
+// the new nodes, so that they are warmed there before the other Images.
+func tolerateStartupTaint(i *v1alpha1.Image, spec *corev1.PodSpec, bootstrap *config.Bootstrap) {
+	if !bootstrap.Enabled() || !bootstrap.CriticalImages.Matches(labels.Set(i.Labels)) {
+		return
+	}
+	// The tolerations may be those of the Revision, from the informer cache.
+	spec.Tolerations = append(append([]corev1.Toleration(nil), spec.Tolerations...), corev1.Toleration{
+		Key:      bootstrap.StartupTaint,
+		Operator: corev1.TolerationOpExists,
+		Effect:   corev1.TaintEffectNoSchedule,
+	})
+}
+
+// owningRevision returns the Revision controlling the Image, if any.
+func (r Reconciler) owningRevision(i *v1alpha1.Image) (*servingv1.Revision, error) {
+	owner := metav1.GetControllerOf(i)
+	if owner == nil || owner.Kind != "Revision" {
+		return nil, nil
+	}
+	if gv, err := schema.ParseGroupVersion(owner.APIVersion); err != nil || gv.Group != servingv1.SchemeGroupVersion.Group {
+		return nil, nil
+	}
+	revision, err := r.RevisionLister.Revisions(i.Namespace).Get(owner.Name)
+	if apierrs.IsNotFound(err) {
+		return nil, nil
+	}
+	return revision, err
+}
+
+// nodeEligible reports whether the scheduler could place Pods with the spec
+// on the node: it is schedulable, matches their node selector and required
+// node affinity, and all its NoSchedule and NoExecute taints are tolerated.
+// PreferNoSchedule taints and preferred node affinity do not prevent scheduling.
+func nodeEligible(node *corev1.Node, spec *corev1.PodSpec) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	if !schedulinghelper.PodMatchesNodeSelectorAndAffinityTerms(&corev1.Pod{Spec: *spec}, node) {
+		return false
+	}
+	_, untolerated := v1helper.FindMatchingUntoleratedTaint(node.Spec.Taints, spec.Tolerations, func(taint *corev1.Taint) bool {
+		return taint.Effect == corev1.TaintEffectNoSchedule || taint.Effect == corev1.TaintEffectNoExecute
+	})
+	return !untolerated
+}
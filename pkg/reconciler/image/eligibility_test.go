@@ -0,0 +1,184 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/pkg/kmeta"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	servinglisters "knative.dev/serving/pkg/client/listers/serving/v1"
+
+	"knative.dev/cache-imagewarm/pkg/config"
+)
+
+func TestNodeEligible(t *testing.T) {
+	dedicated := corev1.Taint{Key: "dedicated", Value: "knative", Effect: corev1.TaintEffectNoSchedule}
+	tolerateDedicated := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "knative", Effect: corev1.TaintEffectNoSchedule}
+
+	gpu := &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchExpressions: []corev1.NodeSelectorRequirement{{
+					Key:      "accelerator",
+					Operator: corev1.NodeSelectorOpIn,
+					Values:   []string{"nvidia-tesla-t4"},
+				}},
+			}},
+		},
+	}}
+
+	tests := []struct {
+		name         string
+		labels       map[string]string
+		taints       []corev1.Taint
+		cordoned     bool
+		tolerations  []corev1.Toleration
+		nodeSelector map[string]string
+		affinity     *corev1.Affinity
+		want         bool
+	}{{
+		name: "untainted",
+		want: true,
+	}, {
+		name:     "cordoned",
+		cordoned: true,
+	}, {
+		name:   "untolerated NoSchedule",
+		taints: []corev1.Taint{dedicated},
+	}, {
+		name:        "tolerated NoSchedule",
+		taints:      []corev1.Taint{dedicated},
+		tolerations: []corev1.Toleration{tolerateDedicated},
+		want:        true,
+	}, {
+		name:        "untolerated NoExecute",
+		taints:      []corev1.Taint{dedicated, {Key: "node.kubernetes.io/unreachable", Effect: corev1.TaintEffectNoExecute}},
+		tolerations: []corev1.Toleration{tolerateDedicated},
+	}, {
+		name:   "PreferNoSchedule",
+		taints: []corev1.Taint{{Key: "spot", Effect: corev1.TaintEffectPreferNoSchedule}},
+		want:   true,
+	}, {
+		name:         "node selector matches",
+		labels:       map[string]string{"pool": "knative"},
+		nodeSelector: map[string]string{"pool": "knative"},
+		want:         true,
+	}, {
+		name:         "node selector does not match",
+		labels:       map[string]string{"pool": "batch"},
+		nodeSelector: map[string]string{"pool": "knative"},
+	}, {
+		name:     "required node affinity matches",
+		labels:   map[string]string{"accelerator": "nvidia-tesla-t4"},
+		affinity: gpu,
+		want:     true,
+	}, {
+		name:     "required node affinity does not match",
+		affinity: gpu,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Labels: test.labels},
+				Spec:       corev1.NodeSpec{Taints: test.taints, Unschedulable: test.cordoned},
+			}
+			spec := &corev1.PodSpec{NodeSelector: test.nodeSelector, Affinity: test.affinity, Tolerations: test.tolerations}
+			if got := nodeEligible(node, spec); got != test.want {
+				t.Errorf("nodeEligible() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScheduling(t *testing.T) {
+	revision := &servingv1.Revision{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "helloworld-00001"},
+	}
+	revision.Spec.Tolerations = []corev1.Toleration{{Key: "from-revision", Operator: corev1.TolerationOpExists}}
+	revision.Spec.NodeSelector = map[string]string{"pool": "knative"}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	indexer.Add(revision)
+	r := Reconciler{RevisionLister: servinglisters.NewRevisionLister(indexer)}
+
+	owned := &v1alpha1.Image{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       "default",
+		Name:            "helloworld-00001-cache",
+		OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(revision)},
+	}}
+	owner, err := r.owningRevision(owned)
+	if err != nil || owner == nil {
+		t.Fatalf("owningRevision() = %v, %v, want the Revision", owner, err)
+	}
+	got, err := r.scheduling(owned, owner)
+	if err != nil || len(got.Tolerations) != 1 || got.Tolerations[0].Key != "from-revision" || got.NodeSelector["pool"] != "knative" {
+		t.Errorf("scheduling() = %v, %v, want the constraints of the Revision", got, err)
+	}
+
+	owned.Annotations = map[string]string{TolerationsAnnotation: `[{"key": "from-annotation", "operator": "Exists"}]`}
+	got, err = r.scheduling(owned, owner)
+	if err != nil || len(got.Tolerations) != 1 || got.Tolerations[0].Key != "from-annotation" || got.NodeSelector["pool"] != "knative" {
+		t.Errorf("scheduling() = %v, %v, want the tolerations of the annotation", got, err)
+	}
+
+	owned.Annotations[TolerationsAnnotation] = "{"
+	if _, err := r.scheduling(owned, owner); err == nil {
+		t.Error("scheduling() succeeded with an invalid annotation, want an error")
+	}
+
+	if got, err := r.scheduling(&v1alpha1.Image{}, nil); err != nil || len(got.Tolerations) != 0 || got.NodeSelector != nil || got.Affinity != nil {
+		t.Errorf("scheduling() = %v, %v, want no constraints", got, err)
+	}
+}
+
+func TestTolerateStartupTaint(t *testing.T) {
+	bootstrap, err := config.NewBootstrapFromConfigMap(&corev1.ConfigMap{Data: map[string]string{
+		"startup-taint": "caching.knative.dev/warming",
+	}})
+	if err != nil {
+		t.Fatalf("NewBootstrapFromConfigMap() = %v", err)
+	}
+	node := &corev1.Node{Spec: corev1.NodeSpec{Taints: []corev1.Taint{{
+		Key:    "caching.knative.dev/warming",
+		Effect: corev1.TaintEffectNoSchedule,
+	}}}}
+	// The tolerations of a Revision, with room to append in place.
+	shared := make([]corev1.Toleration, 1, 2)
+	shared[0] = corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpExists}
+
+	critical := &v1alpha1.Image{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"caching.knative.dev/critical": "true"}}}
+	spec := &corev1.PodSpec{Tolerations: shared}
+	tolerateStartupTaint(critical, spec, bootstrap)
+	if !nodeEligible(node, spec) {
+		t.Error("nodeEligible() = false for a critical Image, want true")
+	}
+	if extra := shared[:2][1]; extra.Key != "" {
+		t.Errorf("tolerations of the Revision extended with %v, want them unchanged", extra)
+	}
+
+	other := &v1alpha1.Image{}
+	spec = &corev1.PodSpec{}
+	tolerateStartupTaint(other, spec, bootstrap)
+	if nodeEligible(node, spec) {
+		t.Error("nodeEligible() = true for an Image that is not critical, want false")
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/config"
+)
+
+// ImageWarmHandler enqueues, with enqueueControllerOf, the Image owning an
+// ImageWarm added, updated or deleted. A deleted ImageWarm, e.g. by a user or
+// the garbage collector, is created again without waiting for a resync.
+func ImageWarmHandler(enqueueControllerOf func(interface{})) cache.ResourceEventHandler {
+	ownedByImage := controller.FilterControllerGK(v1alpha1.Kind("Image"))
+	return cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			return ownedByImage(obj)
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    enqueueControllerOf,
+			UpdateFunc: controller.PassNew(enqueueControllerOf),
+			DeleteFunc: enqueueControllerOf,
+		},
+	}
+}
+
+// InventoryHandler enqueues the Images appearing in, or disappearing from, the
+// inventory of a node, including when the inventory is published or deleted.
+func (r Reconciler) InventoryHandler(ctx context.Context, h func(interface{})) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			r.enqueueInventoryChange(ctx, h, nil, obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			r.enqueueInventoryChange(ctx, h, oldObj, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			r.enqueueInventoryChange(ctx, h, obj, nil)
+		},
+	}
+}
+
+// enqueueInventoryChange enqueues the Images held by only one of the old and
+// new inventories, where a nil inventory holds no image.
+func (r Reconciler) enqueueInventoryChange(ctx context.Context, h func(interface{}), oldObj, newObj interface{}) {
+	logger := logging.FromContext(ctx)
+	oldStatus, ok1 := inventoryStatus(oldObj)
+	newStatus, ok2 := inventoryStatus(newObj)
+	if !ok1 || !ok2 {
+		logger.Errorf("unexpected types %T and %T, expected NodeImageInventory", oldObj, newObj)
+		return
+	}
+	if equality.Semantic.DeepEqual(oldStatus.Images, newStatus.Images) {
+		return
+	}
+
+	imageList, err := r.ImageCacheLister.List(labels.Everything())
+	if err != nil {
+		logger.Errorf("Error enqueueing imageCache sets: %v", err)
+		return
+	}
+	for _, image := range imageList {
+		if oldStatus.HasImage(image.Spec.Image) != newStatus.HasImage(image.Spec.Image) {
+			h(image)
+		}
+	}
+}
+
+// inventoryStatus returns the status of the inventory obj, empty when obj is nil.
+func inventoryStatus(obj interface{}) (*cachingv1alpha1.NodeImageInventoryStatus, bool) {
+	if obj == nil {
+		return &cachingv1alpha1.NodeImageInventoryStatus{}, true
+	}
+	inventory, ok := obj.(*cachingv1alpha1.NodeImageInventory)
+	if !ok {
+		return nil, false
+	}
+	return &inventory.Status, true
+}
+
+// enqueueAffected enqueues the Images a change of node matters to, where a
+// nil oldNode is a node added and a nil newNode a node deleted.
+func (r Reconciler) enqueueAffected(ctx context.Context, h func(interface{}), oldNode, newNode *v1.Node) {
+	imageList, err := r.ImageCacheLister.List(labels.Everything())
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Error enqueueing imageCache sets: %v", err)
+		return
+	}
+	bootstrap := r.LoadBootstrap()
+	for _, image := range imageList {
+		if r.nodeChangeAffects(image, bootstrap, oldNode, newNode) {
+			h(image)
+		}
+	}
+}
+
+// nodeChangeAffects reports whether the change of node matters to the Image:
+// the node became eligible or ineligible for it, or, eligible, the image
+// appeared or disappeared on it, or its labels, which may hold its zone,
+// changed. As in its reconcile, a critical Image tolerates the startup taint.
+// An Image whose scheduling constraints cannot be read is affected, so that
+// its reconcile reports the error.
+func (r Reconciler) nodeChangeAffects(i *v1alpha1.Image, bootstrap *config.Bootstrap, oldNode, newNode *v1.Node) bool {
+	revision, err := r.owningRevision(i)
+	if err != nil {
+		return true
+	}
+	scheduling, err := r.scheduling(i, revision)
+	if err != nil {
+		return true
+	}
+	tolerateStartupTaint(i, scheduling, bootstrap)
+
+	oldEligible := oldNode != nil && nodeEligible(oldNode, scheduling)
+	newEligible := newNode != nil && nodeEligible(newNode, scheduling)
+	if oldEligible != newEligible {
+		return true
+	}
+	if !newEligible {
+		return false
+	}
+	return NodeHasImage(oldNode, i.Spec.Image) != NodeHasImage(newNode, i.Spec.Image) ||
+		!equality.Semantic.DeepEqual(oldNode.Labels, newNode.Labels)
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	cachinglisters "knative.dev/caching/pkg/client/listers/caching/v1alpha1"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/kmeta"
+	logtesting "knative.dev/pkg/logging/testing"
+	servinglisters "knative.dev/serving/pkg/client/listers/serving/v1"
+
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/config"
+)
+
+func TestNodeChangeAffects(t *testing.T) {
+	r := Reconciler{RevisionLister: servinglisters.NewRevisionLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))}
+	i := &v1alpha1.Image{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "helloworld"},
+		Spec:       v1alpha1.ImageSpec{Image: "helloworld:v1"},
+	}
+	node := func(pool string, cordoned bool, images ...string) *corev1.Node {
+		n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"pool": pool}}}
+		n.Spec.Unschedulable = cordoned
+		for _, image := range images {
+			n.Status.Images = append(n.Status.Images, corev1.ContainerImage{Names: []string{image}})
+		}
+		return n
+	}
+
+	tests := []struct {
+		name     string
+		old, new *corev1.Node
+		want     bool
+	}{{
+		name: "added eligible",
+		new:  node("a", false),
+		want: true,
+	}, {
+		name: "added ineligible",
+		new:  node("a", true),
+	}, {
+		name: "deleted eligible",
+		old:  node("a", false),
+		want: true,
+	}, {
+		name: "cordoned",
+		old:  node("a", false),
+		new:  node("a", true),
+		want: true,
+	}, {
+		name: "image appeared",
+		old:  node("a", false),
+		new:  node("a", false, "docker.io/library/helloworld:v1"),
+		want: true,
+	}, {
+		name: "other image appeared",
+		old:  node("a", false),
+		new:  node("a", false, "docker.io/library/sleep:v1"),
+	}, {
+		name: "image appeared on an ineligible node",
+		old:  node("a", true),
+		new:  node("a", true, "docker.io/library/helloworld:v1"),
+	}, {
+		name: "labels changed",
+		old:  node("a", false),
+		new:  node("b", false),
+		want: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := r.nodeChangeAffects(i, config.FromContextOrDefaults(context.Background()).Bootstrap, test.old, test.new); got != test.want {
+				t.Errorf("nodeChangeAffects() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAddNodeWithStartupTaint(t *testing.T) {
+	images := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	images.Add(&v1alpha1.Image{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "critical", Labels: map[string]string{"caching.knative.dev/critical": "true"}},
+		Spec:       v1alpha1.ImageSpec{Image: "docker.io/library/critical:v1"},
+	})
+	images.Add(&v1alpha1.Image{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "helloworld"},
+		Spec:       v1alpha1.ImageSpec{Image: "docker.io/library/helloworld:v1"},
+	})
+	bootstrap := config.FromContextOrDefaults(context.Background()).Bootstrap
+	bootstrap.StartupTaint = "caching.knative.dev/startup"
+	r := Reconciler{
+		ImageCacheLister: cachinglisters.NewImageLister(images),
+		RevisionLister:   servinglisters.NewRevisionLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+		LoadBootstrap:    func() *config.Bootstrap { return bootstrap },
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Spec: corev1.NodeSpec{Taints: []corev1.Taint{{
+			Key:    bootstrap.StartupTaint,
+			Effect: corev1.TaintEffectNoSchedule,
+		}}},
+	}
+
+	var enqueued []string
+	r.AddNode(logtesting.TestContextWithLogger(t), func(obj interface{}) {
+		enqueued = append(enqueued, obj.(*v1alpha1.Image).Name)
+	})(node)
+	if len(enqueued) != 1 || enqueued[0] != "critical" {
+		t.Errorf("enqueued %v, want [critical]", enqueued)
+	}
+}
+
+func TestImageWarmIndexers(t *testing.T) {
+	i := &v1alpha1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "helloworld"}}
+	owned := &cachingv1alpha1.ImageWarm{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "helloworld-node-1",
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(i)},
+		},
+		Spec: cachingv1alpha1.ImageWarmSpec{NodeName: "node-1"},
+	}
+	orphan := &cachingv1alpha1.ImageWarm{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "orphan"},
+		Spec:       cachingv1alpha1.ImageWarmSpec{NodeName: "node-1"},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, ImageWarmIndexers)
+	indexer.Add(owned)
+	indexer.Add(orphan)
+	r := Reconciler{ImageWarmIndexer: indexer}
+
+	if got, err := r.imageWarmsOf(i); err != nil || len(got) != 1 || got[0].Name != owned.Name {
+		t.Errorf("imageWarmsOf() = %v, %v, want %s", got, err, owned.Name)
+	}
+	if got, err := r.imageWarmsOn("node-1"); err != nil || len(got) != 2 {
+		t.Errorf("imageWarmsOn() = %v, %v, want both ImageWarms", got, err)
+	}
+	if got, err := r.imageWarmsOn("node-2"); err != nil || len(got) != 0 {
+		t.Errorf("imageWarmsOn() = %v, %v, want none", got, err)
+	}
+}
+
+type nopReconciler struct{}
+
+func (nopReconciler) Reconcile(context.Context, string) error { return nil }
+
+func TestImageWarmHandlerEnqueuesOwnerOfDeleted(t *testing.T) {
+	i := &v1alpha1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "helloworld"}}
+	warm := &cachingv1alpha1.ImageWarm{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "helloworld-node-1",
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(i)},
+		},
+	}
+	orphan := &cachingv1alpha1.ImageWarm{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "orphan"}}
+
+	for name, obj := range map[string]interface{}{
+		"deleted":   warm,
+		"tombstone": cache.DeletedFinalStateUnknown{Key: "default/helloworld-node-1", Obj: warm},
+	} {
+		t.Run(name, func(t *testing.T) {
+			impl := controller.NewImpl(nopReconciler{}, logtesting.TestLogger(t), "test")
+			handler := ImageWarmHandler(impl.EnqueueControllerOf)
+			handler.OnDelete(orphan)
+			handler.OnDelete(obj)
+
+			if got := impl.WorkQueue().Len(); got != 1 {
+				t.Fatalf("enqueued %d keys, want 1", got)
+			}
+			key, _ := impl.WorkQueue().Get()
+			if want := (types.NamespacedName{Namespace: "default", Name: "helloworld"}); key != want {
+				t.Errorf("enqueued %v, want %v", key, want)
+			}
+		})
+	}
+}
+
+func TestInventoryHandler(t *testing.T) {
+	images := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, name := range []string{"helloworld", "sleep"} {
+		images.Add(&v1alpha1.Image{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       v1alpha1.ImageSpec{Image: "docker.io/library/" + name + ":v1"},
+		})
+	}
+	r := Reconciler{ImageCacheLister: cachinglisters.NewImageLister(images)}
+	inventory := &cachingv1alpha1.NodeImageInventory{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: cachingv1alpha1.NodeImageInventoryStatus{Images: []cachingv1alpha1.InventoryImage{{
+			ID: "sha256:1", RepoTags: []string{"docker.io/library/helloworld:v1"},
+		}}},
+	}
+
+	tests := []struct {
+		name   string
+		handle func(cache.ResourceEventHandler)
+	}{{
+		name:   "published",
+		handle: func(h cache.ResourceEventHandler) { h.OnAdd(inventory) },
+	}, {
+		name:   "deleted",
+		handle: func(h cache.ResourceEventHandler) { h.OnDelete(inventory) },
+	}, {
+		name: "tombstone",
+		handle: func(h cache.ResourceEventHandler) {
+			h.OnDelete(cache.DeletedFinalStateUnknown{Key: "node-1", Obj: inventory})
+		},
+	}, {
+		name: "image appeared",
+		handle: func(h cache.ResourceEventHandler) {
+			h.OnUpdate(&cachingv1alpha1.NodeImageInventory{ObjectMeta: inventory.ObjectMeta}, inventory)
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var enqueued []string
+			test.handle(r.InventoryHandler(logtesting.TestContextWithLogger(t), func(obj interface{}) {
+				enqueued = append(enqueued, obj.(*v1alpha1.Image).Name)
+			}))
+			if len(enqueued) != 1 || enqueued[0] != "helloworld" {
+				t.Errorf("enqueued %v, want [helloworld]", enqueued)
+			}
+		})
+	}
+}
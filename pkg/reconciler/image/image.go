@@ -4,30 +4,71 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
+	"go.opencensus.io/trace"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	corev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"knative.dev/caching/pkg/apis/caching/v1alpha1"
 	imagecachereconciler "knative.dev/caching/pkg/client/injection/reconciler/caching/v1alpha1/image"
 	imagecachelisters "knative.dev/caching/pkg/client/listers/caching/v1alpha1"
 	"knative.dev/pkg/apis/duck"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/reconciler"
+	servinglisters "knative.dev/serving/pkg/client/listers/serving/v1"
 
+	"knative.dev/cache-imagewarm/pkg/apis/caching"
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
 	imagewarmclientset "knative.dev/cache-imagewarm/pkg/client/clientset/versioned"
 	imagewarmlisters "knative.dev/cache-imagewarm/pkg/client/listers/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/config"
 	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+	"knative.dev/cache-imagewarm/pkg/tracing"
 )
 
 const (
 	notReconciledReason  = "ReconcileImageCacheFailed"
 	notReconciledMessage = "ImageCache reconciliation failed"
+
+	// EligibleNodesAnnotation is the Image status annotation counting the nodes
+	// the image should be cached on.
+	EligibleNodesAnnotation = caching.GroupName + "/eligibleNodes"
+	// PresentNodesAnnotation is the Image status annotation counting the
+	// eligible nodes whose inventory holds the image.
+	PresentNodesAnnotation = caching.GroupName + "/presentNodes"
+	// WarmedNodesAnnotation is the Image status annotation counting the
+	// eligible nodes holding the image or whose ImageWarm is Ready.
+	WarmedNodesAnnotation = caching.GroupName + "/warmedNodes"
+	// WarmMilestoneAnnotation is the Image status annotation holding the
+	// highest percentage of warmed nodes reported to the warm latency metric.
+	WarmMilestoneAnnotation = caching.GroupName + "/warmMilestone"
+
+	// WarmPercentAnnotation is the Image status annotation holding the mean
+	// percentage of the image warmed across its ImageWarms.
+	WarmPercentAnnotation = caching.GroupName + "/warmPercent"
+	// PullingNodesAnnotation is the Image status annotation counting the nodes
+	// reporting progress pulling the image.
+	PullingNodesAnnotation = caching.GroupName + "/pullingNodes"
+
+	// maxNodeStatusImages is the default maximum number of images kubelet
+	// reports in the node status, the largest ones first.
+	maxNodeStatusImages = 50
 )
 
+// warmMilestones are the percentages of warmed nodes whose time to reach is
+// reported, in increasing order.
+var warmMilestones = []int{50, 90, 100}
+
 // Reconciler implements controller.Reconciler for Image resources.
 type Reconciler struct {
 
@@ -35,7 +76,32 @@ type Reconciler struct {
 	ImageWarmerLister imagewarmlisters.ImageWarmLister
 	ImageCacheLister  imagecachelisters.ImageLister
 	NodeLister        corev1.NodeLister
-	ImageWarmClient   imagewarmclientset.Interface
+	InventoryLister   imagewarmlisters.NodeImageInventoryLister
+	RevisionLister    servinglisters.RevisionLister
+	// NodeWarmPlanLister lists the NodeWarmPlans, used instead of the
+	// ImageWarms when the node-warm-plans feature is enabled.
+	NodeWarmPlanLister imagewarmlisters.NodeWarmPlanLister
+	// ImageWarmIndexer and NodeWarmPlanIndexer back the listers above, with
+	// ImageWarmIndexers and NodeWarmPlanIndexers.
+	ImageWarmIndexer    cache.Indexer
+	NodeWarmPlanIndexer cache.Indexer
+	// PodIndexer holds the Pods, with PodIndexers, to weigh the free resources
+	// of the nodes.
+	PodIndexer      cache.Indexer
+	ImageWarmClient imagewarmclientset.Interface
+
+	// IneligibleNodes records since when the nodes are ineligible, for their
+	// grace period.
+	IneligibleNodes *IneligibleNodes
+	// WarmStarts records since when the nodes are warming the images, for the
+	// progress deadline of the rollouts.
+	WarmStarts *WarmStarts
+	// EnqueueAfter enqueues the Image again after the delay, to delete the
+	// ImageWarms of ineligible nodes once their grace period is over.
+	EnqueueAfter func(obj interface{}, after time.Duration)
+	// LoadBootstrap returns the current gating of new nodes, for the node
+	// event handlers, which run outside of a reconcile.
+	LoadBootstrap func() *config.Bootstrap
 }
 
 // Check that our Reconciler implements Interface
@@ -48,50 +114,291 @@ func (r Reconciler) ReconcileKind(ctx context.Context, i *v1alpha1.Image) reconc
 	logger := logging.FromContext(ctx)
 
 	logger.Infof("Reconcile ImageWarm %s/%s", i.Namespace, i.Name)
+	ctx, span := trace.StartSpan(ctx, tracing.SpanImageFanOut)
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("namespace", i.Namespace),
+		trace.StringAttribute("name", i.Name),
+		trace.StringAttribute("image", i.Spec.Image))
+
 	if !i.DeletionTimestamp.IsZero() {
 		logger.Infof("ImageCache %s/%s is being deleted... ...", i.Namespace, i.Name)
 		return nil
 	}
 
-	reconcileErr := r.reconcileImageWarm(ctx, i)
+	nodes, plan, reconcileErr := r.reconcileImageWarm(ctx, i)
 	if reconcileErr != nil {
 		logger.Errorw("Failed to reconcile ImageWarm: ", reconcileErr.Error())
 		i.Status.MarkReadyFalse(notReconciledReason, notReconciledMessage)
 		return reconcileErr
 	}
 
-	return r.PropagateImageCacheReadyStatus(i)
+	return r.PropagateImageCacheReadyStatus(ctx, i, nodes, plan)
 
 }
-func (r Reconciler) reconcileImageWarm(ctx context.Context, i *v1alpha1.Image) error {
+
+// reconcileImageWarm creates the ImageWarms of the image on the nodes chosen
+// among the eligible ones, as far as the rollout has reached, and deletes them
+// from the others. It returns the warm state of the chosen nodes and the rollout.
+func (r Reconciler) reconcileImageWarm(ctx context.Context, i *v1alpha1.Image) ([]nodeWarmState, rollout, error) {
 	logger := logging.FromContext(ctx)
 	nodeList, err := r.NodeLister.List(labels.Everything())
 	if err != nil {
-		return fmt.Errorf("failed to list nodes :%s/%s when reconcileImageWarm, err: %s", i.Namespace, i.Name, err.Error())
+		return nil, rollout{}, fmt.Errorf("failed to list nodes :%s/%s when reconcileImageWarm, err: %s", i.Namespace, i.Name, err.Error())
+	}
+	revision, err := r.owningRevision(i)
+	if err != nil {
+		return nil, rollout{}, fmt.Errorf("failed to get the revision of imageCache :%s/%s, err: %w", i.Namespace, i.Name, err)
+	}
+	scheduling, err := r.scheduling(i, revision)
+	if err != nil {
+		return nil, rollout{}, controller.NewPermanentError(err)
 	}
+	cfg := config.FromContextOrDefaults(ctx)
+	tolerateStartupTaint(i, scheduling, cfg.Bootstrap)
+
+	var candidates []candidate
+	var eligibleNodes []*v1.Node
+	eligibleNames := make(map[string]bool, len(nodeList))
 	for _, node := range nodeList {
+		if !nodeEligible(node, scheduling) {
+			continue
+		}
+		_, err := r.listedWarm(ctx, i, node.Name)
+		candidates = append(candidates, candidate{
+			node:    node,
+			zone:    node.Labels[cfg.Readiness.ZoneLabel],
+			present: r.imagePresent(i, node),
+			warming: err == nil,
+		})
+		eligibleNodes = append(eligibleNodes, node)
+		eligibleNames[node.Name] = true
+	}
 
-		if r.shouldPullImage(node) {
-			err := r.applyImageWarm(ctx, i, node.Name)
-			if err != nil {
-				logger.Errorf("failed to apply imageWarm for Node:%s", i.Name, err.Error())
-				return err
-			}
-			// delete imageWarm
+	target, err := targetNodes(i, revision, cfg.Placement, len(candidates))
+	if err != nil {
+		return nil, rollout{}, controller.NewPermanentError(err)
+	}
+	if target < len(candidates) {
+		free, err := r.freeResources(eligibleNodes)
+		if err != nil {
+			return nil, rollout{}, fmt.Errorf("failed to list pods when choosing nodes for imageCache :%s/%s, err: %w", i.Namespace, i.Name, err)
+		}
+		for k := range candidates {
+			candidates[k].free = free[candidates[k].node.Name]
+		}
+	}
+	chosen := selectNodes(candidates, target)
+
+	policy, err := rolloutPolicy(cfg.Rollout, i.Annotations)
+	if err != nil {
+		return nil, rollout{}, controller.NewPermanentError(err)
+	}
+
+	chosenNames := make(map[string]bool, len(chosen))
+	var nodes []nodeWarmState
+	present := 0
+	for _, c := range chosen {
+		chosenNames[c.node.Name] = true
+		state := nodeWarmState{name: c.node.Name, zone: c.zone, started: c.warming}
+		if c.present {
+			present++
+			state.warmed = true
 		} else {
-			err := r.deleteImageWarm(ctx, i, node.Name)
+			state = r.imageWarmState(ctx, i, state)
+		}
+		nodes = append(nodes, state)
+	}
+	requeue := r.markStuck(i, nodes, policy.ProgressDeadline)
+	plan := planRollout(policy, nodes)
+	for _, state := range nodes {
+		// Nothing to warm on the nodes holding the image, unless an ImageWarm
+		// already owns it, nor on those the rollout has not reached yet.
+		if !state.started && !plan.start[state.name] {
+			continue
+		}
+		if err := r.applyWarm(ctx, i, state.name); err != nil {
+			logger.Errorf("failed to apply imageWarm for Node:%s, err: %v", state.name, err)
+			return nil, rollout{}, err
+		}
+	}
+	// The ImageWarms of the nodes no longer eligible are suspended for the
+	// grace period rather than deleted, those of the eligible nodes not
+	// chosen are deleted right away. Only the nodes the Image is warmed on
+	// are visited, those of deleted nodes are left to the orphan collection.
+	warms, err := r.listedWarms(ctx, i)
+	if err != nil {
+		return nil, rollout{}, fmt.Errorf("failed to list imagewarms of imageCache :%s/%s, err: %w", i.Namespace, i.Name, err)
+	}
+	existingNames := make(map[string]bool, len(nodeList))
+	for _, node := range nodeList {
+		existingNames[node.Name] = true
+	}
+	grace := cfg.Placement.IneligibleGracePeriod
+	for _, warm := range warms {
+		nodeName := warm.Spec.NodeName
+		if chosenNames[nodeName] || !existingNames[nodeName] {
+			continue
+		}
+		if grace > 0 && !eligibleNames[nodeName] {
+			left, err := r.suspendWarm(ctx, i, nodeName, grace)
 			if err != nil {
-				logger.Errorf("failed to delete imageWarm for Node:%s", i.Name, err.Error())
-				return err
+				logger.Errorf("failed to suspend imageWarm for Node:%s, err: %v", nodeName, err)
+				return nil, rollout{}, err
 			}
+			if left > 0 && (requeue == 0 || left < requeue) {
+				requeue = left
+			}
+			continue
+		}
+		if err := r.deleteWarm(ctx, i, nodeName); err != nil {
+			logger.Errorf("failed to delete imageWarm for Node:%s, err: %v", nodeName, err)
+			return nil, rollout{}, err
 		}
 	}
-	return nil
+	if requeue > 0 && r.EnqueueAfter != nil {
+		r.EnqueueAfter(i, requeue)
+	}
+	if err := r.retireWarms(ctx, i); err != nil {
+		logger.Errorf("failed to retire the imageWarms of the unused model, err: %v", err)
+		return nil, rollout{}, err
+	}
+
+	eligible, warmed := len(nodes), countWarmed(nodes)
+	if i.Status.Annotations == nil {
+		i.Status.Annotations = make(map[string]string, 2)
+	}
+	i.Status.Annotations[EligibleNodesAnnotation] = strconv.Itoa(len(candidates))
+	i.Status.Annotations[TargetedNodesAnnotation] = strconv.Itoa(eligible)
+	i.Status.Annotations[PresentNodesAnnotation] = strconv.Itoa(present)
+	i.Status.Annotations[WarmedNodesAnnotation] = strconv.Itoa(warmed)
+	i.Status.Annotations[RolloutAnnotation] = plan.phase
+	reportNodes(ctx, i, eligible, warmed)
+	r.reportMilestones(ctx, i, eligible, warmed)
+	return nodes, plan, nil
+}
+
+// imageWarmState fills the state of the node from the ImageWarm of the image on it.
+func (r Reconciler) imageWarmState(ctx context.Context, i *v1alpha1.Image, state nodeWarmState) nodeWarmState {
+	warm, err := r.listedWarm(ctx, i, state.name)
+	if err != nil {
+		return state
+	}
+	state.warmed = warm.Status.IsReady()
+	state.failing = warm.Status.GetCondition(cachingv1alpha1.ImageWarmConditionReady).IsFalse()
+	return state
+}
+
+// reportMilestones reports the time since the creation of the Image for every
+// milestone newly reached, remembering the highest one in the status so that
+// each milestone is reported once.
+func (r Reconciler) reportMilestones(ctx context.Context, i *v1alpha1.Image, eligible, warmed int) {
+	reported, _ := strconv.Atoi(i.Status.Annotations[WarmMilestoneAnnotation])
+	milestones := reachedMilestones(eligible, warmed, reported)
+	if len(milestones) == 0 {
+		return
+	}
+	latency := time.Since(i.CreationTimestamp.Time)
+	for _, milestone := range milestones {
+		reportWarmLatency(ctx, milestone, latency)
+	}
+	i.Status.Annotations[WarmMilestoneAnnotation] = strconv.Itoa(milestones[len(milestones)-1])
+}
+
+// reachedMilestones returns the milestones above reported that warmed out of
+// eligible nodes reach.
+func reachedMilestones(eligible, warmed, reported int) []int {
+	if eligible == 0 {
+		return nil
+	}
+	var reached []int
+	for _, milestone := range warmMilestones {
+		if milestone > reported && warmed*100 >= milestone*eligible {
+			reached = append(reached, milestone)
+		}
+	}
+	return reached
+}
+
+// imagePresent reports whether the node holds the image. The images kubelet
+// reports in the node status are checked first; when that list may have been
+// truncated, the inventory published by the warmer on the node is consulted.
+func (r Reconciler) imagePresent(i *v1alpha1.Image, node *v1.Node) bool {
+	if NodeHasImage(node, i.Spec.Image) {
+		return true
+	}
+	if len(node.Status.Images) < maxNodeStatusImages {
+		return false
+	}
+	inventory, err := r.InventoryLister.Get(node.Name)
+	if err != nil {
+		return false
+	}
+	return inventory.Status.HasImage(i.Spec.Image)
 }
 
+// nodeWarm reports whether the node already holds the image, so that there
+// is no need to wait on its ImageWarm.
+func (r Reconciler) nodeWarm(i *v1alpha1.Image, nodeName string) bool {
+	node, err := r.NodeLister.Get(nodeName)
+	if err != nil {
+		return false
+	}
+	return r.imagePresent(i, node)
+}
+
+// NodeHasImage reports whether imageRef is one of the images in the node status.
+func NodeHasImage(node *v1.Node, imageRef string) bool {
+	for _, image := range node.Status.Images {
+		var inventoryImage cachingv1alpha1.InventoryImage
+		for _, name := range image.Names {
+			if strings.Contains(name, "@") {
+				inventoryImage.RepoDigests = append(inventoryImage.RepoDigests, name)
+			} else {
+				inventoryImage.RepoTags = append(inventoryImage.RepoTags, name)
+			}
+		}
+		if inventoryImage.Matches(imageRef) {
+			return true
+		}
+	}
+	return false
+}
+
+// findImageWarm returns the ImageWarm of the Image on the node, got by get,
+// named by imagewarm.Name or else, when created before, by imagewarm.LegacyName.
+func findImageWarm(get func(name string) (*cachingv1alpha1.ImageWarm, error), i *v1alpha1.Image, nodeName string) (*cachingv1alpha1.ImageWarm, error) {
+	warm, err := get(imagewarm.Name(i, nodeName))
+	if !errors.IsNotFound(err) {
+		return warm, err
+	}
+	legacy, legacyErr := get(imagewarm.LegacyName(i, nodeName))
+	switch {
+	case legacyErr == nil && metav1.IsControlledBy(legacy, i) && legacy.Spec.NodeName == nodeName:
+		return legacy, nil
+	case legacyErr != nil && !errors.IsNotFound(legacyErr):
+		return nil, legacyErr
+	}
+	return nil, err
+}
+
+// listedImageWarm returns the ImageWarm of the Image on the node from the lister.
+func (r Reconciler) listedImageWarm(i *v1alpha1.Image, nodeName string) (*cachingv1alpha1.ImageWarm, error) {
+	return findImageWarm(r.ImageWarmerLister.ImageWarms(i.Namespace).Get, i, nodeName)
+}
+
+// getImageWarm returns the ImageWarm of the Image on the node from the API
+// server, for when the lister is behind.
+func (r Reconciler) getImageWarm(ctx context.Context, i *v1alpha1.Image, nodeName string) (*cachingv1alpha1.ImageWarm, error) {
+	return findImageWarm(func(name string) (*cachingv1alpha1.ImageWarm, error) {
+		return r.ImageWarmClient.CachingV1alpha1().ImageWarms(i.Namespace).Get(ctx, name, metav1.GetOptions{})
+	}, i, nodeName)
+}
+
+// deleteImageWarm deletes the ImageWarm of the Image on the node, when the
+// lister knows of one, so that the nodes without one cost no API call.
 func (r Reconciler) deleteImageWarm(ctx context.Context, i *v1alpha1.Image, nodeName string) error {
-	imageWarmName := imagewarm.GetImageWarmByImageAndNode(i, nodeName)
-	_, err := r.ImageWarmClient.CachingV1alpha1().ImageWarms(i.Namespace).Get(ctx, imageWarmName, metav1.GetOptions{})
+	existing, err := r.listedImageWarm(i, nodeName)
 
 	if errors.IsNotFound(err) {
 		return nil
@@ -100,39 +407,59 @@ func (r Reconciler) deleteImageWarm(ctx context.Context, i *v1alpha1.Image, node
 			nodeName, i.Namespace, i.Name, err.Error())
 	}
 
-	err = r.ImageWarmClient.CachingV1alpha1().ImageWarms(i.Namespace).Delete(ctx, imageWarmName, metav1.DeleteOptions{})
-
-	if err != nil {
+	err = r.ImageWarmClient.CachingV1alpha1().ImageWarms(i.Namespace).Delete(ctx, existing.Name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
 		return fmt.Errorf("Fail to delete imagewarm of Node: %s for imageCache :%s/%s when deleteImageWarm, err: %s ",
 			nodeName, i.Namespace, i.Name, err.Error())
 	}
+	reportOperation(ctx, operationDelete)
 
 	return nil
 }
 
 func (r Reconciler) applyImageWarm(ctx context.Context, i *v1alpha1.Image, nodeName string) error {
 	logger := logging.FromContext(ctx)
+	ctx, span := trace.StartSpan(ctx, tracing.SpanImageWarmApply)
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("node", nodeName))
+	traceParent := map[string]string{tracing.TraceParentAnnotation: tracing.TraceParent(span.SpanContext())}
 
-	// imagewarm' name  <image cache name>-on-<node name>
-	imageWarmName := fmt.Sprintf("%s-on-%s", i.Name, nodeName)
-	originImagewarm, err := r.ImageWarmClient.CachingV1alpha1().ImageWarms(i.Namespace).Get(ctx, imageWarmName, metav1.GetOptions{})
+	// ImageWarms created with their legacy name are adopted, and patched. The
+	// API server is only asked when the lister is behind on a creation.
+	originImagewarm, err := r.listedImageWarm(i, nodeName)
 
 	imageWarm := imagewarm.MakeImageWarm(i, nodeName)
 
 	// create imagewarm
 	if errors.IsNotFound(err) {
-
-		_, err = r.ImageWarmClient.CachingV1alpha1().ImageWarms(i.Namespace).Create(ctx, imageWarm, metav1.CreateOptions{})
-		if err != nil {
+		created := imageWarm.DeepCopy()
+		created.Annotations = kmeta.UnionMaps(created.Annotations, traceParent)
+		_, err = r.ImageWarmClient.CachingV1alpha1().ImageWarms(i.Namespace).Create(ctx, created, metav1.CreateOptions{})
+		if err == nil {
+			reportOperation(ctx, operationCreate)
+			return nil
+		} else if !errors.IsAlreadyExists(err) {
 			return fmt.Errorf("Fail to create imagewarm for image %s on node %s ", i.Spec.Image, nodeName)
 		}
-	} else if err != nil {
+		originImagewarm, err = r.getImageWarm(ctx, i, nodeName)
+	}
+	if err != nil {
 		return fmt.Errorf("Fail to get imagewarm for imagecache %s/%s, err: %s ", i.Namespace, i.Name, err.Error())
 	}
 
 	// update imagewarm if it exists, to trigger reconciler to enqueue image again.
 	newImagewarm := originImagewarm.DeepCopy()
 	newImagewarm.Annotations = imageWarm.Annotations
+	// The warmer links its spans to the controller's span that asked for the
+	// current spec, carry it over unless the spec changes.
+	if equality.Semantic.DeepEqual(imageWarm.Spec, originImagewarm.Spec) {
+		if value, ok := originImagewarm.Annotations[tracing.TraceParentAnnotation]; ok {
+			traceParent[tracing.TraceParentAnnotation] = value
+		}
+	}
+	newImagewarm.Annotations = kmeta.UnionMaps(newImagewarm.Annotations, traceParent)
 	newImagewarm.Labels = imageWarm.Labels
 	newImagewarm.Spec = imageWarm.Spec
 
@@ -159,62 +486,87 @@ func (r Reconciler) applyImageWarm(ctx context.Context, i *v1alpha1.Image, nodeN
 	if err != nil {
 		return fmt.Errorf("Fail to patch imagewarm for image %s on node %s ", i.Spec.Image, nodeName)
 	}
+	reportOperation(ctx, operationPatch)
 	return err
 }
 
-func (r Reconciler) PropagateImageCacheReadyStatus(i *v1alpha1.Image) error {
-	imageWarmList, err := r.ImageWarmerLister.List(labels.SelectorFromSet(map[string]string{
-		imagewarm.OwnerRefName:      i.Name,
-		imagewarm.OwnerRefNameSpace: i.Namespace,
-	}))
+// PropagateImageCacheReadyStatus marks the Image Ready when enough of its
+// eligible nodes hold the image, as required by its readiness policy, and
+// Degraded when the ImageWarms of some of them are failing. It is not Ready
+// while its rollout is halted by a failing canary.
+func (r Reconciler) PropagateImageCacheReadyStatus(ctx context.Context, i *v1alpha1.Image, nodes []nodeWarmState, plan rollout) error {
+	imageWarmList, err := r.listedWarms(ctx, i)
 	if err != nil && !errors.IsNotFound(err) {
 		return fmt.Errorf("failed to list imagewarm for imageCache :%s/%s when propagate status, err: %s", i.Namespace, i.Name, err.Error())
 	}
 
-	for _, warm := range imageWarmList {
-		if !warm.Status.IsReady() {
-			i.Status.MarkReadyFalse("ResourceNotReady", fmt.Sprintf("ImageWarm %s on Node: %s Not Ready", warm.Name, warm.Spec.NodeName))
-			return nil
-		}
+	r.propagateProgress(i, imageWarmList, nodes)
+
+	policy, err := readinessPolicy(config.FromContextOrDefaults(ctx).Readiness, i.Annotations)
+	if err != nil {
+		i.Status.MarkReadyFalse("InvalidReadinessPolicy", err.Error())
+		return nil
+	}
+	markReadiness(i, evaluateReadiness(policy, nodes))
+	if plan.phase == rolloutHalted {
+		i.Status.MarkReadyFalse("CanaryFailed", plan.message)
 	}
-	i.Status.MarkReadyTrue()
 	return nil
 }
 
-func (r Reconciler) shouldPullImage(node *v1.Node) bool {
-	if node.Spec.Taints != nil || node.Spec.Unschedulable == true {
-		return false
+// propagateProgress rolls the progress of the ImageWarms up into the Image
+// status annotations: the mean percentage warmed across the ImageWarms of the
+// nodes chosen, ready ones counting as fully warmed, and the number of nodes
+// pulling the image.
+func (r Reconciler) propagateProgress(i *v1alpha1.Image, imageWarmList []*cachingv1alpha1.ImageWarm, nodes []nodeWarmState) {
+	if i.Status.Annotations == nil {
+		i.Status.Annotations = make(map[string]string, 2)
+	}
+	chosen := make(map[string]bool, len(nodes))
+	for _, state := range nodes {
+		chosen[state.name] = true
+	}
+	var percent, pulling, counted int
+	for _, warm := range imageWarmList {
+		// The ImageWarms of ineligible nodes, kept for their grace period, do not count.
+		if !chosen[warm.Spec.NodeName] {
+			continue
+		}
+		counted++
+		switch {
+		case warm.Status.IsReady() || r.nodeWarm(i, warm.Spec.NodeName):
+			percent += 100
+		case warm.Status.Progress != nil:
+			percent += int(warm.Status.Progress.Percent)
+			pulling++
+		}
 	}
-	return true
+	if counted == 0 {
+		delete(i.Status.Annotations, WarmPercentAnnotation)
+		delete(i.Status.Annotations, PullingNodesAnnotation)
+		return
+	}
+	i.Status.Annotations[WarmPercentAnnotation] = strconv.Itoa(percent / counted)
+	i.Status.Annotations[PullingNodesAnnotation] = strconv.Itoa(pulling)
 }
 
+// AddNode enqueues the Images the added node is eligible for.
 func (r Reconciler) AddNode(ctx context.Context, h func(interface{})) func(obj interface{}) {
 
 	return func(obj interface{}) {
 		logger := logging.FromContext(ctx)
 
-		newNode, ok := obj.(*v1.Node)
+		node, ok := obj.(*v1.Node)
 		if !ok {
-			logger.Errorf("unexpected type %T, expected Node")
+			logger.Errorf("unexpected type %T, expected Node", obj)
 			return
 		}
-
-		if !r.shouldPullImage(newNode) {
-			return
-		}
-
-		imageList, err := r.ImageCacheLister.List(labels.Everything())
-
-		if err != nil {
-			logger.Errorf("Error enqueueing imageCache sets: %v", err)
-			return
-		}
-		for _, cache := range imageList {
-			h(cache)
-		}
+		r.enqueueAffected(ctx, h, nil, node)
 	}
 }
 
+// UpdateNode enqueues the Images whose eligibility for the node, or presence
+// on it, changed.
 func (r Reconciler) UpdateNode(ctx context.Context, h func(interface{})) func(oldObj, newObj interface{}) {
 
 	return func(oldObj, newObj interface{}) {
@@ -222,25 +574,21 @@ func (r Reconciler) UpdateNode(ctx context.Context, h func(interface{})) func(ol
 		newNode, ok1 := newObj.(*v1.Node)
 		oldNode, ok2 := oldObj.(*v1.Node)
 		if !ok1 || !ok2 {
-			logger.Errorf("unexpected type %T, expected Node")
+			logger.Errorf("unexpected type %T, expected Node", newObj)
 			return
 		}
 
-		// Node with Taints will not pull image
-		if r.shouldPullImage(newNode) && r.shouldPullImage(oldNode) ||
-			!r.shouldPullImage(newNode) && !r.shouldPullImage(oldNode) {
+		// Taints and labels decide which images the node is eligible for, a
+		// change of them starts the grace period of the node afresh. Images
+		// appearing or disappearing on the node change what to warm.
+		schedulingChanged := newNode.Spec.Unschedulable != oldNode.Spec.Unschedulable ||
+			!equality.Semantic.DeepEqual(newNode.Labels, oldNode.Labels) ||
+			!equality.Semantic.DeepEqual(newNode.Spec.Taints, oldNode.Spec.Taints)
+		if schedulingChanged {
+			r.IneligibleNodes.Forget(newNode.Name)
+		} else if equality.Semantic.DeepEqual(newNode.Status.Images, oldNode.Status.Images) {
 			return
 		}
-
-		imageList, err := r.ImageCacheLister.List(labels.Everything())
-
-		if err != nil {
-			logger.Errorf("Error enqueueing imageCache sets: %v", err)
-			return
-		}
-
-		for _, cache := range imageList {
-			h(cache)
-		}
+		r.enqueueAffected(ctx, h, oldNode, newNode)
 	}
 }
@@ -0,0 +1,242 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/pkg/kmeta"
+
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/client/clientset/versioned/fake"
+	imagewarmlisters "knative.dev/cache-imagewarm/pkg/client/listers/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+)
+
+const digest = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+
+func nodeWithImages(names ...[]string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	for _, n := range names {
+		node.Status.Images = append(node.Status.Images, corev1.ContainerImage{Names: n})
+	}
+	return node
+}
+
+// fullNode reports the maximum number of images, none of them imageRef.
+func fullNode() *corev1.Node {
+	node := nodeWithImages()
+	for i := 0; i < maxNodeStatusImages; i++ {
+		node.Status.Images = append(node.Status.Images, corev1.ContainerImage{
+			Names: []string{fmt.Sprintf("gcr.io/knative/filler-%d:v1", i)},
+		})
+	}
+	return node
+}
+
+func TestImagePresent(t *testing.T) {
+	inventories := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	inventories.Add(&cachingv1alpha1.NodeImageInventory{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: cachingv1alpha1.NodeImageInventoryStatus{
+			Images: []cachingv1alpha1.InventoryImage{{
+				ID:       "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+				RepoTags: []string{"gcr.io/knative/helloworld:v1"},
+			}},
+		},
+	})
+	r := Reconciler{InventoryLister: imagewarmlisters.NewNodeImageInventoryLister(inventories)}
+
+	tests := []struct {
+		name  string
+		image string
+		node  *corev1.Node
+		want  bool
+	}{{
+		name:  "by tag",
+		image: "gcr.io/knative/helloworld:v1",
+		node:  nodeWithImages([]string{"gcr.io/knative/helloworld@" + digest, "gcr.io/knative/helloworld:v1"}),
+		want:  true,
+	}, {
+		name:  "by digest",
+		image: "gcr.io/knative/helloworld@" + digest,
+		node:  nodeWithImages([]string{"gcr.io/knative/helloworld@" + digest, "gcr.io/knative/helloworld:v1"}),
+		want:  true,
+	}, {
+		name:  "by digest through a mirror",
+		image: "mirror.example.com/helloworld@" + digest,
+		node:  nodeWithImages([]string{"gcr.io/knative/helloworld@" + digest}),
+		want:  true,
+	}, {
+		name:  "other tag",
+		image: "gcr.io/knative/helloworld:v2",
+		node:  nodeWithImages([]string{"gcr.io/knative/helloworld:v1"}),
+	}, {
+		name:  "complete node status is authoritative",
+		image: "gcr.io/knative/helloworld:v1",
+		node:  nodeWithImages([]string{"gcr.io/knative/other:v1"}),
+	}, {
+		name:  "truncated node status falls back to the inventory",
+		image: "gcr.io/knative/helloworld:v1",
+		node:  fullNode(),
+		want:  true,
+	}, {
+		name:  "truncated node status, not in the inventory either",
+		image: "gcr.io/knative/helloworld:v2",
+		node:  fullNode(),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			image := &v1alpha1.Image{Spec: v1alpha1.ImageSpec{Image: test.image}}
+			if got := r.imagePresent(image, test.node); got != test.want {
+				t.Errorf("imagePresent() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReachedMilestones(t *testing.T) {
+	tests := []struct {
+		name                       string
+		eligible, warmed, reported int
+		want                       []int
+	}{{
+		name: "no eligible nodes",
+	}, {
+		name:     "below the first milestone",
+		eligible: 10,
+		warmed:   4,
+	}, {
+		name:     "several milestones at once",
+		eligible: 10,
+		warmed:   9,
+		want:     []int{50, 90},
+	}, {
+		name:     "already reported",
+		eligible: 10,
+		warmed:   9,
+		reported: 90,
+	}, {
+		name:     "all nodes",
+		eligible: 3,
+		warmed:   3,
+		reported: 50,
+		want:     []int{90, 100},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := reachedMilestones(test.eligible, test.warmed, test.reported)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("reachedMilestones() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestListedImageWarmAdoptsLegacyNames(t *testing.T) {
+	i := &v1alpha1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "helloworld-cache", UID: "1"}}
+	other := &v1alpha1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "helloworld-cache", UID: "2"}}
+	legacy := func(owner *v1alpha1.Image, node string) *cachingv1alpha1.ImageWarm {
+		return &cachingv1alpha1.ImageWarm{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "default",
+				Name:            imagewarm.LegacyName(owner, node),
+				OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(owner)},
+			},
+			Spec: cachingv1alpha1.ImageWarmSpec{NodeName: node},
+		}
+	}
+	imageWarms := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	imageWarms.Add(legacy(i, "node-1"))
+	imageWarms.Add(legacy(other, "node-2"))
+	imageWarms.Add(imagewarm.MakeImageWarm(i, "node-3"))
+	r := Reconciler{ImageWarmerLister: imagewarmlisters.NewImageWarmLister(imageWarms)}
+
+	if warm, err := r.listedImageWarm(i, "node-1"); err != nil || warm.Name != "helloworld-cache-on-node-1" {
+		t.Errorf("listedImageWarm(node-1) = %v, %v, want the legacy ImageWarm", warm, err)
+	}
+	if _, err := r.listedImageWarm(i, "node-2"); !errors.IsNotFound(err) {
+		t.Errorf("listedImageWarm(node-2) = %v, want NotFound for the ImageWarm of another Image", err)
+	}
+	if warm, err := r.listedImageWarm(i, "node-3"); err != nil || warm.Name != imagewarm.Name(i, "node-3") {
+		t.Errorf("listedImageWarm(node-3) = %v, %v, want the ImageWarm", warm, err)
+	}
+}
+
+func TestImageWarmCallsFollowLister(t *testing.T) {
+	ctx := context.Background()
+	i := &v1alpha1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "helloworld-cache", UID: "1"}}
+	listed := imagewarm.MakeImageWarm(i, "node-1")
+	imageWarms := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	imageWarms.Add(listed)
+	client := fake.NewSimpleClientset(listed)
+	r := Reconciler{
+		ImageWarmerLister: imagewarmlisters.NewImageWarmLister(imageWarms),
+		ImageWarmClient:   client,
+	}
+
+	verbs := func() []string {
+		var verbs []string
+		for _, action := range client.Actions() {
+			verbs = append(verbs, action.GetVerb())
+		}
+		client.ClearActions()
+		return verbs
+	}
+
+	if err := r.deleteImageWarm(ctx, i, "node-2"); err != nil {
+		t.Fatal("deleteImageWarm(node-2) =", err)
+	}
+	if got := verbs(); len(got) != 0 {
+		t.Errorf("deleteImageWarm(node-2) called %v, want no call for a node without an ImageWarm", got)
+	}
+
+	if err := r.applyImageWarm(ctx, i, "node-1"); err != nil {
+		t.Fatal("applyImageWarm(node-1) =", err)
+	}
+	for _, verb := range verbs() {
+		if verb == "get" {
+			t.Error("applyImageWarm(node-1) got the ImageWarm the lister holds")
+		}
+	}
+
+	// The lister is behind on the ImageWarm of node-2.
+	client.Tracker().Add(imagewarm.MakeImageWarm(i, "node-2"))
+	if err := r.applyImageWarm(ctx, i, "node-2"); err != nil {
+		t.Fatal("applyImageWarm(node-2) =", err)
+	}
+	if got, want := verbs(), []string{"create", "get"}; len(got) < 2 || !reflect.DeepEqual(got[:2], want) {
+		t.Errorf("applyImageWarm(node-2) called %v, want %v first", got, want)
+	}
+
+	if err := r.deleteImageWarm(ctx, i, "node-1"); err != nil {
+		t.Fatal("deleteImageWarm(node-1) =", err)
+	}
+	if got, want := verbs(), []string{"delete"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deleteImageWarm(node-1) called %v, want %v", got, want)
+	}
+}
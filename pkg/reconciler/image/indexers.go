@@ -0,0 +1,134 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+)
+
+const (
+	// OwnerIndex indexes the ImageWarms by the namespace/name key of the
+	// Image controlling them, and the NodeWarmPlans by those of the Images
+	// owning their entries.
+	OwnerIndex = "owner"
+	// NodeIndex indexes the ImageWarms, and the Pods holding resources, by
+	// the name of their node.
+	NodeIndex = "node"
+)
+
+// ImageWarmIndexers are the indexers the Reconciler needs on the ImageWarm informer.
+var ImageWarmIndexers = cache.Indexers{
+	OwnerIndex: imageWarmOwnerIndexFunc,
+	NodeIndex:  imageWarmNodeIndexFunc,
+}
+
+// NodeWarmPlanIndexers are the indexers the Reconciler needs on the NodeWarmPlan informer.
+var NodeWarmPlanIndexers = cache.Indexers{
+	OwnerIndex: nodeWarmPlanOwnerIndexFunc,
+}
+
+// PodIndexers are the indexers the Reconciler needs on the Pod informer.
+var PodIndexers = cache.Indexers{
+	NodeIndex: podNodeIndexFunc,
+}
+
+func imageWarmOwnerIndexFunc(obj interface{}) ([]string, error) {
+	warm, ok := obj.(*cachingv1alpha1.ImageWarm)
+	if !ok {
+		return nil, nil
+	}
+	owner := metav1.GetControllerOf(warm)
+	if owner == nil || owner.Kind != "Image" || owner.APIVersion != v1alpha1.SchemeGroupVersion.String() {
+		return nil, nil
+	}
+	return []string{warm.Namespace + "/" + owner.Name}, nil
+}
+
+func imageWarmNodeIndexFunc(obj interface{}) ([]string, error) {
+	warm, ok := obj.(*cachingv1alpha1.ImageWarm)
+	if !ok || warm.Spec.NodeName == "" {
+		return nil, nil
+	}
+	return []string{warm.Spec.NodeName}, nil
+}
+
+// podNodeIndexFunc indexes the Pods scheduled on a node and not terminated,
+// whose requests the node reserves.
+func podNodeIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return nil, nil
+	}
+	return []string{pod.Spec.NodeName}, nil
+}
+
+func nodeWarmPlanOwnerIndexFunc(obj interface{}) ([]string, error) {
+	plan, ok := obj.(*cachingv1alpha1.NodeWarmPlan)
+	if !ok {
+		return nil, nil
+	}
+	owners := make([]string, 0, len(plan.Spec.Images))
+	for _, entry := range plan.Spec.Images {
+		owners = append(owners, entry.Owner)
+	}
+	return owners, nil
+}
+
+// imageWarmsOf returns the ImageWarms of the Image.
+func (r Reconciler) imageWarmsOf(i *v1alpha1.Image) ([]*cachingv1alpha1.ImageWarm, error) {
+	objs, err := r.ImageWarmIndexer.ByIndex(OwnerIndex, imagewarm.OwnerKey(i))
+	if err != nil {
+		return nil, err
+	}
+	return toImageWarms(objs), nil
+}
+
+// imageWarmsOn returns the ImageWarms of the node.
+func (r Reconciler) imageWarmsOn(nodeName string) ([]*cachingv1alpha1.ImageWarm, error) {
+	objs, err := r.ImageWarmIndexer.ByIndex(NodeIndex, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	return toImageWarms(objs), nil
+}
+
+// plansOf returns the NodeWarmPlans with an entry of owner.
+func (r Reconciler) plansOf(owner string) ([]*cachingv1alpha1.NodeWarmPlan, error) {
+	objs, err := r.NodeWarmPlanIndexer.ByIndex(OwnerIndex, owner)
+	if err != nil {
+		return nil, err
+	}
+	plans := make([]*cachingv1alpha1.NodeWarmPlan, 0, len(objs))
+	for _, obj := range objs {
+		plans = append(plans, obj.(*cachingv1alpha1.NodeWarmPlan))
+	}
+	return plans, nil
+}
+
+func toImageWarms(objs []interface{}) []*cachingv1alpha1.ImageWarm {
+	warms := make([]*cachingv1alpha1.ImageWarm, 0, len(objs))
+	for _, obj := range objs {
+		warms = append(warms, obj.(*cachingv1alpha1.ImageWarm))
+	}
+	return warms
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/logging"
+
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+)
+
+const (
+	// orphanSweepInterval is how often the ImageWarms of deleted nodes are collected.
+	orphanSweepInterval = time.Minute
+	// orphanFinalizerGracePeriod is how long an ImageWarm of a deleted node
+	// may be deleting before the finalizer, which the warmer of the node
+	// will never remove, is removed.
+	orphanFinalizerGracePeriod = 2 * time.Minute
+)
+
+// DeleteNode collects the ImageWarms of the deleted node, and enqueues the
+// Images it was eligible for.
+func (r Reconciler) DeleteNode(ctx context.Context, h func(interface{})) func(obj interface{}) {
+
+	return func(obj interface{}) {
+		logger := logging.FromContext(ctx)
+
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		node, ok := obj.(*v1.Node)
+		if !ok {
+			logger.Errorf("unexpected type %T, expected Node", obj)
+			return
+		}
+
+		r.IneligibleNodes.Forget(node.Name)
+		if err := r.CollectOrphans(ctx, node.Name); err != nil {
+			logger.Errorf("Failed to collect the ImageWarms of deleted Node %s: %v", node.Name, err)
+		}
+		r.enqueueAffected(ctx, h, node, nil)
+	}
+}
+
+// SweepOrphans collects the ImageWarms of deleted nodes, and the NodeWarmPlan
+// entries of deleted Images, periodically until ctx is done, to catch the
+// deletions the informers missed and the finalizers whose grace period is over.
+// Only the replica isLeader reports leading sweeps.
+func (r Reconciler) SweepOrphans(ctx context.Context, isLeader func() bool) {
+	logger := logging.FromContext(ctx)
+
+	go func() {
+		ticker := time.NewTicker(orphanSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !isLeader() {
+					continue
+				}
+				if err := r.CollectOrphans(ctx, ""); err != nil {
+					logger.Errorf("Failed to collect the ImageWarms of deleted Nodes: %v", err)
+				}
+				if err := r.CollectPlannedOrphans(ctx); err != nil {
+					logger.Errorf("Failed to collect the NodeWarmPlan entries of deleted Images: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// CollectOrphans deletes the ImageWarms of the nodes that no longer exist,
+// only those labeled with nodeName when set, and removes the finalizer of
+// their warmer once they have been deleting for orphanFinalizerGracePeriod.
+func (r Reconciler) CollectOrphans(ctx context.Context, nodeName string) error {
+	imageWarmList, err := r.orphanCandidates(nodeName)
+	if err != nil {
+		return fmt.Errorf("failed to list imagewarms when collecting orphans, err: %w", err)
+	}
+
+	var errs []error
+	for _, warm := range imageWarmList {
+		if _, err := r.NodeLister.Get(warm.Spec.NodeName); err == nil {
+			continue
+		} else if !errors.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		if err := r.collectOrphan(ctx, warm); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// orphanCandidates returns the ImageWarms of nodeName when set, or else
+// those of all nodes.
+func (r Reconciler) orphanCandidates(nodeName string) ([]*cachingv1alpha1.ImageWarm, error) {
+	if nodeName != "" {
+		return r.imageWarmsOn(nodeName)
+	}
+	requirement, err := labels.NewRequirement(imagewarm.NodeLabelKey, selection.Exists, nil)
+	if err != nil {
+		return nil, err
+	}
+	return r.ImageWarmerLister.List(labels.NewSelector().Add(*requirement))
+}
+
+// collectOrphan deletes the ImageWarm of a deleted node, or removes the
+// finalizer of its warmer when it has been deleting for long enough.
+func (r Reconciler) collectOrphan(ctx context.Context, warm *cachingv1alpha1.ImageWarm) error {
+	logger := logging.FromContext(ctx)
+	imageWarms := r.ImageWarmClient.CachingV1alpha1().ImageWarms(warm.Namespace)
+
+	if warm.DeletionTimestamp.IsZero() {
+		logger.Infof("Deleting imagewarm %s/%s of deleted Node %s", warm.Namespace, warm.Name, warm.Spec.NodeName)
+		if err := imageWarms.Delete(ctx, warm.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete imagewarm %s/%s, err: %w", warm.Namespace, warm.Name, err)
+		}
+		reportOperation(ctx, operationDelete)
+		return nil
+	}
+
+	index := -1
+	for i, finalizer := range warm.Finalizers {
+		if finalizer == imagewarm.FinalizerName {
+			index = i
+		}
+	}
+	if index < 0 || time.Since(warm.DeletionTimestamp.Time) < orphanFinalizerGracePeriod {
+		return nil
+	}
+	logger.Infof("Removing the finalizer %s of imagewarm %s/%s of deleted Node %s",
+		imagewarm.FinalizerName, warm.Namespace, warm.Name, warm.Spec.NodeName)
+	// The test fails the patch when the finalizers moved since the ImageWarm
+	// was cached, so that only the finalizer of the warmer is ever removed.
+	path := fmt.Sprintf("/metadata/finalizers/%d", index)
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": path, "value": imagewarm.FinalizerName},
+		{"op": "remove", "path": path},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := imageWarms.Patch(ctx, warm.Name, types.JSONPatchType, patch, metav1.PatchOptions{}); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to remove the finalizer of imagewarm %s/%s, err: %w", warm.Namespace, warm.Name, err)
+	}
+	return nil
+}
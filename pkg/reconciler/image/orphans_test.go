@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	clientgotesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/client/clientset/versioned/fake"
+	imagewarmlisters "knative.dev/cache-imagewarm/pkg/client/listers/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+)
+
+func imageWarmOn(name, node string, deleted time.Duration) *cachingv1alpha1.ImageWarm {
+	warm := &cachingv1alpha1.ImageWarm{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      name,
+		Labels:    map[string]string{imagewarm.NodeLabelKey: node},
+	}, Spec: cachingv1alpha1.ImageWarmSpec{NodeName: node}}
+	if deleted > 0 {
+		deletionTimestamp := metav1.NewTime(time.Now().Add(-deleted))
+		warm.DeletionTimestamp = &deletionTimestamp
+		warm.Finalizers = []string{"example.com/other", imagewarm.FinalizerName}
+	}
+	return warm
+}
+
+func TestCollectOrphans(t *testing.T) {
+	warms := []*cachingv1alpha1.ImageWarm{
+		imageWarmOn("live", "node-1", 0),
+		imageWarmOn("orphan", "node-2", 0),
+		imageWarmOn("stuck", "node-2", time.Hour),
+		imageWarmOn("deleting", "node-3", time.Second),
+	}
+	nodes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nodes.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+	imageWarms := cache.NewIndexer(cache.MetaNamespaceKeyFunc, ImageWarmIndexers)
+	for _, warm := range warms {
+		imageWarms.Add(warm)
+	}
+
+	tests := []struct {
+		name        string
+		node        string
+		wantDeleted []string
+		wantPatched []string
+	}{{
+		name:        "deleted node",
+		node:        "node-2",
+		wantDeleted: []string{"orphan"},
+		wantPatched: []string{"stuck"},
+	}, {
+		name:        "sweep",
+		wantDeleted: []string{"orphan"},
+		wantPatched: []string{"stuck"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			for _, warm := range warms {
+				client.Tracker().Add(warm)
+			}
+			r := Reconciler{
+				NodeLister:        corelisters.NewNodeLister(nodes),
+				ImageWarmerLister: imagewarmlisters.NewImageWarmLister(imageWarms),
+				ImageWarmIndexer:  imageWarms,
+				ImageWarmClient:   client,
+			}
+			if err := r.CollectOrphans(context.Background(), test.node); err != nil {
+				t.Fatalf("CollectOrphans() = %v", err)
+			}
+			var deleted, patched []string
+			for _, action := range client.Actions() {
+				switch action.GetVerb() {
+				case "delete":
+					deleted = append(deleted, action.(clientgotesting.DeleteAction).GetName())
+				case "patch":
+					patched = append(patched, action.(clientgotesting.PatchAction).GetName())
+				}
+			}
+			sort.Strings(deleted)
+			if diff := cmp.Diff(test.wantDeleted, deleted); diff != "" {
+				t.Errorf("deleted (-want, +got) = %s", diff)
+			}
+			if diff := cmp.Diff(test.wantPatched, patched); diff != "" {
+				t.Errorf("patched (-want, +got) = %s", diff)
+			}
+			for _, name := range patched {
+				got, err := client.CachingV1alpha1().ImageWarms("default").Get(context.Background(), name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("Get(%s) = %v", name, err)
+				}
+				if want := []string{"example.com/other"}; !cmp.Equal(got.Finalizers, want) {
+					t.Errorf("Finalizers = %v, want %v", got.Finalizers, want)
+				}
+			}
+		})
+	}
+}
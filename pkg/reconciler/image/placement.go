@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/serving/pkg/apis/autoscaling"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching"
+	"knative.dev/cache-imagewarm/pkg/config"
+)
+
+const (
+	// TargetNodesAnnotation is the Image annotation setting the number, or
+	// percentage, of the eligible nodes the image is warmed on.
+	TargetNodesAnnotation = caching.GroupName + "/targetNodes"
+
+	// TargetedNodesAnnotation is the Image status annotation counting the
+	// eligible nodes chosen to warm the image on.
+	TargetedNodesAnnotation = caching.GroupName + "/targetedNodes"
+)
+
+// candidate is an eligible node the image may be warmed on.
+type candidate struct {
+	node *corev1.Node
+	zone string
+	// present is set when the node already holds the image.
+	present bool
+	// warming is set when the node has an ImageWarm for the image.
+	warming bool
+	// free is the fraction of the allocatable resources of the node not
+	// requested by its Pods, of the scarcest resource.
+	free float64
+}
+
+// targetNodes returns how many of the eligible nodes the image is warmed on:
+// as many as the annotation of the Image asks for, else as the maxScale of
+// its Revision, else as the default policy.
+func targetNodes(i *v1alpha1.Image, revision *servingv1.Revision, defaults *config.Placement, eligible int) (int, error) {
+	if value, ok := i.Annotations[TargetNodesAnnotation]; ok {
+		threshold, err := config.ParseThreshold(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid annotation %s: %w", TargetNodesAnnotation, err)
+		}
+		return threshold.Of(eligible), nil
+	}
+	if revision != nil {
+		if value, ok := revision.Annotations[autoscaling.MaxScaleAnnotationKey]; ok {
+			// A maxScale of 0 means unbounded.
+			if maxScale, err := strconv.Atoi(value); err == nil && maxScale > 0 {
+				return config.Threshold{Count: maxScale}.Of(eligible), nil
+			}
+		}
+	}
+	return defaults.TargetNodes.Of(eligible), nil
+}
+
+// selectNodes chooses target candidates. To keep the choice stable, nodes
+// holding the image come first, then nodes already warming it, then the
+// others. Within each group, nodes are spread evenly across zones, preferring
+// the nodes with the most free resources.
+func selectNodes(candidates []candidate, target int) []candidate {
+	if target >= len(candidates) {
+		return candidates
+	}
+
+	var present, warming, others []candidate
+	for _, c := range candidates {
+		switch {
+		case c.present:
+			present = append(present, c)
+		case c.warming:
+			warming = append(warming, c)
+		default:
+			others = append(others, c)
+		}
+	}
+
+	chosen := make([]candidate, 0, target)
+	perZone := map[string]int{}
+	for _, group := range [][]candidate{present, warming, others} {
+		sort.Slice(group, func(i, j int) bool {
+			if group[i].free != group[j].free {
+				return group[i].free > group[j].free
+			}
+			return group[i].node.Name < group[j].node.Name
+		})
+		for len(group) > 0 && len(chosen) < target {
+			// Take the best node of the zone holding the fewest chosen nodes.
+			best := 0
+			for k, c := range group {
+				if perZone[c.zone] < perZone[group[best].zone] ||
+					perZone[c.zone] == perZone[group[best].zone] && c.zone < group[best].zone {
+					best = k
+				}
+			}
+			chosen = append(chosen, group[best])
+			perZone[group[best].zone]++
+			group = append(group[:best:best], group[best+1:]...)
+		}
+	}
+	return chosen
+}
+
+// freeResources returns, for every node, the fraction of its allocatable CPU
+// or memory, whichever is scarcer, not requested by the Pods running on it.
+// Only the Pods of the nodes are visited, through the node index.
+func (r Reconciler) freeResources(nodes []*corev1.Node) (map[string]float64, error) {
+	free := make(map[string]float64, len(nodes))
+	for _, node := range nodes {
+		pods, err := r.PodIndexer.ByIndex(NodeIndex, node.Name)
+		if err != nil {
+			return nil, err
+		}
+		var cpu, memory int64
+		for _, obj := range pods {
+			for _, container := range obj.(*corev1.Pod).Spec.Containers {
+				cpu += container.Resources.Requests.Cpu().MilliValue()
+				memory += container.Resources.Requests.Memory().Value()
+			}
+		}
+		freeCPU := fraction(node.Status.Allocatable.Cpu().MilliValue()-cpu, node.Status.Allocatable.Cpu().MilliValue())
+		freeMemory := fraction(node.Status.Allocatable.Memory().Value()-memory, node.Status.Allocatable.Memory().Value())
+		if freeCPU < freeMemory {
+			free[node.Name] = freeCPU
+		} else {
+			free[node.Name] = freeMemory
+		}
+	}
+	return free, nil
+}
+
+func fraction(part, total int64) float64 {
+	if total <= 0 || part <= 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/serving/pkg/apis/autoscaling"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+
+	"knative.dev/cache-imagewarm/pkg/config"
+)
+
+func newCandidate(name, zone string, free float64) candidate {
+	return candidate{node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}, zone: zone, free: free}
+}
+
+func names(candidates []candidate) []string {
+	var names []string
+	for _, c := range candidates {
+		names = append(names, c.node.Name)
+	}
+	return names
+}
+
+func TestSelectNodes(t *testing.T) {
+	a1, a2, a3 := newCandidate("a1", "a", 0.9), newCandidate("a2", "a", 0.8), newCandidate("a3", "a", 0.1)
+	b1, b2 := newCandidate("b1", "b", 0.2), newCandidate("b2", "b", 0.5)
+	present, warming := a3, b1
+	present.present = true
+	warming.warming = true
+
+	tests := []struct {
+		name       string
+		candidates []candidate
+		target     int
+		want       []string
+	}{{
+		name:       "all nodes",
+		candidates: []candidate{a1, a2, a3, b1, b2},
+		target:     5,
+		want:       []string{"a1", "a2", "a3", "b1", "b2"},
+	}, {
+		name:       "spread across zones",
+		candidates: []candidate{a1, a2, a3, b1, b2},
+		target:     2,
+		want:       []string{"a1", "b2"},
+	}, {
+		name:       "free resources within a zone",
+		candidates: []candidate{a1, a2, a3, b1, b2},
+		target:     4,
+		want:       []string{"a1", "b2", "a2", "b1"},
+	}, {
+		name:       "nodes holding or warming the image first",
+		candidates: []candidate{a1, a2, present, warming, b2},
+		target:     3,
+		want:       []string{"a3", "b1", "a1"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, names(selectNodes(test.candidates, test.target))); diff != "" {
+				t.Errorf("selectNodes() (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestTargetNodes(t *testing.T) {
+	revision := &servingv1.Revision{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{autoscaling.MaxScaleAnnotationKey: "3"},
+	}}
+	unbounded := &servingv1.Revision{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{autoscaling.MaxScaleAnnotationKey: "0"},
+	}}
+	defaults := &config.Placement{TargetNodes: config.Threshold{Percent: 50, IsPercent: true}}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		revision    *servingv1.Revision
+		want        int
+		wantErr     bool
+	}{{
+		name: "default",
+		want: 5,
+	}, {
+		name:     "maxScale",
+		revision: revision,
+		want:     3,
+	}, {
+		name:     "unbounded maxScale",
+		revision: unbounded,
+		want:     5,
+	}, {
+		name:        "annotation",
+		annotations: map[string]string{TargetNodesAnnotation: "20%"},
+		revision:    revision,
+		want:        2,
+	}, {
+		name:        "invalid annotation",
+		annotations: map[string]string{TargetNodesAnnotation: "many"},
+		wantErr:     true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			i := &v1alpha1.Image{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+			got, err := targetNodes(i, test.revision, defaults, 10)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("targetNodes() = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("targetNodes() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFreeResources(t *testing.T) {
+	node := func(name string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("8Gi"),
+			}},
+		}
+	}
+	pod := func(name, nodeName, cpu, memory string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec: corev1.PodSpec{
+				NodeName: nodeName,
+				Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse(cpu),
+					corev1.ResourceMemory: resource.MustParse(memory),
+				}}}},
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+	pods := cache.NewIndexer(cache.MetaNamespaceKeyFunc, PodIndexers)
+	for _, p := range []*corev1.Pod{
+		pod("cpu-bound", "node-1", "3", "1Gi", corev1.PodRunning),
+		pod("memory-bound", "node-2", "1", "6Gi", corev1.PodRunning),
+		pod("done", "node-2", "3", "1Gi", corev1.PodSucceeded),
+		pod("pending", "", "4", "8Gi", corev1.PodPending),
+		pod("elsewhere", "node-4", "4", "8Gi", corev1.PodRunning),
+	} {
+		pods.Add(p)
+	}
+	r := Reconciler{PodIndexer: pods}
+
+	got, err := r.freeResources([]*corev1.Node{node("node-1"), node("node-2"), node("node-3")})
+	if err != nil {
+		t.Fatal("freeResources() =", err)
+	}
+	want := map[string]float64{"node-1": 0.25, "node-2": 0.25, "node-3": 1}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("freeResources() (-want, +got) = %s", diff)
+	}
+}
@@ -0,0 +1,361 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"go.opencensus.io/trace"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/pkg/logging"
+
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+	"knative.dev/cache-imagewarm/pkg/tracing"
+)
+
+// usePlans reports whether the images are warmed through NodeWarmPlans
+// rather than ImageWarms.
+func usePlans(ctx context.Context) bool {
+	return config.FromContextOrDefaults(ctx).Features.NodeWarmPlans == config.Enabled
+}
+
+// listedWarm returns the ImageWarm of the Image on the node, or the ImageWarm
+// standing for its entry in the NodeWarmPlan of the node when plans are used.
+func (r Reconciler) listedWarm(ctx context.Context, i *v1alpha1.Image, nodeName string) (*cachingv1alpha1.ImageWarm, error) {
+	if usePlans(ctx) {
+		return r.listedPlannedImage(i, nodeName)
+	}
+	return r.listedImageWarm(i, nodeName)
+}
+
+// listedWarms returns the ImageWarms of the Image, or the ImageWarms standing
+// for its entries in the NodeWarmPlans when plans are used.
+func (r Reconciler) listedWarms(ctx context.Context, i *v1alpha1.Image) ([]*cachingv1alpha1.ImageWarm, error) {
+	if !usePlans(ctx) {
+		return r.imageWarmsOf(i)
+	}
+	plans, err := r.plansOf(imagewarm.OwnerKey(i))
+	if err != nil {
+		return nil, err
+	}
+	var warms []*cachingv1alpha1.ImageWarm
+	for _, plan := range plans {
+		entry := plan.Spec.Entry(imagewarm.OwnerKey(i))
+		// The entries out of their shard are collected as orphans.
+		if entry == nil || plan.Name != imagewarm.PlanName(plan.Spec.NodeName, entry.Owner) {
+			continue
+		}
+		warm, err := imagewarm.FromPlannedImage(plan, entry)
+		if err != nil {
+			return nil, err
+		}
+		warms = append(warms, warm)
+	}
+	return warms, nil
+}
+
+// applyWarm warms the image of the Image on the node.
+func (r Reconciler) applyWarm(ctx context.Context, i *v1alpha1.Image, nodeName string) error {
+	if usePlans(ctx) {
+		return r.applyPlannedImage(ctx, i, nodeName)
+	}
+	return r.applyImageWarm(ctx, i, nodeName)
+}
+
+// deleteWarm stops warming the image of the Image on the node.
+func (r Reconciler) deleteWarm(ctx context.Context, i *v1alpha1.Image, nodeName string) error {
+	if usePlans(ctx) {
+		return r.deletePlannedImage(ctx, i, nodeName)
+	}
+	return r.deleteImageWarm(ctx, i, nodeName)
+}
+
+// retireWarms removes what warms the image of the Image in the model not in
+// use, the ImageWarms of the Image or its entries in the NodeWarmPlans, once
+// the feature flag switched models.
+func (r Reconciler) retireWarms(ctx context.Context, i *v1alpha1.Image) error {
+	if !usePlans(ctx) {
+		return r.removePlannedImages(ctx, imagewarm.OwnerKey(i))
+	}
+	imageWarmList, err := r.imageWarmsOf(i)
+	if err != nil {
+		return fmt.Errorf("failed to list imagewarms of imageCache :%s/%s, err: %w", i.Namespace, i.Name, err)
+	}
+	for _, warm := range imageWarmList {
+		if err := r.deleteImageWarm(ctx, i, warm.Spec.NodeName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listedPlannedImage returns the ImageWarm standing for the entry of the Image
+// in the NodeWarmPlans of the node, from the lister.
+func (r Reconciler) listedPlannedImage(i *v1alpha1.Image, nodeName string) (*cachingv1alpha1.ImageWarm, error) {
+	name := imagewarm.PlanName(nodeName, imagewarm.OwnerKey(i))
+	plan, err := r.NodeWarmPlanLister.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	entry := plan.Spec.Entry(imagewarm.OwnerKey(i))
+	if entry == nil {
+		return nil, errors.NewNotFound(cachingv1alpha1.Resource("nodewarmplans"), name)
+	}
+	return imagewarm.FromPlannedImage(plan, entry)
+}
+
+// applyPlannedImage adds the entry of the Image to its NodeWarmPlan of the
+// node, creating the plan when missing, or updates the entry.
+func (r Reconciler) applyPlannedImage(ctx context.Context, i *v1alpha1.Image, nodeName string) error {
+	ctx, span := trace.StartSpan(ctx, tracing.SpanImageWarmApply)
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("node", nodeName))
+
+	want := imagewarm.MakePlannedImage(i)
+	name := imagewarm.PlanName(nodeName, want.Owner)
+	if plan, err := r.NodeWarmPlanLister.Get(name); err == nil {
+		if entry := plan.Spec.Entry(want.Owner); entry != nil && equality.Semantic.DeepEqual(*entry, want) &&
+			imagewarm.PlannedImageSelector(want.Image).Matches(labels.Set(plan.Labels)) {
+			return nil
+		}
+	}
+
+	err := r.updatePlan(ctx, nodeName, name, true, func(plan *cachingv1alpha1.NodeWarmPlan) bool {
+		entry := plan.Spec.Entry(want.Owner)
+		switch {
+		case entry == nil:
+			plan.Spec.Images = append(plan.Spec.Images, want)
+		case equality.Semantic.DeepEqual(*entry, want):
+			return false
+		default:
+			*entry = want
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to plan image %s on node %s for imageCache :%s/%s, err: %w",
+			i.Spec.Image, nodeName, i.Namespace, i.Name, err)
+	}
+	return nil
+}
+
+// deletePlannedImage removes the entry of the Image from its NodeWarmPlan of the node.
+func (r Reconciler) deletePlannedImage(ctx context.Context, i *v1alpha1.Image, nodeName string) error {
+	if _, err := r.listedPlannedImage(i, nodeName); errors.IsNotFound(err) {
+		return nil
+	}
+	owner := imagewarm.OwnerKey(i)
+	if err := r.removePlannedImage(ctx, nodeName, imagewarm.PlanName(nodeName, owner), owner); err != nil {
+		return fmt.Errorf("failed to remove image %s from the plan of node %s for imageCache :%s/%s, err: %w",
+			i.Spec.Image, nodeName, i.Namespace, i.Name, err)
+	}
+	return nil
+}
+
+// removePlannedImages removes the entries of owner from all NodeWarmPlans.
+func (r Reconciler) removePlannedImages(ctx context.Context, owner string) error {
+	plans, err := r.plansOf(owner)
+	if err != nil {
+		return fmt.Errorf("failed to list nodewarmplans, err: %w", err)
+	}
+	var errs []error
+	for _, plan := range plans {
+		if err := r.removePlannedImage(ctx, plan.Spec.NodeName, plan.Name, owner); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove the image of %s from the plan %s, err: %w", owner, plan.Name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// removePlannedImage removes the entries of owners from the NodeWarmPlan of
+// the node named name.
+func (r Reconciler) removePlannedImage(ctx context.Context, nodeName, name string, owners ...string) error {
+	removed := sets.NewString(owners...)
+	return r.updatePlan(ctx, nodeName, name, false, func(plan *cachingv1alpha1.NodeWarmPlan) bool {
+		images := plan.Spec.Images[:0]
+		for _, entry := range plan.Spec.Images {
+			if !removed.Has(entry.Owner) {
+				images = append(images, entry)
+			}
+		}
+		if len(images) == len(plan.Spec.Images) {
+			return false
+		}
+		plan.Spec.Images = images
+		return true
+	})
+}
+
+// updatePlan applies mutate to the NodeWarmPlan of the node named name, and
+// updates the plan when mutate changed it or its labels do not match its
+// entries. The plan is read from the lister, and from the API server when
+// retrying on conflicts with the updates for the other Images. A missing plan
+// is created when create is set, and left missing otherwise. When create is
+// set, the plan is not let grow past MaxPlanSpecSize.
+func (r Reconciler) updatePlan(ctx context.Context, nodeName, name string, create bool, mutate func(*cachingv1alpha1.NodeWarmPlan) bool) error {
+	plans := r.ImageWarmClient.CachingV1alpha1().NodeWarmPlans()
+	listed := true
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var plan *cachingv1alpha1.NodeWarmPlan
+		var err error
+		if listed {
+			listed = false
+			if plan, err = r.NodeWarmPlanLister.Get(name); err == nil {
+				plan = plan.DeepCopy()
+			}
+		} else {
+			plan, err = plans.Get(ctx, name, metav1.GetOptions{})
+		}
+		if errors.IsNotFound(err) {
+			if !create {
+				return nil
+			}
+			node, err := r.NodeLister.Get(nodeName)
+			if err != nil {
+				return err
+			}
+			plan = imagewarm.MakeNodeWarmPlan(node, name)
+			if !mutate(plan) {
+				return nil
+			}
+			imagewarm.LabelPlannedImages(plan)
+			if err := imagewarm.CheckPlanSize(plan); err != nil {
+				return err
+			}
+			if _, err := plans.Create(ctx, plan, metav1.CreateOptions{}); err != nil {
+				// Created meanwhile for another Image, or missing from the
+				// lister only, retry as a conflict.
+				if errors.IsAlreadyExists(err) {
+					return errors.NewConflict(cachingv1alpha1.Resource("nodewarmplans"), name, err)
+				}
+				return err
+			}
+			reportOperation(ctx, operationCreate)
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if mutated := mutate(plan); !imagewarm.LabelPlannedImages(plan) && !mutated {
+			return nil
+		}
+		if create {
+			if err := imagewarm.CheckPlanSize(plan); err != nil {
+				return err
+			}
+		}
+		if _, err := plans.Update(ctx, plan, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		reportOperation(ctx, operationPatch)
+		return nil
+	})
+}
+
+// DeleteImage removes the entries of the deleted Image from the NodeWarmPlans.
+func (r Reconciler) DeleteImage(ctx context.Context) func(obj interface{}) {
+	return func(obj interface{}) {
+		logger := logging.FromContext(ctx)
+
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		i, ok := obj.(*v1alpha1.Image)
+		if !ok {
+			logger.Errorf("unexpected type %T, expected Image", obj)
+			return
+		}
+		r.WarmStarts.Forget(imagewarm.OwnerKey(i), "")
+		if err := r.removePlannedImages(ctx, imagewarm.OwnerKey(i)); err != nil {
+			logger.Errorf("Failed to remove the image of deleted Image %s/%s from the NodeWarmPlans: %v", i.Namespace, i.Name, err)
+		}
+	}
+}
+
+// CollectPlannedOrphans removes the entries of the Images that no longer
+// exist from the NodeWarmPlans, and those out of their shard, left over from
+// the NodeWarmPlans named after their node alone.
+func (r Reconciler) CollectPlannedOrphans(ctx context.Context) error {
+	plans, err := r.NodeWarmPlanLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list nodewarmplans when collecting orphans, err: %w", err)
+	}
+
+	var errs []error
+	for _, plan := range plans {
+		var orphans []string
+		for _, entry := range plan.Spec.Images {
+			namespace, name, err := cache.SplitMetaNamespaceKey(entry.Owner)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			// The entries out of their shard are removed, the Image plans
+			// them in it.
+			if plan.Name == imagewarm.PlanName(plan.Spec.NodeName, entry.Owner) {
+				if _, err := r.ImageCacheLister.Images(namespace).Get(name); err == nil {
+					continue
+				} else if !errors.IsNotFound(err) {
+					errs = append(errs, err)
+					continue
+				}
+			}
+			orphans = append(orphans, entry.Owner)
+		}
+		if len(orphans) == 0 {
+			continue
+		}
+		if err := r.removePlannedImage(ctx, plan.Spec.NodeName, plan.Name, orphans...); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove the images of %v from the plan %s, err: %w", orphans, plan.Name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// EnqueuePlannedImages enqueues the owners of the entries of the NodeWarmPlan,
+// whose status may have changed, or whose placement is recomputed once the
+// plan is deleted, e.g. with its Node.
+func EnqueuePlannedImages(h func(types.NamespacedName)) func(obj interface{}) {
+	return func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		plan, ok := obj.(*cachingv1alpha1.NodeWarmPlan)
+		if !ok {
+			return
+		}
+		for _, entry := range plan.Spec.Images {
+			namespace, name, err := cache.SplitMetaNamespaceKey(entry.Owner)
+			if err != nil {
+				continue
+			}
+			h(types.NamespacedName{Namespace: namespace, Name: name})
+		}
+	}
+}
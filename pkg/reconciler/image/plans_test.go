@@ -0,0 +1,302 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	imagecachelisters "knative.dev/caching/pkg/client/listers/caching/v1alpha1"
+
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/client/clientset/versioned/fake"
+	imagewarmlisters "knative.dev/cache-imagewarm/pkg/client/listers/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+)
+
+func imageCache(name, image string) *v1alpha1.Image {
+	return &v1alpha1.Image{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec:       v1alpha1.ImageSpec{Image: image},
+	}
+}
+
+// plannedOwners returns the owners of the entries of the NodeWarmPlans of the node.
+func plannedOwners(t *testing.T, client *fake.Clientset, nodeName string) []string {
+	t.Helper()
+	plans, err := client.CachingV1alpha1().NodeWarmPlans().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	var owners []string
+	for _, plan := range plans.Items {
+		if plan.Spec.NodeName != nodeName {
+			continue
+		}
+		for _, entry := range plan.Spec.Images {
+			owners = append(owners, entry.Owner+"="+entry.Image)
+		}
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// listPlans adds the NodeWarmPlans of the client to the indexer of the lister.
+func listPlans(t *testing.T, client *fake.Clientset, plans cache.Indexer) {
+	t.Helper()
+	list, err := client.CachingV1alpha1().NodeWarmPlans().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	for k := range list.Items {
+		plans.Update(&list.Items[k])
+	}
+}
+
+func TestPlannedImages(t *testing.T) {
+	ctx := context.Background()
+	nodes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nodes.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+	plans := cache.NewIndexer(cache.MetaNamespaceKeyFunc, NodeWarmPlanIndexers)
+	client := fake.NewSimpleClientset()
+	r := Reconciler{
+		NodeLister:          corelisters.NewNodeLister(nodes),
+		NodeWarmPlanLister:  imagewarmlisters.NewNodeWarmPlanLister(plans),
+		NodeWarmPlanIndexer: plans,
+		ImageWarmClient:     client,
+	}
+
+	helloworld, sleep := imageCache("helloworld", "helloworld:v1"), imageCache("sleep", "sleep:v1")
+	if err := r.applyPlannedImage(ctx, helloworld, "node-1"); err != nil {
+		t.Fatalf("applyPlannedImage() = %v", err)
+	}
+	name := imagewarm.PlanName("node-1", "default/helloworld")
+	plan, err := client.CachingV1alpha1().NodeWarmPlans().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get(%s) = %v", name, err)
+	}
+	if !metav1.IsControlledBy(plan, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}) || plan.Spec.NodeName != "node-1" ||
+		plan.Labels[imagewarm.NodeLabelKey] != "node-1" {
+		t.Errorf("NodeWarmPlan = %v, want the plan of node-1 owned by and labeled with it", plan)
+	}
+	if err := r.applyPlannedImage(ctx, sleep, "node-1"); err != nil {
+		t.Fatalf("applyPlannedImage() = %v", err)
+	}
+	helloworld.Spec.Image = "helloworld:v2"
+	if err := r.applyPlannedImage(ctx, helloworld, "node-1"); err != nil {
+		t.Fatalf("applyPlannedImage() = %v", err)
+	}
+	want := []string{"default/helloworld=helloworld:v2", "default/sleep=sleep:v1"}
+	if diff := cmp.Diff(want, plannedOwners(t, client, "node-1")); diff != "" {
+		t.Errorf("planned images (-want, +got) = %s", diff)
+	}
+
+	listPlans(t, client, plans)
+	if _, err := r.listedPlannedImage(sleep, "node-1"); err != nil {
+		t.Errorf("listedPlannedImage() = %v, want the entry of sleep", err)
+	}
+	if err := r.deletePlannedImage(ctx, sleep, "node-1"); err != nil {
+		t.Fatalf("deletePlannedImage() = %v", err)
+	}
+	want = []string{"default/helloworld=helloworld:v2"}
+	if diff := cmp.Diff(want, plannedOwners(t, client, "node-1")); diff != "" {
+		t.Errorf("planned images (-want, +got) = %s", diff)
+	}
+}
+
+func TestPlannedImagesAtScale(t *testing.T) {
+	const images = 2000
+	ctx := context.Background()
+	nodes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nodes.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+	plans := cache.NewIndexer(cache.MetaNamespaceKeyFunc, NodeWarmPlanIndexers)
+	client := fake.NewSimpleClientset()
+	r := Reconciler{
+		NodeLister:          corelisters.NewNodeLister(nodes),
+		NodeWarmPlanLister:  imagewarmlisters.NewNodeWarmPlanLister(plans),
+		NodeWarmPlanIndexer: plans,
+		ImageWarmClient:     client,
+	}
+
+	for k := 0; k < images; k++ {
+		i := imageCache(fmt.Sprintf("revision-%04d-deployment-cache", k),
+			fmt.Sprintf("registry.example.com/team-%04d/service@sha256:%064x", k, k))
+		if err := r.applyPlannedImage(ctx, i, "node-1"); err != nil {
+			t.Fatalf("applyPlannedImage(%d) = %v", k, err)
+		}
+		// The informer catches up with the plans.
+		listPlans(t, client, plans)
+	}
+
+	list, err := client.CachingV1alpha1().NodeWarmPlans().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	if got, want := len(list.Items), imagewarm.PlanShards; got != want {
+		t.Errorf("NodeWarmPlans = %d, want %d shards", got, want)
+	}
+	planned := 0
+	for _, plan := range list.Items {
+		planned += len(plan.Spec.Images)
+		// The warmer reports a status as large for every entry.
+		for _, entry := range plan.Spec.Images {
+			plan.Status.Images = append(plan.Status.Images, cachingv1alpha1.PlannedImageStatus{
+				Owner:        entry.Owner,
+				Image:        entry.Image,
+				Ready:        corev1.ConditionTrue,
+				Endpoint:     "https://mirror.registry.example.com",
+				PeerEndpoint: "10.200.100.100:5001",
+			})
+		}
+		b, err := json.Marshal(plan)
+		if err != nil {
+			t.Fatalf("Marshal() = %v", err)
+		}
+		if len(b) > 2*imagewarm.MaxPlanSpecSize {
+			t.Errorf("NodeWarmPlan %s takes %d bytes, want at most %d", plan.Name, len(b), 2*imagewarm.MaxPlanSpecSize)
+		}
+	}
+	if planned != images {
+		t.Errorf("planned images = %d, want %d", planned, images)
+	}
+}
+
+func TestPlannedImageSizeGuard(t *testing.T) {
+	ctx := context.Background()
+	nodes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nodes.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+	i := imageCache("helloworld", "helloworld:v1")
+	// The shard of the Image is full already.
+	plan := &cachingv1alpha1.NodeWarmPlan{
+		ObjectMeta: metav1.ObjectMeta{Name: imagewarm.PlanName("node-1", imagewarm.OwnerKey(i))},
+		Spec:       cachingv1alpha1.NodeWarmPlanSpec{NodeName: "node-1"},
+	}
+	for k := 0; k < 2*imagewarm.MaxPlanSpecSize/1024; k++ {
+		plan.Spec.Images = append(plan.Spec.Images, cachingv1alpha1.PlannedImage{
+			Owner: fmt.Sprintf("default/image-%d", k),
+			Image: fmt.Sprintf("registry.example.com/%01000d", k),
+		})
+	}
+	plans := cache.NewIndexer(cache.MetaNamespaceKeyFunc, NodeWarmPlanIndexers)
+	plans.Add(plan)
+	client := fake.NewSimpleClientset(plan)
+	r := Reconciler{
+		NodeLister:          corelisters.NewNodeLister(nodes),
+		NodeWarmPlanLister:  imagewarmlisters.NewNodeWarmPlanLister(plans),
+		NodeWarmPlanIndexer: plans,
+		ImageWarmClient:     client,
+	}
+
+	if err := r.applyPlannedImage(ctx, i, "node-1"); err == nil {
+		t.Error("applyPlannedImage() succeeded, want the full plan not to grow")
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("NodeWarmPlan updated past its size limit: %v", action)
+		}
+	}
+}
+
+func TestEnqueuePlannedImages(t *testing.T) {
+	plan := &cachingv1alpha1.NodeWarmPlan{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Spec: cachingv1alpha1.NodeWarmPlanSpec{
+			NodeName: "node-1",
+			Images: []cachingv1alpha1.PlannedImage{
+				{Owner: "default/helloworld", Image: "helloworld:v1"},
+				{Owner: "default/sleep", Image: "sleep:v1"},
+			},
+		},
+	}
+
+	for name, obj := range map[string]interface{}{
+		"plan":      plan,
+		"tombstone": cache.DeletedFinalStateUnknown{Key: "node-1", Obj: plan},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			EnqueuePlannedImages(func(key types.NamespacedName) {
+				got = append(got, key.String())
+			})(obj)
+			if want := []string{"default/helloworld", "default/sleep"}; !cmp.Equal(got, want) {
+				t.Errorf("enqueued %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCollectPlannedOrphans(t *testing.T) {
+	name := imagewarm.PlanName("node-1", "default/helloworld")
+	plan := &cachingv1alpha1.NodeWarmPlan{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: cachingv1alpha1.NodeWarmPlanSpec{
+			NodeName: "node-1",
+			Images: []cachingv1alpha1.PlannedImage{
+				{Owner: "default/helloworld", Image: "helloworld:v1"},
+			},
+		},
+	}
+	// The entries of deleted Images, and those of the plan named after the
+	// node alone, out of their shard, are collected.
+	legacy := &cachingv1alpha1.NodeWarmPlan{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Spec: cachingv1alpha1.NodeWarmPlanSpec{
+			NodeName: "node-1",
+			Images: []cachingv1alpha1.PlannedImage{
+				{Owner: "default/helloworld", Image: "helloworld:v1"},
+			},
+		},
+	}
+	for _, owner := range []string{"default/deleted", "default/gone"} {
+		entry := cachingv1alpha1.PlannedImage{Owner: owner, Image: "deleted:v1"}
+		if imagewarm.PlanName("node-1", owner) == name {
+			plan.Spec.Images = append(plan.Spec.Images, entry)
+		} else {
+			legacy.Spec.Images = append(legacy.Spec.Images, entry)
+		}
+	}
+	plans := cache.NewIndexer(cache.MetaNamespaceKeyFunc, NodeWarmPlanIndexers)
+	plans.Add(plan)
+	plans.Add(legacy)
+	images := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	images.Add(imageCache("helloworld", "helloworld:v1"))
+	client := fake.NewSimpleClientset(plan, legacy)
+	r := Reconciler{
+		ImageCacheLister:    imagecachelisters.NewImageLister(images),
+		NodeWarmPlanLister:  imagewarmlisters.NewNodeWarmPlanLister(plans),
+		NodeWarmPlanIndexer: plans,
+		ImageWarmClient:     client,
+	}
+
+	if err := r.CollectPlannedOrphans(context.Background()); err != nil {
+		t.Fatalf("CollectPlannedOrphans() = %v", err)
+	}
+	want := []string{"default/helloworld=helloworld:v1"}
+	if diff := cmp.Diff(want, plannedOwners(t, client, "node-1")); diff != "" {
+		t.Errorf("planned images (-want, +got) = %s", diff)
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/pkg/apis"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching"
+	"knative.dev/cache-imagewarm/pkg/config"
+)
+
+const (
+	// MinReadyNodesAnnotation is the Image annotation overriding the number,
+	// or percentage, of eligible nodes that must hold the image for it to be Ready.
+	MinReadyNodesAnnotation = caching.GroupName + "/minReadyNodes"
+	// MinReadyNodesPerZoneAnnotation is the Image annotation overriding the
+	// number of eligible nodes of every zone that must hold the image.
+	MinReadyNodesPerZoneAnnotation = caching.GroupName + "/minReadyNodesPerZone"
+
+	// FailingNodesAnnotation is the Image status annotation listing the
+	// eligible nodes whose ImageWarm is failing.
+	FailingNodesAnnotation = caching.GroupName + "/failingNodes"
+
+	// ImageConditionDegraded is True when the Image is Ready but the
+	// ImageWarms of some eligible nodes are failing.
+	ImageConditionDegraded apis.ConditionType = "Degraded"
+
+	// maxFailingNodes caps the number of nodes listed in FailingNodesAnnotation.
+	maxFailingNodes = 20
+)
+
+// nodeWarmState is the state of the image on an eligible node.
+type nodeWarmState struct {
+	name string
+	zone string
+	// warmed is set when the node holds the image or its ImageWarm is Ready.
+	warmed bool
+	// failing is set when the ImageWarm of the node is not Ready for a failure,
+	// or stuck.
+	failing bool
+	// stuck is set when the node has been warming the image for longer than
+	// the progress deadline of the rollout.
+	stuck bool
+	// started is set when the node has an ImageWarm for the image.
+	started bool
+}
+
+func countWarmed(nodes []nodeWarmState) int {
+	warmed := 0
+	for _, node := range nodes {
+		if node.warmed {
+			warmed++
+		}
+	}
+	return warmed
+}
+
+// readiness is the outcome of evaluating a readiness policy.
+type readiness struct {
+	eligible int
+	warmed   int
+	// failing are the names of the failing nodes, sorted.
+	failing []string
+	ready   bool
+	reason  string
+	message string
+}
+
+// readinessPolicy returns the policy of the Image: the default one, overridden
+// by the annotations of the Image.
+func readinessPolicy(defaults *config.Readiness, annotations map[string]string) (*config.Readiness, error) {
+	policy := *defaults
+	if value, ok := annotations[MinReadyNodesAnnotation]; ok {
+		threshold, err := config.ParseThreshold(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation %s: %w", MinReadyNodesAnnotation, err)
+		}
+		policy.MinReadyNodes = threshold
+	}
+	if value, ok := annotations[MinReadyNodesPerZoneAnnotation]; ok {
+		perZone, err := strconv.Atoi(value)
+		if err != nil || perZone < 0 {
+			return nil, fmt.Errorf("invalid annotation %s: %q is not a non-negative integer", MinReadyNodesPerZoneAnnotation, value)
+		}
+		policy.MinReadyNodesPerZone = perZone
+	}
+	return &policy, nil
+}
+
+// evaluateReadiness decides whether enough eligible nodes hold the image,
+// overall and in every zone.
+func evaluateReadiness(policy *config.Readiness, nodes []nodeWarmState) readiness {
+	result := readiness{eligible: len(nodes), warmed: countWarmed(nodes)}
+	for _, node := range nodes {
+		if node.failing {
+			result.failing = append(result.failing, node.name)
+		}
+	}
+	sort.Strings(result.failing)
+
+	if result.eligible == 0 {
+		result.reason, result.message = "NoEligibleNodes", "No node is eligible to cache the image"
+		return result
+	}
+	if required := policy.MinReadyNodes.Of(result.eligible); result.warmed < required {
+		result.reason = "NotEnoughNodes"
+		result.message = fmt.Sprintf("%d of %d eligible nodes hold the image, %s required",
+			result.warmed, result.eligible, policy.MinReadyNodes)
+		return result
+	}
+
+	if policy.MinReadyNodesPerZone > 0 {
+		eligible, warmed := map[string]int{}, map[string]int{}
+		for _, node := range nodes {
+			if node.zone == "" {
+				continue
+			}
+			eligible[node.zone]++
+			if node.warmed {
+				warmed[node.zone]++
+			}
+		}
+		zones := make([]string, 0, len(eligible))
+		for zone := range eligible {
+			zones = append(zones, zone)
+		}
+		sort.Strings(zones)
+		for _, zone := range zones {
+			required := policy.MinReadyNodesPerZone
+			if required > eligible[zone] {
+				required = eligible[zone]
+			}
+			if warmed[zone] < required {
+				result.reason = "NotEnoughNodesInZone"
+				result.message = fmt.Sprintf("%d of %d eligible nodes in zone %s hold the image, %d required",
+					warmed[zone], eligible[zone], zone, required)
+				return result
+			}
+		}
+	}
+
+	result.ready = true
+	return result
+}
+
+// markReadiness reflects the readiness in the conditions and the status
+// annotations of the Image.
+func markReadiness(i *v1alpha1.Image, r readiness) {
+	if i.Status.Annotations == nil {
+		i.Status.Annotations = make(map[string]string, 1)
+	}
+	if len(r.failing) == 0 {
+		delete(i.Status.Annotations, FailingNodesAnnotation)
+	} else {
+		listed := r.failing
+		if len(listed) > maxFailingNodes {
+			listed = listed[:maxFailingNodes]
+		}
+		i.Status.Annotations[FailingNodesAnnotation] = strings.Join(listed, ",")
+	}
+
+	if r.ready {
+		i.Status.MarkReadyTrue()
+	} else {
+		i.Status.MarkReadyFalse(r.reason, r.message)
+	}
+
+	degraded := apis.Condition{
+		Type:     ImageConditionDegraded,
+		Status:   corev1.ConditionFalse,
+		Severity: apis.ConditionSeverityWarning,
+	}
+	if len(r.failing) > 0 {
+		degraded.Status = corev1.ConditionTrue
+		degraded.Reason = "ImageWarmsFailing"
+		degraded.Message = fmt.Sprintf("The ImageWarms of %d of %d eligible nodes are failing", len(r.failing), r.eligible)
+	}
+	i.GetConditionSet().Manage(&i.Status).SetCondition(degraded)
+}
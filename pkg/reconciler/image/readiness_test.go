@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"knative.dev/cache-imagewarm/pkg/config"
+)
+
+func TestEvaluateReadiness(t *testing.T) {
+	nodes := []nodeWarmState{
+		{name: "a1", zone: "a", warmed: true},
+		{name: "a2", zone: "a", warmed: true},
+		{name: "b1", zone: "b", failing: true},
+		{name: "b2", zone: "b"},
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		nodes       []nodeWarmState
+		wantReady   bool
+		wantReason  string
+		wantFailing []string
+	}{{
+		name:       "no eligible nodes",
+		wantReason: "NoEligibleNodes",
+	}, {
+		name:        "all nodes by default",
+		nodes:       nodes,
+		wantReason:  "NotEnoughNodes",
+		wantFailing: []string{"b1"},
+	}, {
+		name:        "percentage",
+		annotations: map[string]string{MinReadyNodesAnnotation: "50%"},
+		nodes:       nodes,
+		wantReady:   true,
+		wantFailing: []string{"b1"},
+	}, {
+		name:        "count",
+		annotations: map[string]string{MinReadyNodesAnnotation: "2"},
+		nodes:       nodes,
+		wantReady:   true,
+		wantFailing: []string{"b1"},
+	}, {
+		name: "per zone",
+		annotations: map[string]string{
+			MinReadyNodesAnnotation:        "2",
+			MinReadyNodesPerZoneAnnotation: "1",
+		},
+		nodes:       nodes,
+		wantReason:  "NotEnoughNodesInZone",
+		wantFailing: []string{"b1"},
+	}, {
+		name:        "per zone capped by the zone size",
+		annotations: map[string]string{MinReadyNodesPerZoneAnnotation: "3"},
+		nodes:       []nodeWarmState{{name: "a1", zone: "a", warmed: true}, {name: "c1", warmed: true}},
+		wantReady:   true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := readinessPolicy(config.FromContextOrDefaults(context.Background()).Readiness, test.annotations)
+			if err != nil {
+				t.Fatalf("readinessPolicy() = %v", err)
+			}
+			got := evaluateReadiness(policy, test.nodes)
+			if got.ready != test.wantReady || got.reason != test.wantReason {
+				t.Errorf("evaluateReadiness() = ready %v, reason %q, want ready %v, reason %q",
+					got.ready, got.reason, test.wantReady, test.wantReason)
+			}
+			if diff := cmp.Diff(test.wantFailing, got.failing); diff != "" {
+				t.Errorf("evaluateReadiness() failing nodes (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestReadinessPolicyInvalid(t *testing.T) {
+	for _, annotations := range []map[string]string{
+		{MinReadyNodesAnnotation: "most"},
+		{MinReadyNodesPerZoneAnnotation: "-1"},
+	} {
+		if _, err := readinessPolicy(config.FromContextOrDefaults(context.Background()).Readiness, annotations); err == nil {
+			t.Errorf("readinessPolicy(%v) succeeded, want an error", annotations)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching"
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+)
+
+const (
+	// CanaryNodesAnnotation is the Image annotation overriding the number of
+	// nodes the image is warmed on before the others.
+	CanaryNodesAnnotation = caching.GroupName + "/canaryNodes"
+	// WaveSizeAnnotation is the Image annotation overriding the number, or
+	// percentage, of the target nodes the image is warmed on together.
+	WaveSizeAnnotation = caching.GroupName + "/waveSize"
+
+	// RolloutAnnotation is the Image status annotation holding the phase of
+	// the rollout of its ImageWarms.
+	RolloutAnnotation = caching.GroupName + "/rollout"
+)
+
+// The phases of a rollout.
+const (
+	rolloutCanary   = "Canary"
+	rolloutWaves    = "Waves"
+	rolloutComplete = "Complete"
+	rolloutHalted   = "Halted"
+)
+
+// rollout is the outcome of planning the rollout of the ImageWarms of an Image.
+type rollout struct {
+	phase string
+	// start are the names of the nodes to create an ImageWarm on.
+	start map[string]bool
+	// message explains why the rollout is halted.
+	message string
+}
+
+// rolloutPolicy returns the policy of the Image: the default one, overridden
+// by the annotations of the Image.
+func rolloutPolicy(defaults *config.Rollout, annotations map[string]string) (*config.Rollout, error) {
+	policy := *defaults
+	if value, ok := annotations[CanaryNodesAnnotation]; ok {
+		canaries, err := strconv.Atoi(value)
+		if err != nil || canaries < 0 {
+			return nil, fmt.Errorf("invalid annotation %s: %q is not a non-negative integer", CanaryNodesAnnotation, value)
+		}
+		policy.CanaryNodes = canaries
+	}
+	if value, ok := annotations[WaveSizeAnnotation]; ok {
+		threshold, err := config.ParseThreshold(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation %s: %w", WaveSizeAnnotation, err)
+		}
+		policy.WaveSize = threshold
+	}
+	return &policy, nil
+}
+
+// WarmStarts records since when the nodes have been warming the image of an
+// Image, so that the nodes stuck warming it past the progress deadline do not
+// hold its rollout for ever.
+type WarmStarts struct {
+	mu    sync.Mutex
+	since map[string]map[string]time.Time
+}
+
+// NewWarmStarts creates an empty WarmStarts.
+func NewWarmStarts() *WarmStarts {
+	return &WarmStarts{since: make(map[string]map[string]time.Time)}
+}
+
+// Since returns when the node was first found warming the image of owner,
+// recording now when it was not.
+func (w *WarmStarts) Since(owner, nodeName string, now time.Time) time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	nodes, ok := w.since[owner]
+	if !ok {
+		nodes = make(map[string]time.Time)
+		w.since[owner] = nodes
+	}
+	since, ok := nodes[nodeName]
+	if !ok {
+		since = now
+		nodes[nodeName] = since
+	}
+	return since
+}
+
+// Forget drops the record of the node, no longer warming the image of owner,
+// or of all the nodes of owner when nodeName is empty.
+func (w *WarmStarts) Forget(owner, nodeName string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if nodeName == "" {
+		delete(w.since, owner)
+		return
+	}
+	delete(w.since[owner], nodeName)
+	if len(w.since[owner]) == 0 {
+		delete(w.since, owner)
+	}
+}
+
+// markStuck marks failing the nodes that have been warming the image of the
+// Image for longer than deadline, and returns how long until the next of the
+// others would be, zero when none is warming it or deadline is zero.
+func (r Reconciler) markStuck(i *v1alpha1.Image, nodes []nodeWarmState, deadline time.Duration) time.Duration {
+	owner := imagewarm.OwnerKey(i)
+	now := time.Now()
+	var next time.Duration
+	for k := range nodes {
+		state := &nodes[k]
+		if !state.started || state.warmed || state.failing {
+			r.WarmStarts.Forget(owner, state.name)
+			continue
+		}
+		if deadline <= 0 {
+			continue
+		}
+		left := deadline - now.Sub(r.WarmStarts.Since(owner, state.name, now))
+		if left <= 0 {
+			state.failing, state.stuck = true, true
+		} else if next == 0 || left < next {
+			next = left
+		}
+	}
+	return next
+}
+
+// planRollout chooses the nodes, in order, to start warming the image on.
+// The canaries come first: the rollout waits until enough of the nodes it
+// started hold the image, and halts while the ImageWarm of a canary is
+// failing or stuck. The nodes that held the image before are no canaries.
+// Then a wave of nodes starts whenever none of the ImageWarms started is
+// still pulling, those failing or stuck not counting.
+func planRollout(policy *config.Rollout, nodes []nodeWarmState) rollout {
+	plan := rollout{start: map[string]bool{}}
+	warmed, pulled, toPull, inFlight := 0, 0, 0, 0
+	var pending []string
+	var failing []nodeWarmState
+	for _, node := range nodes {
+		if node.started || !node.warmed {
+			toPull++
+		}
+		switch {
+		case node.warmed:
+			warmed++
+			if node.started {
+				pulled++
+			}
+		case !node.started:
+			pending = append(pending, node.name)
+		case node.failing:
+			failing = append(failing, node)
+		default:
+			inFlight++
+		}
+	}
+
+	if canaries := policy.CanaryNodes; canaries > 0 && pulled < clamp(canaries, toPull) {
+		if len(failing) > 0 {
+			plan.phase = rolloutHalted
+			reason := "is failing"
+			if failing[0].stuck {
+				reason = fmt.Sprintf("has not warmed the image within %v", policy.ProgressDeadline)
+			}
+			plan.message = fmt.Sprintf("The ImageWarm of the canary node %s %s, %d of %d canaries hold the image",
+				failing[0].name, reason, pulled, canaries)
+			return plan
+		}
+		plan.phase = rolloutCanary
+		for _, name := range pending[:clamp(canaries-pulled-inFlight, len(pending))] {
+			plan.start[name] = true
+		}
+		return plan
+	}
+
+	if len(pending) == 0 && inFlight == 0 {
+		plan.phase = rolloutComplete
+		return plan
+	}
+	plan.phase = rolloutWaves
+	if inFlight == 0 {
+		wave := policy.WaveSize.Of(len(nodes))
+		if wave == 0 {
+			wave = 1
+		}
+		for _, name := range pending[:clamp(wave, len(pending))] {
+			plan.start[name] = true
+		}
+	}
+	return plan
+}
+
+// clamp bounds n between 0 and max.
+func clamp(n, max int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+)
+
+func TestPlanRollout(t *testing.T) {
+	canary := &config.Rollout{CanaryNodes: 1, WaveSize: config.Threshold{Count: 2}}
+
+	tests := []struct {
+		name        string
+		policy      *config.Rollout
+		nodes       []nodeWarmState
+		wantPhase   string
+		wantStarted []string
+	}{{
+		name:        "all at once by default",
+		policy:      &config.Rollout{WaveSize: config.Threshold{Percent: 100, IsPercent: true}},
+		nodes:       []nodeWarmState{{name: "n1"}, {name: "n2"}, {name: "n3"}},
+		wantPhase:   rolloutWaves,
+		wantStarted: []string{"n1", "n2", "n3"},
+	}, {
+		name:        "canary first",
+		policy:      canary,
+		nodes:       []nodeWarmState{{name: "n1"}, {name: "n2"}, {name: "n3"}},
+		wantPhase:   rolloutCanary,
+		wantStarted: []string{"n1"},
+	}, {
+		name:      "canary pulling",
+		policy:    canary,
+		nodes:     []nodeWarmState{{name: "n1", started: true}, {name: "n2"}, {name: "n3"}},
+		wantPhase: rolloutCanary,
+	}, {
+		name:      "canary failing",
+		policy:    canary,
+		nodes:     []nodeWarmState{{name: "n1", started: true, failing: true}, {name: "n2"}, {name: "n3"}},
+		wantPhase: rolloutHalted,
+	}, {
+		name:        "first wave",
+		policy:      canary,
+		nodes:       []nodeWarmState{{name: "n1", started: true, warmed: true}, {name: "n2"}, {name: "n3"}, {name: "n4"}},
+		wantPhase:   rolloutWaves,
+		wantStarted: []string{"n2", "n3"},
+	}, {
+		name:        "nodes holding the image are no canaries",
+		policy:      canary,
+		nodes:       []nodeWarmState{{name: "n1", warmed: true}, {name: "n2"}, {name: "n3"}},
+		wantPhase:   rolloutCanary,
+		wantStarted: []string{"n2"},
+	}, {
+		name:      "canary stuck",
+		policy:    canary,
+		nodes:     []nodeWarmState{{name: "n1", started: true, failing: true, stuck: true}, {name: "n2"}},
+		wantPhase: rolloutHalted,
+	}, {
+		name:   "wave pulling",
+		policy: canary,
+		nodes: []nodeWarmState{
+			{name: "n1", started: true, warmed: true},
+			{name: "n2", started: true},
+			{name: "n3", started: true, warmed: true},
+			{name: "n4"},
+		},
+		wantPhase: rolloutWaves,
+	}, {
+		name:   "failing nodes do not hold the waves",
+		policy: canary,
+		nodes: []nodeWarmState{
+			{name: "n1", started: true, warmed: true},
+			{name: "n2", started: true, failing: true},
+			{name: "n3"},
+		},
+		wantPhase:   rolloutWaves,
+		wantStarted: []string{"n3"},
+	}, {
+		name:   "stuck nodes do not hold the waves",
+		policy: canary,
+		nodes: []nodeWarmState{
+			{name: "n1", started: true, warmed: true},
+			{name: "n2", started: true, failing: true, stuck: true},
+			{name: "n3"},
+		},
+		wantPhase:   rolloutWaves,
+		wantStarted: []string{"n3"},
+	}, {
+		name:      "complete",
+		policy:    canary,
+		nodes:     []nodeWarmState{{name: "n1", started: true, warmed: true}, {name: "n2", warmed: true}},
+		wantPhase: rolloutComplete,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan := planRollout(test.policy, test.nodes)
+			if plan.phase != test.wantPhase {
+				t.Errorf("planRollout() phase = %s, want %s", plan.phase, test.wantPhase)
+			}
+			var started []string
+			for _, node := range test.nodes {
+				if plan.start[node.name] {
+					started = append(started, node.name)
+				}
+			}
+			if diff := cmp.Diff(test.wantStarted, started); diff != "" {
+				t.Errorf("planRollout() started (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestMarkStuck(t *testing.T) {
+	i := &v1alpha1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "image"}}
+	r := Reconciler{WarmStarts: NewWarmStarts()}
+	r.WarmStarts.Since(imagewarm.OwnerKey(i), "n1", time.Now().Add(-time.Hour))
+	nodes := []nodeWarmState{
+		{name: "n1", started: true},
+		{name: "n2", started: true},
+		{name: "n3", started: true, warmed: true},
+		{name: "n4"},
+	}
+
+	next := r.markStuck(i, nodes, 15*time.Minute)
+	if !nodes[0].stuck || !nodes[0].failing {
+		t.Errorf("markStuck() did not mark n1, warming for an hour, stuck")
+	}
+	if nodes[1].stuck || nodes[1].failing {
+		t.Errorf("markStuck() marked n2, just started, stuck")
+	}
+	if next <= 0 || next > 15*time.Minute {
+		t.Errorf("markStuck() = %v, want the time left to n2", next)
+	}
+
+	// The warmed node is forgotten, as the nodes are once warmed.
+	nodes[1].warmed = true
+	r.markStuck(i, nodes, 15*time.Minute)
+	now := time.Now()
+	if since := r.WarmStarts.Since(imagewarm.OwnerKey(i), "n2", now); !since.Equal(now) {
+		t.Errorf("Since(n2) = %v, want it forgotten once warmed", since)
+	}
+}
+
+func TestRolloutPolicy(t *testing.T) {
+	defaults := &config.Rollout{WaveSize: config.Threshold{Percent: 100, IsPercent: true}}
+	policy, err := rolloutPolicy(defaults, map[string]string{CanaryNodesAnnotation: "2", WaveSizeAnnotation: "25%"})
+	if err != nil {
+		t.Fatalf("rolloutPolicy() = %v", err)
+	}
+	if want := (&config.Rollout{CanaryNodes: 2, WaveSize: config.Threshold{Percent: 25, IsPercent: true}}); !cmp.Equal(want, policy) {
+		t.Errorf("rolloutPolicy() = %v, want %v", policy, want)
+	}
+	for _, annotations := range []map[string]string{{CanaryNodesAnnotation: "-1"}, {WaveSizeAnnotation: "half"}} {
+		if _, err := rolloutPolicy(defaults, annotations); err == nil {
+			t.Errorf("rolloutPolicy(%v) succeeded, want an error", annotations)
+		}
+	}
+}
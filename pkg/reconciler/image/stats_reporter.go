@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/pkg/metrics"
+)
+
+const (
+	operationCreate = "create"
+	operationPatch  = "patch"
+	operationDelete = "delete"
+)
+
+var (
+	warmLatencyM = stats.Float64(
+		"image_warm_latencies",
+		"Time from the creation of an Image until a percentage of its eligible nodes hold it",
+		stats.UnitSeconds)
+	eligibleNodesM = stats.Int64(
+		"image_eligible_nodes",
+		"Number of nodes an Image should be cached on",
+		stats.UnitDimensionless)
+	warmedNodesM = stats.Int64(
+		"image_warmed_nodes",
+		"Number of eligible nodes holding an Image",
+		stats.UnitDimensionless)
+	imageWarmOperationsM = stats.Int64(
+		"imagewarm_operations",
+		"Number of ImageWarms created, patched and deleted",
+		stats.UnitDimensionless)
+
+	namespaceKey = tag.MustNewKey("namespace_name")
+	imageKey     = tag.MustNewKey("image_name")
+	// milestoneKey is the percentage of the eligible nodes reached.
+	milestoneKey = tag.MustNewKey("milestone")
+	// operationKey is create, patch or delete.
+	operationKey = tag.MustNewKey("operation")
+)
+
+func init() {
+	register()
+}
+
+func register() {
+	if err := metrics.RegisterResourceView(
+		&view.View{
+			Description: warmLatencyM.Description(),
+			Measure:     warmLatencyM,
+			Aggregation: view.Distribution(metrics.Buckets125(1, 3600)...), // 1s to 1h
+			TagKeys:     []tag.Key{milestoneKey},
+		},
+		&view.View{
+			Description: eligibleNodesM.Description(),
+			Measure:     eligibleNodesM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{namespaceKey, imageKey},
+		},
+		&view.View{
+			Description: warmedNodesM.Description(),
+			Measure:     warmedNodesM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{namespaceKey, imageKey},
+		},
+		&view.View{
+			Description: imageWarmOperationsM.Description(),
+			Measure:     imageWarmOperationsM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{operationKey},
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// reportNodes records the number of eligible and warmed nodes of the Image.
+func reportNodes(ctx context.Context, i *v1alpha1.Image, eligible, warmed int) {
+	ctx, err := tag.New(ctx, tag.Upsert(namespaceKey, i.Namespace), tag.Upsert(imageKey, i.Name))
+	if err != nil {
+		return
+	}
+	metrics.RecordBatch(ctx, eligibleNodesM.M(int64(eligible)), warmedNodesM.M(int64(warmed)))
+}
+
+// reportWarmLatency records the time the Image took to reach the milestone.
+func reportWarmLatency(ctx context.Context, milestone int, latency time.Duration) {
+	ctx, err := tag.New(ctx, tag.Upsert(milestoneKey, strconv.Itoa(milestone)))
+	if err != nil {
+		return
+	}
+	metrics.Record(ctx, warmLatencyM.M(latency.Seconds()))
+}
+
+// reportOperation counts a successful create, patch or delete of an ImageWarm.
+func reportOperation(ctx context.Context, operation string) {
+	ctx, err := tag.New(ctx, tag.Upsert(operationKey, operation))
+	if err != nil {
+		return
+	}
+	metrics.Record(ctx, imageWarmOperationsM.M(1))
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/pkg/logging"
+)
+
+// IneligibleNodes records since when the nodes have been found no longer
+// eligible for an Image, so that the grace period runs once per node, for
+// all of its warms, rather than once per warm. A node is forgotten on any
+// change of what decides its eligibility, and when it is deleted.
+type IneligibleNodes struct {
+	mu    sync.Mutex
+	since map[string]time.Time
+}
+
+// NewIneligibleNodes creates an empty IneligibleNodes.
+func NewIneligibleNodes() *IneligibleNodes {
+	return &IneligibleNodes{since: make(map[string]time.Time)}
+}
+
+// Since returns when the node was first found ineligible since it was last
+// forgotten, recording now when it was not.
+func (n *IneligibleNodes) Since(nodeName string, now time.Time) time.Time {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	since, ok := n.since[nodeName]
+	if !ok {
+		since = now
+		n.since[nodeName] = since
+	}
+	return since
+}
+
+// Forget drops the record of the node, whose eligibility may have changed.
+func (n *IneligibleNodes) Forget(nodeName string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.since, nodeName)
+}
+
+// suspendWarm keeps warming the image of the Image on a node that is no
+// longer eligible for it for the grace period, so that transient taints and
+// short cordons do not delete and recreate its ImageWarm. The grace period
+// starts when the node is first found ineligible, and the warm is deleted
+// once it is over. It returns how long until then, zero when there is
+// nothing left to wait for.
+func (r Reconciler) suspendWarm(ctx context.Context, i *v1alpha1.Image, nodeName string, grace time.Duration) (time.Duration, error) {
+	if _, err := r.listedWarm(ctx, i, nodeName); errors.IsNotFound(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	since := r.IneligibleNodes.Since(nodeName, now)
+	if since.Equal(now) {
+		logging.FromContext(ctx).Infof("Suspending the warms on ineligible Node %s for %v", nodeName, grace)
+	}
+	if left := grace - now.Sub(since); left > 0 {
+		return left, nil
+	}
+	return 0, r.deleteWarm(ctx, i, nodeName)
+}
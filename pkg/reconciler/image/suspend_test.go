@@ -0,0 +1,161 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/pkg/kmeta"
+
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/client/clientset/versioned/fake"
+	imagewarmlisters "knative.dev/cache-imagewarm/pkg/client/listers/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+)
+
+func TestSuspendWarm(t *testing.T) {
+	i := &v1alpha1.Image{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "helloworld", UID: "uid"},
+		Spec:       v1alpha1.ImageSpec{Image: "helloworld:v1"},
+	}
+	const grace = 5 * time.Minute
+
+	tests := []struct {
+		name     string
+		since    time.Duration
+		missing  bool
+		wantVerb string
+		wantLeft time.Duration
+	}{{
+		name:     "newly ineligible",
+		wantLeft: grace,
+	}, {
+		name:     "within the grace period",
+		since:    time.Minute,
+		wantLeft: 4 * time.Minute,
+	}, {
+		name:     "grace period over",
+		since:    time.Hour,
+		wantVerb: "delete",
+	}, {
+		name:    "no imagewarm",
+		missing: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warm := imagewarm.MakeImageWarm(i, "node-1")
+			warm.OwnerReferences = []metav1.OwnerReference{*kmeta.NewControllerRef(i)}
+			imageWarms := cache.NewIndexer(cache.MetaNamespaceKeyFunc, ImageWarmIndexers)
+			client := fake.NewSimpleClientset()
+			if !test.missing {
+				imageWarms.Add(warm)
+				client.Tracker().Add(warm)
+			}
+			r := Reconciler{
+				ImageWarmerLister: imagewarmlisters.NewImageWarmLister(imageWarms),
+				ImageWarmIndexer:  imageWarms,
+				ImageWarmClient:   client,
+				IneligibleNodes:   NewIneligibleNodes(),
+			}
+			if test.since > 0 {
+				r.IneligibleNodes.Since("node-1", time.Now().Add(-test.since))
+			}
+
+			left, err := r.suspendWarm(context.Background(), i, "node-1", grace)
+			if err != nil {
+				t.Fatalf("suspendWarm() = %v", err)
+			}
+			// Allow for the time the test takes.
+			if left > test.wantLeft || left < test.wantLeft-time.Second {
+				t.Errorf("suspendWarm() = %v, want %v", left, test.wantLeft)
+			}
+
+			var verbs []string
+			for _, action := range client.Actions() {
+				verbs = append(verbs, action.GetVerb())
+			}
+			switch {
+			case test.wantVerb == "" && len(verbs) != 0:
+				t.Errorf("actions = %v, want none", verbs)
+			case test.wantVerb != "" && (len(verbs) != 1 || verbs[0] != test.wantVerb):
+				t.Errorf("actions = %v, want %s", verbs, test.wantVerb)
+			}
+		})
+	}
+}
+
+func TestSuspendWarmsPerNode(t *testing.T) {
+	images := []*v1alpha1.Image{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "helloworld"},
+		Spec:       v1alpha1.ImageSpec{Image: "helloworld:v1"},
+	}, {
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sidecar"},
+		Spec:       v1alpha1.ImageSpec{Image: "sidecar:v1"},
+	}}
+	plans := cache.NewIndexer(cache.MetaNamespaceKeyFunc, NodeWarmPlanIndexers)
+	client := fake.NewSimpleClientset()
+	for _, i := range images {
+		plan := &cachingv1alpha1.NodeWarmPlan{
+			ObjectMeta: metav1.ObjectMeta{Name: imagewarm.PlanName("node-1", imagewarm.OwnerKey(i))},
+			Spec:       cachingv1alpha1.NodeWarmPlanSpec{NodeName: "node-1"},
+		}
+		if obj, ok, _ := plans.Get(plan); ok {
+			plan = obj.(*cachingv1alpha1.NodeWarmPlan)
+		}
+		plan.Spec.Images = append(plan.Spec.Images, imagewarm.MakePlannedImage(i))
+		plans.Update(plan)
+	}
+	for _, obj := range plans.List() {
+		client.Tracker().Add(obj.(*cachingv1alpha1.NodeWarmPlan))
+	}
+	r := Reconciler{
+		NodeWarmPlanLister:  imagewarmlisters.NewNodeWarmPlanLister(plans),
+		NodeWarmPlanIndexer: plans,
+		ImageWarmClient:     client,
+		IneligibleNodes:     NewIneligibleNodes(),
+	}
+	ctx := config.ToContext(context.Background(), &config.Config{
+		Features: &config.Features{NodeWarmPlans: config.Enabled},
+	})
+
+	// The node was found ineligible for the first Image a while ago, the
+	// warm of the second one shares its grace period.
+	r.IneligibleNodes.Since("node-1", time.Now().Add(-time.Minute))
+	left, err := r.suspendWarm(ctx, images[1], "node-1", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("suspendWarm() = %v", err)
+	}
+	if left > 4*time.Minute {
+		t.Errorf("suspendWarm() = %v, want at most 4m left of the grace period of the node", left)
+	}
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("actions = %v, want none while suspended", actions)
+	}
+
+	// A change of the node starts its grace period afresh.
+	r.IneligibleNodes.Forget("node-1")
+	if left, err := r.suspendWarm(ctx, images[0], "node-1", 5*time.Minute); err != nil || left != 5*time.Minute {
+		t.Errorf("suspendWarm() = %v, %v, want the whole grace period", left, err)
+	}
+}
@@ -1,10 +1,14 @@
 package imagewarm
 
 import (
+	"crypto/sha256"
 	"fmt"
+
 	"knative.dev/cache-imagewarm/pkg/apis/caching"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 	imagecachev1alpha1 "knative.dev/caching/pkg/apis/caching/v1alpha1"
 	"knative.dev/pkg/kmeta"
 	"knative.dev/serving/pkg/apis/serving"
@@ -17,14 +21,29 @@ const OwnerRefName = caching.GroupName + "/ownerRefName"
 const OwnerRefNameSpace = caching.GroupName + "/ownerRefNameSpace"
 const UpdateTimeLabelKey = serving.GroupName + "/updateTimestamp"
 
+// ImageLabelKey labels the ImageWarms with the ImageHash of their image, so
+// that the warmers list the peers holding an image on the API server.
+const ImageLabelKey = caching.GroupName + "/imageHash"
+
+// FinalizerName is the finalizer the warmers hold the ImageWarms of their node
+// with, until they removed the image.
+const FinalizerName = "imagewarms." + caching.GroupName
+
 func MakeImageWarm(imageCache *imagecachev1alpha1.Image, nodeName string) *cachingv1alpha1.ImageWarm {
 
+	// The labels and annotations of the Image are copied, not shared, the
+	// Image comes from the informer cache.
 	warm := &cachingv1alpha1.ImageWarm{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:            fmt.Sprintf("%s-on-%s", imageCache.Name, nodeName),
-			Namespace:       imageCache.Namespace,
-			Labels:          imageCache.Labels,
-			Annotations:     imageCache.Annotations,
+			Name:      Name(imageCache, nodeName),
+			Namespace: imageCache.Namespace,
+			Labels: kmeta.UnionMaps(imageCache.Labels, map[string]string{
+				NodeLabelKey:      LabelValue(nodeName),
+				OwnerRefName:      LabelValue(imageCache.Name),
+				OwnerRefNameSpace: imageCache.Namespace,
+				ImageLabelKey:     ImageHash(imageCache.Spec.Image),
+			}),
+			Annotations:     kmeta.UnionMaps(imageCache.Annotations),
 			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(imageCache)},
 		},
 		Spec: cachingv1alpha1.ImageWarmSpec{
@@ -33,21 +52,54 @@ func MakeImageWarm(imageCache *imagecachev1alpha1.Image, nodeName string) *cachi
 			ImagePullSecrets: imageCache.Spec.ImagePullSecrets,
 		},
 	}
-	if warm.Labels == nil {
-		warm.Labels = make(map[string]string)
+
+	return warm
+}
+
+// Name returns the name of the ImageWarm of the Image on the node: the name
+// of the Image and of the node, shortened to fit, followed by a hash of both
+// telling apart the pairs of names that would otherwise collide.
+func Name(i *imagecachev1alpha1.Image, nodeName string) string {
+	hash := sha256.Sum256([]byte(i.Name + "/" + nodeName))
+	return kmeta.ChildName(i.Name+"-"+nodeName, fmt.Sprintf("-%x", hash[:4]))
+}
+
+// LegacyName returns the name ImageWarms were created with before Name,
+// <image cache name>-on-<node name>. The ImageWarms named so are adopted.
+func LegacyName(i *imagecachev1alpha1.Image, nodeName string) string {
+	return fmt.Sprintf("%s-on-%s", i.Name, nodeName)
+}
+
+// LabelValue returns value when it is a valid label value, or else a name
+// derived from it that is, to label ImageWarms with the names of their node
+// and their Image which may be too long.
+func LabelValue(value string) string {
+	if len(validation.IsValidLabelValue(value)) == 0 {
+		return value
+	}
+	return kmeta.ChildName(value, "")
+}
+
+// OwnerSelector selects the ImageWarms of the Image, on nodeName when set.
+func OwnerSelector(i *imagecachev1alpha1.Image, nodeName string) labels.Selector {
+	set := labels.Set{
+		OwnerRefName:      LabelValue(i.Name),
+		OwnerRefNameSpace: i.Namespace,
 	}
-	if warm.Annotations == nil {
-		warm.Annotations = make(map[string]string)
+	if nodeName != "" {
+		set[NodeLabelKey] = LabelValue(nodeName)
 	}
-	warm.Labels[NodeLabelKey] = nodeName
-	warm.Labels[OwnerRefName] = imageCache.Name
-	warm.Labels[OwnerRefNameSpace] = imageCache.Namespace
+	return labels.SelectorFromSet(set)
+}
 
-	return warm
+// ImageHash returns a label value identifying the image reference, which is
+// often too long to be one.
+func ImageHash(imageRef string) string {
+	hash := sha256.Sum256([]byte(imageRef))
+	return fmt.Sprintf("%x", hash[:20])
 }
 
-func GetImageWarmByImageAndNode(i *imagecachev1alpha1.Image, nodeName string) string {
-	// imagewarm' name  <image cache name>-on-<node name>
-	imageWarmName := fmt.Sprintf("%s-on-%s", i.Name, nodeName)
-	return imageWarmName
+// ImageSelector selects the ImageWarms of the image reference.
+func ImageSelector(imageRef string) labels.Selector {
+	return labels.SelectorFromSet(labels.Set{ImageLabelKey: ImageHash(imageRef)})
 }
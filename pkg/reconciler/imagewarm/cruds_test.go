@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagewarm
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	imagecachev1alpha1 "knative.dev/caching/pkg/apis/caching/v1alpha1"
+)
+
+func image(name string) *imagecachev1alpha1.Image {
+	return &imagecachev1alpha1.Image{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      name,
+		Labels:    map[string]string{"app": "helloworld"},
+	}}
+}
+
+func TestName(t *testing.T) {
+	long := strings.Repeat("helloworld-", 20) + "cache"
+	fqdn := strings.Repeat("node.", 40) + "example.com"
+
+	for _, test := range []struct{ image, node string }{
+		{"helloworld-00001-cache", "node-1"},
+		{long, fqdn},
+	} {
+		name := Name(image(test.image), test.node)
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 || len(name) > validation.DNS1123LabelMaxLength {
+			t.Errorf("Name(%q, %q) = %q, invalid: %v", test.image, test.node, name, errs)
+		}
+	}
+
+	// The same concatenation of names from different pairs.
+	if a, b := Name(image("a-b"), "c"), Name(image("a"), "b-c"); a == b {
+		t.Errorf("Name() = %q for two different pairs", a)
+	}
+	if a, b := Name(image(long+"-1"), fqdn), Name(image(long+"-2"), fqdn); a == b {
+		t.Errorf("Name() = %q for two different long pairs", a)
+	}
+}
+
+func TestMakeImageWarm(t *testing.T) {
+	i := image(strings.Repeat("helloworld-", 10) + "cache")
+	node := strings.Repeat("node.", 20) + "example.com"
+	warm := MakeImageWarm(i, node)
+
+	if len(i.Labels) != 1 {
+		t.Errorf("MakeImageWarm() changed the labels of the Image: %v", i.Labels)
+	}
+	for key, value := range warm.Labels {
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			t.Errorf("label %s = %q, invalid: %v", key, value, errs)
+		}
+	}
+	if !OwnerSelector(i, node).Matches(labels.Set(warm.Labels)) {
+		t.Errorf("OwnerSelector() does not select the ImageWarm labeled %v", warm.Labels)
+	}
+	if OwnerSelector(i, "node-2").Matches(labels.Set(warm.Labels)) {
+		t.Errorf("OwnerSelector() selects the ImageWarm on another node")
+	}
+	if !ImageSelector(i.Spec.Image).Matches(labels.Set(warm.Labels)) {
+		t.Errorf("ImageSelector() does not select the ImageWarm labeled %v", warm.Labels)
+	}
+	if warm.Spec.NodeName != node {
+		t.Errorf("Spec.NodeName = %q, want %q", warm.Spec.NodeName, node)
+	}
+}
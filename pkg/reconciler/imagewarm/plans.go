@@ -0,0 +1,190 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagewarm
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	imagecachev1alpha1 "knative.dev/caching/pkg/apis/caching/v1alpha1"
+	"knative.dev/pkg/kmeta"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching"
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+)
+
+// PlannedImageLabelPrefix prefixes the keys of the labels marking the images
+// a NodeWarmPlan holds, one per ImageHash, so that the warmers list the peers
+// holding an image on the API server.
+const PlannedImageLabelPrefix = "images." + caching.GroupName + "/"
+
+// PlanShards is the number of NodeWarmPlans the entries of a node are spread
+// across by owner. At 2000 Images on a node, a plan holds about 125 entries
+// and as many labels, and updating one entry rewrites those only.
+const PlanShards = 16
+
+// MaxPlanSpecSize bounds the size of the spec of a NodeWarmPlan, so that the
+// plan, with the status the warmer reports for every entry, stays well within
+// the 1.5MiB etcd holds per object.
+const MaxPlanSpecSize = 512 * 1024
+
+// PlanShard returns the shard of the NodeWarmPlans of a node holding the
+// entry of owner.
+func PlanShard(owner string) int {
+	h := fnv.New32a()
+	h.Write([]byte(owner))
+	return int(h.Sum32() % PlanShards)
+}
+
+// PlanName returns the name of the NodeWarmPlan of the node holding the entry
+// of owner, the name of the node followed by the shard.
+func PlanName(nodeName, owner string) string {
+	return kmeta.ChildName(nodeName, fmt.Sprintf("-%d", PlanShard(owner)))
+}
+
+// CheckPlanSize returns an error when the spec of the plan is larger than
+// MaxPlanSpecSize.
+func CheckPlanSize(plan *cachingv1alpha1.NodeWarmPlan) error {
+	b, err := json.Marshal(plan.Spec)
+	if err != nil {
+		return err
+	}
+	if len(b) > MaxPlanSpecSize {
+		return fmt.Errorf("the spec of NodeWarmPlan %s would take %d bytes, over the limit of %d",
+			plan.Name, len(b), MaxPlanSpecSize)
+	}
+	return nil
+}
+
+// OwnerKey returns the namespace/name key of the Image, the owner of its
+// entries in the NodeWarmPlans.
+func OwnerKey(i *imagecachev1alpha1.Image) string {
+	return i.Namespace + "/" + i.Name
+}
+
+// MakePlannedImage returns the entry of the Image in the NodeWarmPlan of a node.
+func MakePlannedImage(i *imagecachev1alpha1.Image) cachingv1alpha1.PlannedImage {
+	return cachingv1alpha1.PlannedImage{
+		Owner:            OwnerKey(i),
+		Image:            i.Spec.Image,
+		ImagePullSecrets: i.Spec.ImagePullSecrets,
+	}
+}
+
+// MakeNodeWarmPlan returns an empty NodeWarmPlan of the node named name, owned
+// by the node so that it is garbage collected along with it, and labeled with
+// it like ImageWarms so that the warmer of the node only watches its own.
+func MakeNodeWarmPlan(node *corev1.Node, name string) *cachingv1alpha1.NodeWarmPlan {
+	return &cachingv1alpha1.NodeWarmPlan{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{NodeLabelKey: LabelValue(node.Name)},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(node, corev1.SchemeGroupVersion.WithKind("Node")),
+			},
+		},
+		Spec: cachingv1alpha1.NodeWarmPlanSpec{NodeName: node.Name},
+	}
+}
+
+// PlannedImageSelector selects the NodeWarmPlans holding the image reference.
+func PlannedImageSelector(imageRef string) labels.Selector {
+	selector, _ := labels.Parse(PlannedImageLabelPrefix + ImageHash(imageRef))
+	return selector
+}
+
+// LabelPlannedImages labels the plan with the images of its entries, and
+// reports whether its labels changed.
+func LabelPlannedImages(plan *cachingv1alpha1.NodeWarmPlan) bool {
+	want := make(map[string]string, len(plan.Labels)+len(plan.Spec.Images))
+	for key, value := range plan.Labels {
+		if !strings.HasPrefix(key, PlannedImageLabelPrefix) {
+			want[key] = value
+		}
+	}
+	for _, entry := range plan.Spec.Images {
+		want[PlannedImageLabelPrefix+ImageHash(entry.Image)] = ""
+	}
+	if reflect.DeepEqual(want, plan.Labels) || (len(want) == 0 && len(plan.Labels) == 0) {
+		return false
+	}
+	plan.Labels = want
+	return true
+}
+
+// FromPlannedImage returns the ImageWarm standing for the entry of the plan,
+// named after its owner and carrying the status of the entry, so that plan
+// entries are handled as ImageWarms are.
+func FromPlannedImage(plan *cachingv1alpha1.NodeWarmPlan, entry *cachingv1alpha1.PlannedImage) (*cachingv1alpha1.ImageWarm, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(entry.Owner)
+	if err != nil {
+		return nil, err
+	}
+	warm := &cachingv1alpha1.ImageWarm{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: cachingv1alpha1.ImageWarmSpec{
+			Image:            entry.Image,
+			NodeName:         plan.Spec.NodeName,
+			ImagePullSecrets: entry.ImagePullSecrets,
+			Archive:          entry.Archive.DeepCopy(),
+		},
+	}
+	// The status of an entry whose image changed is not carried over.
+	status := plan.Status.Entry(entry.Owner)
+	if status == nil || status.Image != entry.Image {
+		return warm, nil
+	}
+	warm.Status.Endpoint = status.Endpoint
+	warm.Status.PeerEndpoint = status.PeerEndpoint
+	warm.Status.Progress = status.Progress.DeepCopy()
+	switch status.Ready {
+	case corev1.ConditionTrue:
+		warm.Status.MarkReadyTrue()
+	case corev1.ConditionFalse:
+		warm.Status.MarkReadyFalse(status.Reason, status.Message)
+	default:
+		warm.Status.MarkReadyUnknown()
+	}
+	return warm, nil
+}
+
+// PlannedImageStatusOf returns the status entry of the plan reporting the
+// status of warm, the ImageWarm standing for the entry of owner.
+func PlannedImageStatusOf(owner string, warm *cachingv1alpha1.ImageWarm) cachingv1alpha1.PlannedImageStatus {
+	status := cachingv1alpha1.PlannedImageStatus{
+		Owner:        owner,
+		Image:        warm.Spec.Image,
+		Ready:        corev1.ConditionUnknown,
+		Endpoint:     warm.Status.Endpoint,
+		PeerEndpoint: warm.Status.PeerEndpoint,
+		Progress:     warm.Status.Progress,
+	}
+	if cond := warm.Status.GetCondition(cachingv1alpha1.ImageWarmConditionReady); cond != nil {
+		status.Ready = cond.Status
+		if cond.IsFalse() {
+			status.Reason, status.Message = cond.Reason, cond.Message
+		}
+	}
+	return status
+}
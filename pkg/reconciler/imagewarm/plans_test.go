@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagewarm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	cachingv1alpha1 "knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+)
+
+func TestPlannedImageStatus(t *testing.T) {
+	entry := cachingv1alpha1.PlannedImage{Owner: "default/helloworld", Image: "helloworld:v1"}
+	tests := []struct {
+		name   string
+		status *cachingv1alpha1.PlannedImageStatus
+		want   cachingv1alpha1.PlannedImageStatus
+	}{{
+		name: "no status",
+		want: cachingv1alpha1.PlannedImageStatus{Owner: entry.Owner, Image: entry.Image, Ready: corev1.ConditionUnknown},
+	}, {
+		name: "ready",
+		status: &cachingv1alpha1.PlannedImageStatus{
+			Owner: entry.Owner, Image: entry.Image, Ready: corev1.ConditionTrue,
+			Endpoint: "mirror.example.com", PeerEndpoint: "10.0.0.1:5000",
+		},
+		want: cachingv1alpha1.PlannedImageStatus{
+			Owner: entry.Owner, Image: entry.Image, Ready: corev1.ConditionTrue,
+			Endpoint: "mirror.example.com", PeerEndpoint: "10.0.0.1:5000",
+		},
+	}, {
+		name: "failed",
+		status: &cachingv1alpha1.PlannedImageStatus{
+			Owner: entry.Owner, Image: entry.Image, Ready: corev1.ConditionFalse,
+			Reason: "ImagePullFailed", Message: "not found",
+		},
+		want: cachingv1alpha1.PlannedImageStatus{
+			Owner: entry.Owner, Image: entry.Image, Ready: corev1.ConditionFalse,
+			Reason: "ImagePullFailed", Message: "not found",
+		},
+	}, {
+		name: "status of a previous image",
+		status: &cachingv1alpha1.PlannedImageStatus{
+			Owner: entry.Owner, Image: "helloworld:v0", Ready: corev1.ConditionTrue,
+		},
+		want: cachingv1alpha1.PlannedImageStatus{Owner: entry.Owner, Image: entry.Image, Ready: corev1.ConditionUnknown},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan := &cachingv1alpha1.NodeWarmPlan{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+				Spec:       cachingv1alpha1.NodeWarmPlanSpec{NodeName: "node-1", Images: []cachingv1alpha1.PlannedImage{entry}},
+			}
+			if test.status != nil {
+				plan.Status.Images = []cachingv1alpha1.PlannedImageStatus{*test.status}
+			}
+			warm, err := FromPlannedImage(plan, &plan.Spec.Images[0])
+			if err != nil {
+				t.Fatalf("FromPlannedImage() = %v", err)
+			}
+			if warm.Namespace != "default" || warm.Name != "helloworld" || warm.Spec.NodeName != "node-1" || warm.Spec.Image != entry.Image {
+				t.Errorf("FromPlannedImage() = %v, want the ImageWarm of default/helloworld on node-1", warm)
+			}
+			if got, want := warm.IsReady(), test.want.Ready == corev1.ConditionTrue; got != want {
+				t.Errorf("IsReady() = %v, want %v", got, want)
+			}
+			if diff := cmp.Diff(test.want, PlannedImageStatusOf(entry.Owner, warm)); diff != "" {
+				t.Errorf("PlannedImageStatusOf() (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestPlanName(t *testing.T) {
+	shards := make(map[string]bool)
+	for k := 0; k < 1000; k++ {
+		shards[PlanName("node-1", fmt.Sprintf("default/image-%d", k))] = true
+	}
+	if len(shards) != PlanShards {
+		t.Errorf("PlanName() spread the entries across %d plans, want %d", len(shards), PlanShards)
+	}
+	if a, b := PlanName("node-1", "default/helloworld"), PlanName("node-1", "default/helloworld"); a != b {
+		t.Errorf("PlanName() = %s then %s, want the same shard", a, b)
+	}
+	long := strings.Repeat("node", 60)
+	if name := PlanName(long, "default/helloworld"); len(validation.IsDNS1123Subdomain(name)) != 0 {
+		t.Errorf("PlanName() = %s, want a valid name for a long node name", name)
+	}
+}
+
+func TestLabelPlannedImages(t *testing.T) {
+	plan := &cachingv1alpha1.NodeWarmPlan{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{NodeLabelKey: "node-1"}},
+		Spec: cachingv1alpha1.NodeWarmPlanSpec{NodeName: "node-1", Images: []cachingv1alpha1.PlannedImage{
+			{Owner: "default/helloworld", Image: "helloworld:v1"},
+			{Owner: "default/sleep", Image: "sleep:v1"},
+		}},
+	}
+	if !LabelPlannedImages(plan) {
+		t.Error("LabelPlannedImages() = false, want the plan labeled")
+	}
+	if LabelPlannedImages(plan) {
+		t.Error("LabelPlannedImages() = true on a labeled plan, want no change")
+	}
+	for _, image := range []string{"helloworld:v1", "sleep:v1"} {
+		if !PlannedImageSelector(image).Matches(labels.Set(plan.Labels)) {
+			t.Errorf("PlannedImageSelector(%s) does not select the plan labeled %v", image, plan.Labels)
+		}
+	}
+
+	plan.Spec.Images = plan.Spec.Images[:1]
+	if !LabelPlannedImages(plan) {
+		t.Error("LabelPlannedImages() = false, want the label of the removed image removed")
+	}
+	if PlannedImageSelector("sleep:v1").Matches(labels.Set(plan.Labels)) {
+		t.Errorf("PlannedImageSelector() selects the plan without the image, labeled %v", plan.Labels)
+	}
+	if plan.Labels[NodeLabelKey] != "node-1" {
+		t.Errorf("labels = %v, want the node label kept", plan.Labels)
+	}
+}
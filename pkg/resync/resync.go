@@ -0,0 +1,51 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package resync reconciles all the resources of a controller periodically,
+// with a period that may change at any time.
+package resync
+
+import (
+	"context"
+	"time"
+)
+
+// disabledPoll is how often a disabled resync checks whether it was enabled.
+const disabledPoll = 10 * time.Second
+
+// Every calls resync every period, as returned by period before every wait,
+// until ctx is done. A period that is not positive disables the resync until
+// it changes.
+func Every(ctx context.Context, period func() time.Duration, resync func()) {
+	go func() {
+		for {
+			wait, enabled := period(), true
+			if wait <= 0 {
+				wait, enabled = disabledPoll, false
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				if enabled {
+					resync()
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resync
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEvery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var period, calls int64
+	atomic.StoreInt64(&period, int64(time.Millisecond))
+	Every(ctx, func() time.Duration {
+		return time.Duration(atomic.LoadInt64(&period))
+	}, func() {
+		if atomic.AddInt64(&calls, 1) == 3 {
+			// Disabled from now on.
+			atomic.StoreInt64(&period, 0)
+		}
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&calls) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("resync called %d times, want 3", atomic.LoadInt64(&calls))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt64(&calls); got != 3 {
+		t.Errorf("resync called %d times once disabled, want 3", got)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing carries the trace of warming an image from the controller
+// to the warmers, on an annotation of the ImageWarm.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.opencensus.io/trace"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/logging"
+	pkgtracing "knative.dev/pkg/tracing"
+	tracingconfig "knative.dev/pkg/tracing/config"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching"
+)
+
+// TraceParentAnnotation is the ImageWarm annotation holding the span context,
+// in the W3C traceparent format, of the span of the controller that created
+// or last changed the ImageWarm.
+const TraceParentAnnotation = caching.GroupName + "/traceparent"
+
+// Names of the spans of the warm pipeline.
+const (
+	SpanImageFanOut        = "image_fan_out"
+	SpanImageWarmApply     = "imagewarm_apply"
+	SpanImageWarmReconcile = "imagewarm_reconcile"
+	SpanCredentialLookup   = "credential_lookup"
+	SpanPullQueueWait      = "pull_queue_wait"
+	SpanPullSlotWait       = "pull_slot_wait"
+	SpanRuntimePull        = "runtime_pull"
+)
+
+const traceParentVersion = "00"
+
+// Setup exports the spans of the component as configured by the
+// config-tracing ConfigMap, following its updates.
+func Setup(ctx context.Context, cmw configmap.Watcher, component string) error {
+	return pkgtracing.SetupDynamicPublishing(logging.FromContext(ctx), cmw, component, tracingconfig.ConfigName)
+}
+
+// TraceParent formats the span context in the W3C traceparent format.
+func TraceParent(sc trace.SpanContext) string {
+	return fmt.Sprintf("%s-%s-%s-%02x", traceParentVersion,
+		hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), uint8(sc.TraceOptions))
+}
+
+// ParseTraceParent parses a span context in the W3C traceparent format.
+func ParseTraceParent(value string) (trace.SpanContext, bool) {
+	var sc trace.SpanContext
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 || parts[0] != traceParentVersion {
+		return sc, false
+	}
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != len(sc.TraceID) {
+		return sc, false
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != len(sc.SpanID) {
+		return sc, false
+	}
+	options, err := hex.DecodeString(parts[3])
+	if err != nil || len(options) != 1 {
+		return sc, false
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.TraceOptions = trace.TraceOptions(options[0])
+	return sc, true
+}
+
+// StartSpanFromAnnotations starts a span, child of the span context held in
+// annotations, or a new trace when there is none.
+func StartSpanFromAnnotations(ctx context.Context, name string, annotations map[string]string) (context.Context, *trace.Span) {
+	if parent, ok := ParseTraceParent(annotations[TraceParentAnnotation]); ok {
+		return trace.StartSpanWithRemoteParent(ctx, name, parent)
+	}
+	return trace.StartSpan(ctx, name)
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+// memoryExporter keeps the exported spans in memory.
+type memoryExporter struct {
+	sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (e *memoryExporter) ExportSpan(s *trace.SpanData) {
+	e.Lock()
+	defer e.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+func (e *memoryExporter) span(name string) *trace.SpanData {
+	e.Lock()
+	defer e.Unlock()
+	for _, s := range e.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestTraceParent(t *testing.T) {
+	sc := trace.SpanContext{
+		TraceID:      trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:       trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceOptions: 1,
+	}
+	const want = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if got := TraceParent(sc); got != want {
+		t.Errorf("TraceParent() = %s, want %s", got, want)
+	}
+	if got, ok := ParseTraceParent(want); !ok || got != sc {
+		t.Errorf("ParseTraceParent() = %v, %v, want %v", got, ok, sc)
+	}
+
+	for _, value := range []string{"", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "00-4bf9-00f067aa0ba902b7-01", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz"} {
+		if _, ok := ParseTraceParent(value); ok {
+			t.Errorf("ParseTraceParent(%q) succeeded, want failure", value)
+		}
+	}
+}
+
+func TestStartSpanFromAnnotations(t *testing.T) {
+	exporter := &memoryExporter{}
+	trace.RegisterExporter(exporter)
+	defer trace.UnregisterExporter(exporter)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(1e-4)})
+
+	_, parent := trace.StartSpan(context.Background(), SpanImageWarmApply)
+	annotations := map[string]string{TraceParentAnnotation: TraceParent(parent.SpanContext())}
+	parent.End()
+
+	_, child := StartSpanFromAnnotations(context.Background(), SpanImageWarmReconcile, annotations)
+	child.End()
+	_, orphan := StartSpanFromAnnotations(context.Background(), SpanImageWarmReconcile, nil)
+	orphan.End()
+
+	got := exporter.span(SpanImageWarmReconcile)
+	if got == nil {
+		t.Fatalf("Span %s was not exported", SpanImageWarmReconcile)
+	}
+	if got.TraceID != parent.SpanContext().TraceID || got.ParentSpanID != parent.SpanContext().SpanID {
+		t.Errorf("Span %s has trace %s and parent %s, want trace %s and parent %s", got.Name,
+			got.TraceID, got.ParentSpanID, parent.SpanContext().TraceID, parent.SpanContext().SpanID)
+	}
+	if !got.HasRemoteParent {
+		t.Errorf("Span %s does not have a remote parent", got.Name)
+	}
+	if orphan.SpanContext().TraceID == parent.SpanContext().TraceID {
+		t.Error("Span without a parent in the annotations joined the trace")
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package warmer
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+
+	"knative.dev/cache-imagewarm/pkg/warmer/archive"
+)
+
+// ArchiveDirEnv is the directory of the node holding the image archives,
+// mounted at the same path in the warmer. Unset, the warmer reads no archive
+// from the node.
+const ArchiveDirEnv = "ARCHIVE_DIR"
+
+func newArchiveLoader(ctx context.Context) *archive.Loader {
+	return &archive.Loader{
+		Dir:        os.Getenv(ArchiveDirEnv),
+		KubeClient: kubeclient.Get(ctx),
+		HTTPClient: http.DefaultClient,
+	}
+}
@@ -0,0 +1,334 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"knative.dev/pkg/logging"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/warmer/cri"
+)
+
+// Loader loads images from archives into the container runtime.
+type Loader struct {
+	// Dir is the directory of the node holding the image archives, mounted
+	// at the same path in the warmer. The archives on the node, and the
+	// volumes they are read from, must be under it.
+	Dir string
+
+	KubeClient kubernetes.Interface
+	HTTPClient *http.Client
+}
+
+// Load fetches the archive, verifies that it holds the expected image, and
+// loads that image into imageService tagged as imageRef. It returns where the
+// archive was loaded from.
+func (l *Loader) Load(ctx context.Context, imageService cri.ImageService, imageRef, namespace string, archive *v1alpha1.ImageArchive) (string, error) {
+	logger := logging.FromContext(ctx)
+
+	tag, err := name.NewTag(imageRef)
+	if err != nil {
+		return "", fmt.Errorf("image %s loaded from an archive must be referenced by tag, err: %w", imageRef, err)
+	}
+
+	path, location, cleanup, err := l.fetch(ctx, namespace, archive)
+	defer cleanup()
+	if err != nil {
+		return location, err
+	}
+
+	img, cleanupImage, err := readImage(path, archive.Format)
+	defer cleanupImage()
+	if err != nil {
+		return location, fmt.Errorf("failed to read %s archive %s, err: %w", archive.Format, location, err)
+	}
+	if err := verifyDigest(img, archive.Digest); err != nil {
+		return location, err
+	}
+
+	logger.Infof("Loading image %s from archive %s", imageRef, location)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(tarball.Write(tag, img, pw))
+	}()
+	err = imageService.LoadImage(ctx, pr)
+	pr.Close()
+	return location, err
+}
+
+// fetch returns a local path to the archive, and a cleanup function that must
+// be called once the archive is no longer needed.
+func (l *Loader) fetch(ctx context.Context, namespace string, archive *v1alpha1.ImageArchive) (string, string, func(), error) {
+	noop := func() {}
+
+	switch {
+	case archive.HostPath != "":
+		location := "hostPath:" + archive.HostPath
+		path, err := l.nodePath(archive.HostPath)
+		return path, location, noop, err
+
+	case archive.PersistentVolumeClaim != nil:
+		source := archive.PersistentVolumeClaim
+		location := fmt.Sprintf("persistentVolumeClaim:%s/%s", namespace, source.ClaimName)
+		dir, err := l.volumePath(ctx, namespace, source.ClaimName)
+		if err != nil {
+			return "", location, noop, err
+		}
+		path := filepath.Join(dir, source.Path)
+		if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return "", location, noop, fmt.Errorf("archive path %s escapes the volume", source.Path)
+		}
+		return path, location, noop, nil
+
+	case archive.URL != "":
+		if err := checkURL(ctx, archive.URL); err != nil {
+			return "", archive.URL, noop, err
+		}
+		path, err := l.download(ctx, archive.URL)
+		if err != nil {
+			return "", archive.URL, noop, err
+		}
+		return path, archive.URL, func() { os.Remove(path) }, nil
+	}
+	return "", "", noop, fmt.Errorf("archive has no location")
+}
+
+// volumePath returns the path of the volume bound to the claim. Only volumes
+// backed by a directory on the node, under Dir, can be read by the warmer.
+func (l *Loader) volumePath(ctx context.Context, namespace, claimName string) (string, error) {
+	pvc, err := l.KubeClient.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, claimName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if pvc.Spec.VolumeName == "" {
+		return "", fmt.Errorf("persistentVolumeClaim %s/%s is not bound", namespace, claimName)
+	}
+	pv, err := l.KubeClient.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case pv.Spec.HostPath != nil:
+		return l.nodePath(pv.Spec.HostPath.Path)
+	case pv.Spec.Local != nil:
+		return l.nodePath(pv.Spec.Local.Path)
+	}
+	return "", fmt.Errorf("persistentVolume %s is neither a hostPath nor a local volume", pv.Name)
+}
+
+// nodePath checks that path, on the node, is under the archive directory.
+func (l *Loader) nodePath(path string) (string, error) {
+	if l.Dir == "" {
+		return "", fmt.Errorf("no archive directory is mounted to read %s from the node", path)
+	}
+	dir := filepath.Clean(l.Dir)
+	path = filepath.Clean(path)
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is not under the archive directory %s", path, dir)
+	}
+	return path, nil
+}
+
+// checkURL checks that the archive is downloaded over HTTP(S) from one of
+// the hosts allowed by the settings.
+func checkURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("archive URL %s must be http or https", rawURL)
+	}
+	if !config.FromContextOrDefaults(ctx).Settings.ArchiveURLHosts.Has(strings.ToLower(u.Host)) {
+		return fmt.Errorf("archive URL host %s is not allowed", u.Host)
+	}
+	return nil
+}
+
+// download spools the archive to a temporary file, since reading an archive
+// needs random access.
+func (l *Loader) download(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	// Redirects must stay on the allowed hosts too.
+	client := *l.HTTPClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after %d redirects", len(via))
+		}
+		return checkURL(ctx, req.URL.String())
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download archive %s: %s", url, resp.Status)
+	}
+
+	f, err := ioutil.TempFile("", "archive")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// readImage reads the image held in the archive at path.
+func readImage(path string, format v1alpha1.ArchiveFormat) (v1.Image, func(), error) {
+	noop := func() {}
+
+	switch format {
+	case v1alpha1.ArchiveFormatDocker:
+		img, err := tarball.ImageFromPath(path, nil)
+		return img, noop, err
+
+	case v1alpha1.ArchiveFormatOCI:
+		dir, err := ioutil.TempDir("", "oci-layout")
+		if err != nil {
+			return nil, noop, err
+		}
+		cleanup := func() { os.RemoveAll(dir) }
+		if err := untar(path, dir); err != nil {
+			return nil, cleanup, err
+		}
+		img, err := layoutImage(dir)
+		return img, cleanup, err
+	}
+	return nil, noop, fmt.Errorf("unknown archive format %q", format)
+}
+
+// layoutImage returns the image in the OCI layout matching this node's
+// platform, or the only image when the layout does not say.
+func layoutImage(dir string) (v1.Image, error) {
+	index, err := layout.ImageIndexFromPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var images []v1.Descriptor
+	for _, desc := range manifest.Manifests {
+		if desc.MediaType.IsImage() {
+			images = append(images, desc)
+		}
+	}
+	for _, desc := range images {
+		if desc.Platform != nil && desc.Platform.OS == runtime.GOOS && desc.Platform.Architecture == runtime.GOARCH {
+			return index.Image(desc.Digest)
+		}
+	}
+	if len(images) == 1 {
+		return index.Image(images[0].Digest)
+	}
+	return nil, fmt.Errorf("found %d images in the OCI layout, none for %s/%s", len(images), runtime.GOOS, runtime.GOARCH)
+}
+
+// untar extracts the regular files and directories of the tarball at path into dir.
+func untar(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, hdr.Name)
+		if !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry %s escapes the layout", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.Create(target)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// verifyDigest checks that img is the expected image, by manifest digest or image ID.
+func verifyDigest(img v1.Image, want string) error {
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	id, err := img.ConfigName()
+	if err != nil {
+		return err
+	}
+	if digest.String() != want && id.String() != want {
+		return fmt.Errorf("archive holds image %s (ID %s), want %s", digest, id, want)
+	}
+	return nil
+}
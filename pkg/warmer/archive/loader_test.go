@@ -0,0 +1,299 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"k8s.io/apimachinery/pkg/util/sets"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/warmer/cri"
+)
+
+const imageRef = "registry.example.com/knative/helloworld:v1"
+
+// loadingImageService records the images loaded into it.
+type loadingImageService struct {
+	cri.ImageService
+	loaded []v1.Image
+}
+
+func (s *loadingImageService) LoadImage(ctx context.Context, archive io.Reader) error {
+	data, err := ioutil.ReadAll(archive)
+	if err != nil {
+		return err
+	}
+	img, err := tarball.Image(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+	s.loaded = append(s.loaded, img)
+	return nil
+}
+
+func TestLoad(t *testing.T) {
+	ctx := logtesting.TestContextWithLogger(t)
+
+	hostRoot, err := ioutil.TempDir("", "host")
+	if err != nil {
+		t.Fatal("TempDir() =", err)
+	}
+	defer os.RemoveAll(hostRoot)
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal("random.Image() =", err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal("Digest() =", err)
+	}
+	writeDockerArchive(t, filepath.Join(hostRoot, "image.tar"), img)
+	writeOCIArchive(t, hostRoot, filepath.Join(hostRoot, "image-oci.tar"), img)
+
+	tests := []struct {
+		name    string
+		archive v1alpha1.ImageArchive
+		wantErr bool
+	}{{
+		name: "docker archive",
+		archive: v1alpha1.ImageArchive{
+			Format:   v1alpha1.ArchiveFormatDocker,
+			Digest:   digest.String(),
+			HostPath: filepath.Join(hostRoot, "image.tar"),
+		},
+	}, {
+		name: "oci archive",
+		archive: v1alpha1.ImageArchive{
+			Format:   v1alpha1.ArchiveFormatOCI,
+			Digest:   digest.String(),
+			HostPath: filepath.Join(hostRoot, "image-oci.tar"),
+		},
+	}, {
+		name: "digest mismatch",
+		archive: v1alpha1.ImageArchive{
+			Format:   v1alpha1.ArchiveFormatDocker,
+			Digest:   "sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			HostPath: filepath.Join(hostRoot, "image.tar"),
+		},
+		wantErr: true,
+	}, {
+		name: "missing archive",
+		archive: v1alpha1.ImageArchive{
+			Format:   v1alpha1.ArchiveFormatDocker,
+			Digest:   digest.String(),
+			HostPath: filepath.Join(hostRoot, "missing.tar"),
+		},
+		wantErr: true,
+	}, {
+		name: "outside the archive directory",
+		archive: v1alpha1.ImageArchive{
+			Format:   v1alpha1.ArchiveFormatDocker,
+			Digest:   digest.String(),
+			HostPath: filepath.Join(hostRoot, "..", filepath.Base(hostRoot)+"-other", "image.tar"),
+		},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			imageService := &loadingImageService{}
+			loader := &Loader{Dir: hostRoot}
+
+			_, err := loader.Load(ctx, imageService, imageRef, "default", &test.archive)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Load() = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				if len(imageService.loaded) != 0 {
+					t.Error("Load() loaded an image into the runtime despite failing")
+				}
+				return
+			}
+			if len(imageService.loaded) != 1 {
+				t.Fatalf("Load() loaded %d images, want 1", len(imageService.loaded))
+			}
+			got, err := imageService.loaded[0].ConfigName()
+			if err != nil {
+				t.Fatal("ConfigName() =", err)
+			}
+			if want, _ := img.ConfigName(); got != want {
+				t.Errorf("loaded image ID = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archives")
+	if err != nil {
+		t.Fatal("TempDir() =", err)
+	}
+	defer os.RemoveAll(dir)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal("random.Image() =", err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal("Digest() =", err)
+	}
+	writeDockerArchive(t, filepath.Join(dir, "image.tar"), img)
+
+	archives := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer archives.Close()
+	redirects := httptest.NewServer(http.RedirectHandler(archives.URL+"/image.tar", http.StatusFound))
+	defer redirects.Close()
+	archivesHost := strings.TrimPrefix(archives.URL, "http://")
+	redirectsHost := strings.TrimPrefix(redirects.URL, "http://")
+
+	tests := []struct {
+		name    string
+		url     string
+		hosts   sets.String
+		wantErr bool
+	}{{
+		name:  "allowed host",
+		url:   archives.URL + "/image.tar",
+		hosts: sets.NewString(archivesHost),
+	}, {
+		name:    "no allowed host",
+		url:     archives.URL + "/image.tar",
+		hosts:   sets.NewString(),
+		wantErr: true,
+	}, {
+		name:    "redirect to another host",
+		url:     redirects.URL,
+		hosts:   sets.NewString(redirectsHost),
+		wantErr: true,
+	}, {
+		name:  "redirect to an allowed host",
+		url:   redirects.URL,
+		hosts: sets.NewString(redirectsHost, archivesHost),
+	}, {
+		name:    "unsupported scheme",
+		url:     "file://" + filepath.Join(dir, "image.tar"),
+		hosts:   sets.NewString(""),
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := config.ToContext(logtesting.TestContextWithLogger(t), &config.Config{
+				Settings: &config.Settings{ArchiveURLHosts: test.hosts},
+			})
+			imageService := &loadingImageService{}
+			loader := &Loader{HTTPClient: http.DefaultClient}
+
+			_, err := loader.Load(ctx, imageService, imageRef, "default", &v1alpha1.ImageArchive{
+				Format: v1alpha1.ArchiveFormatDocker,
+				Digest: digest.String(),
+				URL:    test.url,
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Load() = %v, wantErr %v", err, test.wantErr)
+			}
+			wantLoaded := 1
+			if test.wantErr {
+				wantLoaded = 0
+			}
+			if len(imageService.loaded) != wantLoaded {
+				t.Errorf("Load() loaded %d images, want %d", len(imageService.loaded), wantLoaded)
+			}
+		})
+	}
+}
+
+func writeDockerArchive(t *testing.T, path string, img v1.Image) {
+	tag, err := name.NewTag(imageRef)
+	if err != nil {
+		t.Fatal("NewTag() =", err)
+	}
+	if err := tarball.WriteToFile(path, tag, img); err != nil {
+		t.Fatal("WriteToFile() =", err)
+	}
+}
+
+// writeOCIArchive writes img as an OCI layout, and tars the layout up at path.
+func writeOCIArchive(t *testing.T, tmpDir, path string, img v1.Image) {
+	dir, err := ioutil.TempDir(tmpDir, "layout")
+	if err != nil {
+		t.Fatal("TempDir() =", err)
+	}
+	p, err := layout.Write(dir, empty.Index)
+	if err != nil {
+		t.Fatal("layout.Write() =", err)
+	}
+	if err := p.AppendImage(img); err != nil {
+		t.Fatal("AppendImage() =", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal("Create() =", err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	defer tw.Close()
+	err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || file == dir {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name, _ = filepath.Rel(dir, file)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal("tar layout =", err)
+	}
+}
@@ -18,27 +18,42 @@ package warmer
 
 import (
 	"context"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
-	secretinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/secret"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
+	"knative.dev/pkg/system"
 
+	"knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
 	servingclient "knative.dev/cache-imagewarm/pkg/client/injection/client"
 	imagewarmerinformer "knative.dev/cache-imagewarm/pkg/client/injection/informers/caching/v1alpha1/imagewarm"
+	nodewarmplaninformer "knative.dev/cache-imagewarm/pkg/client/injection/informers/caching/v1alpha1/nodewarmplan"
 	imagewarmreconciler "knative.dev/cache-imagewarm/pkg/client/injection/reconciler/caching/v1alpha1/imagewarm"
-	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+	nodewarmplanreconciler "knative.dev/cache-imagewarm/pkg/client/injection/reconciler/caching/v1alpha1/nodewarmplan"
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/pullbudget"
+	"knative.dev/cache-imagewarm/pkg/resync"
+	"knative.dev/cache-imagewarm/pkg/tracing"
+	"knative.dev/cache-imagewarm/pkg/warmer/credential"
 	"knative.dev/cache-imagewarm/pkg/warmer/cri/docker"
 	"knative.dev/cache-imagewarm/pkg/warmer/images"
+	"knative.dev/cache-imagewarm/pkg/warmer/inventory"
 	"knative.dev/cache-imagewarm/pkg/warmer/reconciler"
 )
 
-// Recheck image every 10 minutes
-const ControllerResyncPerion = 5 * time.Second
-const DockerRuntimeURI = "unix:///var/run/docker.sock"
+// secretCacheTTL bounds how long the warmer pulls with a Secret after it changed.
+const secretCacheTTL = time.Minute
+
+// NodeEventsEnv enables recording the Events about pulls on the Node too.
+const NodeEventsEnv = "NODE_EVENTS"
 
 // NewWarmDaemon creates a Reconciler and returns the result of NewImpl.
 func NewWarmDaemon(
@@ -48,59 +63,161 @@ func NewWarmDaemon(
 	logger := logging.FromContext(ctx)
 
 	imageWarmInformer := imagewarmerinformer.Get(ctx)
-	secretInformer := secretinformer.Get(ctx)
 
-	r := &reconciler.Reconciler{
-		ImageWarmerLister: imageWarmInformer.Lister(),
-		Secretlister:      secretInformer.Lister(),
-		ImageWarmClient:   servingclient.Get(ctx),
+	r, configStore, err := sharedReconciler(ctx, cmw)
+	if err != nil {
+		logger.Errorf("err:%#v", err)
+		return nil
+	}
+	impl := imagewarmreconciler.NewImpl(ctx, r, func(impl *controller.Impl) controller.Options {
+		return controller.Options{ConfigStore: configStore}
+	})
+
+	if err := tracing.Setup(ctx, cmw, "warmer"); err != nil {
+		logger.Errorf("Failed to set up tracing, err: %v", err)
 	}
-	impl := imagewarmreconciler.NewImpl(ctx, r)
 
 	logger.Info("Setting up event handlers.")
 
-	imageWarmInformer.Informer().AddEventHandlerWithResyncPeriod(cache.FilteringResourceEventHandler{
-		FilterFunc: FilterWithLabel(imagewarm.NodeLabelKey, reconciler.NodeName),
-		Handler: cache.ResourceEventHandlerFuncs{
-			AddFunc:    impl.EnqueueControllerOf,
-			UpdateFunc: controller.PassNew(impl.EnqueueControllerOf),
-		},
-	}, ControllerResyncPerion)
+	// The informer only holds the ImageWarms of the node, see withNodeInformerFactory.
+	imageWarmInformer.Informer().AddEventHandler(controller.HandleAll(impl.Enqueue))
+	resync.Every(ctx, warmerResyncPeriod(configStore), func() {
+		impl.GlobalResync(imageWarmInformer.Informer())
+	})
+
+	return impl
+}
+
+// NewPlanWarmDaemon creates a PlanReconciler for the NodeWarmPlan of the node
+// and returns the result of NewImpl.
+func NewPlanWarmDaemon(
+	ctx context.Context,
+	cmw configmap.Watcher,
+) *controller.Impl {
+	logger := logging.FromContext(ctx)
 
-	imageService, err := docker.NewDockerImageService(DockerRuntimeURI)
+	planInformer := nodewarmplaninformer.Get(ctx)
+
+	r, configStore, err := sharedReconciler(ctx, cmw)
 	if err != nil {
 		logger.Errorf("err:%#v", err)
 		return nil
 	}
+	impl := nodewarmplanreconciler.NewImpl(ctx, &reconciler.PlanReconciler{Warmer: r, PlanLister: planInformer.Lister()}, func(impl *controller.Impl) controller.Options {
+		return controller.Options{ConfigStore: configStore}
+	})
+
+	logger.Info("Setting up event handlers.")
+
+	planInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: planOfNode,
+		Handler:    controller.HandleAll(impl.Enqueue),
+	})
+	resync.Every(ctx, warmerResyncPeriod(configStore), func() {
+		impl.FilteredGlobalResync(planOfNode, planInformer.Informer())
+	})
+
+	return impl
+}
+
+// planOfNode filters the NodeWarmPlans of the node of the warmer, its shards.
+func planOfNode(obj interface{}) bool {
+	plan, ok := obj.(*v1alpha1.NodeWarmPlan)
+	return ok && plan.Spec.NodeName == reconciler.NodeName
+}
+
+// shared holds the Reconciler of the ImageWarm and NodeWarmPlan controllers,
+// so that both pull through the same puller and publish the same inventory,
+// and the config store they and the puller read their settings from.
+var shared struct {
+	once  sync.Once
+	r     *reconciler.Reconciler
+	store *config.Store
+	err   error
+}
+
+// sharedReconciler returns the shared Reconciler and config store, set up and
+// started by the first controller asking for them.
+func sharedReconciler(ctx context.Context, cmw configmap.Watcher) (*reconciler.Reconciler, *config.Store, error) {
+	shared.once.Do(func() {
+		logger := logging.FromContext(ctx)
+		logger.Info("Setting up ConfigMap receivers")
+		shared.store = config.NewStore(logger.Named("config-store"))
+		shared.store.WatchConfigs(cmw)
+		shared.r, shared.err = newReconciler(ctx, shared.store)
+	})
+	return shared.r, shared.store, shared.err
+}
+
+// warmerResyncPeriod returns the current resync period of the warmer.
+func warmerResyncPeriod(store *config.Store) func() time.Duration {
+	return func() time.Duration {
+		return store.LoadSettings().WarmerResyncPeriod
+	}
+}
+
+// newReconciler sets up the Reconciler and starts its puller and inventory,
+// reading their settings from store as they change.
+func newReconciler(ctx context.Context, store *config.Store) (*reconciler.Reconciler, error) {
+	logger := logging.FromContext(ctx)
+
+	imageWarmInformer := imagewarmerinformer.Get(ctx)
+
+	r := &reconciler.Reconciler{
+		ImageWarmerLister: imageWarmInformer.Lister(),
+		Secrets:           credential.NewSecretCache(kubeclient.Get(ctx), secretCacheTTL),
+		ImageWarmClient:   servingclient.Get(ctx),
+	}
 
-	puller := images.NewSerialImagePuller(imageService)
+	imageService, err := docker.NewDockerImageService(store.LoadSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	distributor, err := newPeerDistributor(ctx, servingclient.Get(ctx))
+	if err != nil {
+		logger.Errorf("Failed to set up peer distribution, pulling from registries only. err: %v", err)
+	}
+
+	budget, err := newPullBudget(ctx)
+	if err != nil {
+		logger.Errorf("Failed to set up pull budgets, pulling without slots. err: %v", err)
+	}
+
+	puller := images.NewSerialImagePuller(imageService, distributor, budget, func() int {
+		return store.LoadSettings().MaxImagePullRequests
+	})
 
 	r.ImagePuller = puller
+	r.Distributor = distributor
+	r.ArchiveLoader = newArchiveLoader(ctx)
+	r.Inventory = inventory.NewPublisher(reconciler.NodeName, imageService, servingclient.Get(ctx),
+		kubeclient.Get(ctx), imageWarmInformer, nodewarmplaninformer.Get(ctx))
+	r.Inventory.Start(ctx)
+	r.NodeEvents, _ = strconv.ParseBool(os.Getenv(NodeEventsEnv))
 
 	puller.Start()
 	logger.Info("Setting up ImagePuller")
 
-	return impl
+	return r, nil
 }
 
-// FilterWithLabel makes it simple to create FilterFunc's for use with
-// cache.FilteringResourceEventHandler that filter based on a label .
-func FilterWithLabel(labelKey, labelValue string) func(obj interface{}) bool {
-	return func(obj interface{}) bool {
-		object, ok := obj.(metav1.Object)
-		if !ok {
-			return false
-		}
-
-		if len(object.GetLabels()) == 0 {
-			return false
-		}
-
-		value, exists := object.GetLabels()[labelKey]
-		if !exists {
-			return false
-		} else {
-			return value == labelValue
-		}
+// newPullBudget returns the PullBudget acquiring the pull slots the controller
+// keeps in the system namespace, once the slots of a previous instance of the
+// warmer are released.
+func newPullBudget(ctx context.Context) (images.PullBudget, error) {
+	kubeClient := kubeclient.Get(ctx)
+	factory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, 0,
+		kubeinformers.WithNamespace(system.Namespace()),
+		kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = pullbudget.RegistryLabelKey
+		}))
+	leaseInformer := factory.Coordination().V1().Leases()
+	acquirer := pullbudget.NewAcquirer(kubeClient, leaseInformer.Lister(), system.Namespace(), reconciler.NodeName)
+	if err := acquirer.ReleaseAll(ctx); err != nil {
+		return nil, err
 	}
+	leaseInformer.Informer()
+	factory.Start(ctx.Done())
+	return acquirer, nil
 }
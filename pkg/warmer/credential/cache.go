@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credential
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SecretCache gets the Secrets referenced by the images to pull from the API
+// server, and keeps them, or the fact that they do not exist, for a while. The
+// warmer reads the few Secrets it needs instead of watching all of them.
+type SecretCache struct {
+	client kubernetes.Interface
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[types.NamespacedName]secretEntry
+}
+
+type secretEntry struct {
+	secret  *v1.Secret
+	err     error
+	fetched time.Time
+}
+
+// NewSecretCache creates a SecretCache keeping the Secrets for ttl.
+func NewSecretCache(client kubernetes.Interface, ttl time.Duration) *SecretCache {
+	return &SecretCache{
+		client:  client,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[types.NamespacedName]secretEntry),
+	}
+}
+
+// Get returns the Secret namespace/name, from the cache when got less than
+// ttl ago. Only NotFound errors are cached, the others are retried.
+func (c *SecretCache) Get(ctx context.Context, namespace, name string) (*v1.Secret, error) {
+	key := types.NamespacedName{Namespace: namespace, Name: name}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && c.now().Sub(entry.fetched) < c.ttl {
+		return entry.secret, entry.err
+	}
+
+	secret, err := c.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case err == nil || apierrs.IsNotFound(err):
+		c.entries[key] = secretEntry{secret: secret, err: err, fetched: c.now()}
+	default:
+		delete(c.entries, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
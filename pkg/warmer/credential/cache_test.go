@@ -0,0 +1,70 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credential
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSecretCache(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "registry"},
+		Data:       map[string][]byte{"key": []byte("v1")},
+	})
+	now := time.Now()
+	c := NewSecretCache(client, time.Minute)
+	c.now = func() time.Time { return now }
+
+	gets := func() int {
+		n := 0
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "get" {
+				n++
+			}
+		}
+		return n
+	}
+
+	for k := 0; k < 2; k++ {
+		if secret, err := c.Get(ctx, "default", "registry"); err != nil || string(secret.Data["key"]) != "v1" {
+			t.Fatalf("Get() = %v, %v, want the secret", secret, err)
+		}
+		if _, err := c.Get(ctx, "default", "missing"); !apierrs.IsNotFound(err) {
+			t.Fatalf("Get() = %v, want NotFound", err)
+		}
+	}
+	if got := gets(); got != 2 {
+		t.Errorf("got %d secrets from the API server, want 2", got)
+	}
+
+	client.CoreV1().Secrets("default").Update(ctx, &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "registry"},
+		Data:       map[string][]byte{"key": []byte("v2")},
+	}, metav1.UpdateOptions{})
+	now = now.Add(time.Minute)
+	if secret, err := c.Get(ctx, "default", "registry"); err != nil || string(secret.Data["key"]) != "v2" {
+		t.Errorf("Get() = %v, %v, want the updated secret once expired", secret, err)
+	}
+}
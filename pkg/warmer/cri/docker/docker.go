@@ -22,47 +22,50 @@ import (
 	"fmt"
 	"io"
 	"sync"
-	"time"
 
 	dockertypes "github.com/docker/docker/api/types"
 	dockerapi "github.com/docker/docker/client"
 	dockermessage "github.com/docker/docker/pkg/jsonmessage"
+	"go.opencensus.io/trace"
 	v1 "k8s.io/api/core/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"knative.dev/pkg/logging"
 
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/tracing"
 	"knative.dev/cache-imagewarm/pkg/warmer/cri"
 	"knative.dev/cache-imagewarm/pkg/warmer/utils"
 )
 
-// NewDockerImageService create a docker runtime
-func NewDockerImageService(runtimeURI string) (cri.ImageService, error) {
-	r := &dockerImageService{runtimeURI: runtimeURI}
-	if err := r.createRuntimeClientIfNecessary(); err != nil {
+// NewDockerImageService create a docker runtime, reading the address of the
+// docker daemon and the timeouts from settings on every operation.
+func NewDockerImageService(settings func() *config.Settings) (cri.ImageService, error) {
+	r := &dockerImageService{settings: settings}
+	if _, err := r.runtimeClient(); err != nil {
 		return nil, err
 	}
-	r.imagePullProgressDeadline = 5 * time.Minute
 	return r, nil
 }
 
 type dockerImageService struct {
 	sync.Mutex
-	runtimeURI string
 	//accountManager utils.ImagePullAccountManager
 
-	client *dockerapi.Client
+	// settings returns the current runtime URI, the timeout of short running
+	// docker operations and the image pull progress deadline: if no pulling
+	// progress is made before it, the image pulling will be cancelled.
+	// Docker reports image progress for every 512kB block, so normally there
+	// shouldn't be too long interval between progress updates.
+	settings func() *config.Settings
 
-	// timeout is the timeout of short running docker operations.
-	timeout time.Duration
-	// If no pulling progress is made before imagePullProgressDeadline, the image pulling will be cancelled.
-	// Docker reports image progress for every 512kB block, so normally there shouldn't be too long interval
-	// between progress updates.
-	imagePullProgressDeadline time.Duration
+	// client is the client of the docker daemon at runtimeURI.
+	client     *dockerapi.Client
+	runtimeURI string
 }
 
 // getTimeoutContext returns a new context with default request timeout
 func (d *dockerImageService) getTimeoutContext() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), d.timeout)
+	return context.WithTimeout(context.Background(), d.settings().DockerTimeout)
 }
 
 // operationTimeout is the error returned when the docker operations are timeout.
@@ -83,10 +86,14 @@ func contextError(ctx context.Context) error {
 }
 
 func (d *dockerImageService) RemoveImage(imageRef string) error {
+	client, err := d.runtimeClient()
+	if err != nil {
+		return err
+	}
 	ctx, cancel := d.getTimeoutContext()
 	defer cancel()
 
-	_, err := d.client.ImageRemove(ctx, imageRef, dockertypes.ImageRemoveOptions{Force: true, PruneChildren: true})
+	_, err = client.ImageRemove(ctx, imageRef, dockertypes.ImageRemoveOptions{Force: true, PruneChildren: true})
 	if ctxErr := contextError(ctx); ctxErr != nil {
 		return ctxErr
 	}
@@ -96,18 +103,58 @@ func (d *dockerImageService) RemoveImage(imageRef string) error {
 	return err
 }
 
-func (d *dockerImageService) createRuntimeClientIfNecessary() error {
+func (d *dockerImageService) TagImage(ctx context.Context, sourceRef, targetRef string) error {
+	client, err := d.runtimeClient()
+	if err != nil {
+		return err
+	}
+	return client.ImageTag(ctx, sourceRef, targetRef)
+}
+
+func (d *dockerImageService) LoadImage(ctx context.Context, archive io.Reader) error {
+	client, err := d.runtimeClient()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ImageLoad(ctx, archive, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg dockermessage.JSONMessage
+		err := decoder.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+	}
+}
+
+// runtimeClient returns the client of the docker daemon at the runtime URI of
+// the settings, created the first time and again when the URI changes.
+func (d *dockerImageService) runtimeClient() (*dockerapi.Client, error) {
+	runtimeURI := d.settings().DockerRuntimeURI
 	d.Lock()
 	defer d.Unlock()
-	if d.client != nil {
-		return nil
+	if d.client != nil && d.runtimeURI == runtimeURI {
+		return d.client, nil
 	}
-	c, err := dockerapi.NewClientWithOpts(dockerapi.WithVersion("1.19"))
+	c, err := dockerapi.NewClientWithOpts(dockerapi.WithHost(runtimeURI), dockerapi.WithVersion("1.19"))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to create the docker client of %s: %w", runtimeURI, err)
 	}
-	d.client = c
-	return nil
+	// The operations in flight keep the previous client, left to the GC.
+	d.client, d.runtimeURI = c, runtimeURI
+	return c, nil
 }
 
 // getCancelableContext returns a new cancelable context. For long running requests without timeout, we use cancelable
@@ -118,25 +165,40 @@ func (d *dockerImageService) getCancelableContext(ctx context.Context) (context.
 
 func (d *dockerImageService) PullImage(ctx context.Context, imageRef string, pullSecret *v1.Secret) (err error) {
 	logger := logging.FromContext(ctx)
+	ctx, span := trace.StartSpan(ctx, tracing.SpanRuntimePull)
+	span.AddAttributes(trace.StringAttribute("image", imageRef))
+	defer func() {
+		if err != nil {
+			span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+		}
+		span.End()
+	}()
 
 	ctx, cancel := d.getCancelableContext(ctx)
 	defer cancel()
-	if err = d.createRuntimeClientIfNecessary(); err != nil {
+	client, err := d.runtimeClient()
+	if err != nil {
 		return err
 	}
 
 	logger.Infof("Docker image service is starting to pull image :%s ", imageRef)
 
-	resp, err := d.doPullImage(ctx, imageRef, pullSecret)
+	resp, err := d.doPullImage(ctx, client, imageRef, pullSecret)
 	if err != nil {
-		return err
+		return classifyError(err)
 	}
 	if resp != nil {
 		defer resp.Close()
 	}
-	reporter := newProgressReporter(ctx, imageRef, cancel, d.imagePullProgressDeadline)
+	reporter := newProgressReporter(ctx, imageRef, cancel, d.settings().ImagePullProgressDeadline)
 	reporter.start()
 	defer reporter.stop()
+	defer func() {
+		if err != nil && reporter.stalled() {
+			err = cri.NewPullError(cri.ReasonTimeout, err)
+		}
+		err = classifyError(err)
+	}()
 	decoder := json.NewDecoder(resp)
 	for {
 		var msg dockermessage.JSONMessage
@@ -154,47 +216,51 @@ func (d *dockerImageService) PullImage(ctx context.Context, imageRef string, pul
 	}
 	return nil
 }
-func (d *dockerImageService) doPullImage(ctx context.Context, imageRef string, pullSecret *v1.Secret) (resp io.ReadCloser, err error) {
+func (d *dockerImageService) doPullImage(ctx context.Context, client *dockerapi.Client, imageRef string, pullSecret *v1.Secret) (resp io.ReadCloser, err error) {
 	logger := logging.FromContext(ctx)
 	registry := utils.ParseRegistry(imageRef)
 
 	if pullSecret == nil {
 		// Anonymous pull
 		logger.Infof("Pull image %s anonymous", imageRef)
-		resp, err = d.client.ImagePull(ctx, imageRef, dockertypes.ImagePullOptions{})
+		resp, err = client.ImagePull(ctx, imageRef, dockertypes.ImagePullOptions{})
 
 		return resp, err
 
 	}
 
-	var authInfos []utils.AuthInfo
-	authInfos, err = cri.ConvertToRegistryAuths(*pullSecret, registry)
-	if err == nil {
-		var pullErrs []error
-		for _, authInfo := range authInfos {
-			var pullErr error
-			logger.Infof("Pull image :%v with user %v", imageRef, authInfo.Username)
-			resp, pullErr = d.client.ImagePull(ctx, imageRef, dockertypes.ImagePullOptions{RegistryAuth: authInfo.EncodeToString()})
-			if pullErr == nil {
-				return resp, nil
-			}
+	authInfos, err := cri.ConvertToRegistryAuths(*pullSecret, registry)
+	if err != nil {
+		return nil, err
+	}
+	if len(authInfos) == 0 {
+		// The pull secret holds no credentials of this registry, e.g. a mirror
+		// of the registry it was created for.
+		logger.Infof("Pull image %s anonymous, no credentials of %s in the pull secret", imageRef, registry)
+		return client.ImagePull(ctx, imageRef, dockertypes.ImagePullOptions{})
+	}
 
-			logger.Errorw("Failed to pull image :%v with user %v, err %v", imageRef, authInfo.Username, pullErr)
-			pullErrs = append(pullErrs, pullErr)
-		}
-		if len(pullErrs) > 0 {
-			err = utilerrors.NewAggregate(pullErrs)
+	var pullErrs []error
+	for _, authInfo := range authInfos {
+		var pullErr error
+		logger.Infof("Pull image :%v with user %v", imageRef, authInfo.Username)
+		resp, pullErr = client.ImagePull(ctx, imageRef, dockertypes.ImagePullOptions{RegistryAuth: authInfo.EncodeToString()})
+		if pullErr == nil {
+			return resp, nil
 		}
-	}
 
-	return resp, err
+		logger.Errorw("Failed to pull image :%v with user %v, err %v", imageRef, authInfo.Username, pullErr)
+		pullErrs = append(pullErrs, classifyError(pullErr))
+	}
+	return nil, utilerrors.NewAggregate(pullErrs)
 }
 
 func (d *dockerImageService) ListImages(ctx context.Context) ([]cri.ImageInfo, error) {
-	if err := d.createRuntimeClientIfNecessary(); err != nil {
+	client, err := d.runtimeClient()
+	if err != nil {
 		return nil, err
 	}
-	infos, err := d.client.ImageList(ctx, dockertypes.ImageListOptions{All: true})
+	infos, err := client.ImageList(ctx, dockertypes.ImageListOptions{All: true})
 	if err != nil {
 		//d.handleRuntimeError(err)
 		return nil, err
@@ -202,6 +268,22 @@ func (d *dockerImageService) ListImages(ctx context.Context) ([]cri.ImageInfo, e
 	return newImageCollectionDocker(infos), nil
 }
 
+func (d *dockerImageService) ImagesInUse(ctx context.Context) ([]string, error) {
+	client, err := d.runtimeClient()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := client.ContainerList(ctx, dockertypes.ContainerListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(containers))
+	for _, container := range containers {
+		ids = append(ids, container.ImageID)
+	}
+	return ids, nil
+}
+
 func newImageCollectionDocker(infos []dockertypes.ImageSummary) []cri.ImageInfo {
 	collection := make([]cri.ImageInfo, 0, len(infos))
 	for _, info := range infos {
@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"context"
+	"errors"
+
+	dockerapi "github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+
+	"knative.dev/cache-imagewarm/pkg/warmer/cri"
+)
+
+// classifyError maps the errors of the docker daemon onto cri.PullErrorReason.
+// Errors already classified, or aggregates of them, are returned unchanged.
+func classifyError(err error) error {
+	if err == nil || cri.ReasonOf(err) != cri.ReasonUnknown {
+		return err
+	}
+
+	var timeout operationTimeout
+	switch {
+	case errors.As(err, &timeout), errors.Is(err, context.DeadlineExceeded):
+		return cri.NewPullError(cri.ReasonTimeout, err)
+	case dockerapi.IsErrConnectionFailed(err):
+		return cri.NewPullError(cri.ReasonRuntimeUnavailable, err)
+	}
+
+	// The daemon reports registry failures in the message, the status code
+	// only tells part of the story, e.g. 404 for a repository needing a login.
+	if reason := cri.ClassifyMessage(err.Error()); reason != cri.ReasonUnknown {
+		return cri.NewPullError(reason, err)
+	}
+	switch {
+	case errdefs.IsNotFound(err):
+		return cri.NewPullError(cri.ReasonNotFound, err)
+	case errdefs.IsUnauthorized(err):
+		return cri.NewPullError(cri.ReasonUnauthorized, err)
+	case errdefs.IsForbidden(err):
+		return cri.NewPullError(cri.ReasonForbidden, err)
+	case errdefs.IsUnavailable(err):
+		return cri.NewPullError(cri.ReasonRuntimeUnavailable, err)
+	}
+	return cri.NewPullError(cri.ReasonUnknown, err)
+}
@@ -5,22 +5,25 @@ import (
 	"fmt"
 	"knative.dev/pkg/logging"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	dockermessage "github.com/docker/docker/pkg/jsonmessage"
+	corev1 "k8s.io/api/core/v1"
+
+	"knative.dev/cache-imagewarm/pkg/warmer/cri"
+	"knative.dev/cache-imagewarm/pkg/warmer/events"
 )
 
 const (
-	// defaultTimeout is the default timeout of short running docker operations.
-	// Value is slightly offset from 2 minutes to make timeouts due to this
-	// constant recognizable.
-	defaultTimeout = 2*time.Minute - 1*time.Second
-
 	// defaultShmSize is the default ShmSize to use (in bytes) if not specified.
 	defaultShmSize = int64(1024 * 1024 * 64)
 
 	// defaultImagePullingProgressReportInterval is the default interval of image pulling progress reporting.
 	defaultImagePullingProgressReportInterval = 10 * time.Second
+
+	// defaultImagePullingProgressEventInterval is the minimum interval between image pulling progress Events.
+	defaultImagePullingProgressEventInterval = time.Minute
 )
 
 // progress is a wrapper of dockermessage.JSONMessage with a lock protecting it.
@@ -30,10 +33,13 @@ type progress struct {
 	message *dockermessage.JSONMessage
 	// timestamp of the latest update.
 	timestamp time.Time
+	// layers stores the progress of every layer, in the order they showed up.
+	layers     []*cri.LayerProgress
+	layerIndex map[string]*cri.LayerProgress
 }
 
 func newProgress() *progress {
-	return &progress{timestamp: time.Now()}
+	return &progress{timestamp: time.Now(), layerIndex: make(map[string]*cri.LayerProgress)}
 }
 
 func (p *progress) set(msg *dockermessage.JSONMessage) {
@@ -41,6 +47,43 @@ func (p *progress) set(msg *dockermessage.JSONMessage) {
 	defer p.Unlock()
 	p.message = msg
 	p.timestamp = time.Now()
+	p.setLayer(msg)
+}
+
+// setLayer records the progress of the layer the message is about, if any.
+func (p *progress) setLayer(msg *dockermessage.JSONMessage) {
+	var done bool
+	switch msg.Status {
+	case "Pulling fs layer", "Waiting", "Downloading":
+	case "Verifying Checksum", "Download complete", "Extracting", "Pull complete", "Already exists":
+		done = true
+	default:
+		return
+	}
+
+	layer, ok := p.layerIndex[msg.ID]
+	if !ok {
+		layer = &cri.LayerProgress{ID: msg.ID}
+		p.layerIndex[msg.ID] = layer
+		p.layers = append(p.layers, layer)
+	}
+	if msg.Progress != nil && msg.Progress.Total > 0 && (!done || layer.Total == 0) {
+		layer.Current, layer.Total = msg.Progress.Current, msg.Progress.Total
+	}
+	if done {
+		layer.Current = layer.Total
+	}
+}
+
+// getLayers returns a copy of the progress of every layer.
+func (p *progress) getLayers() []cri.LayerProgress {
+	p.RLock()
+	defer p.RUnlock()
+	layers := make([]cri.LayerProgress, 0, len(p.layers))
+	for _, layer := range p.layers {
+		layers = append(layers, *layer)
+	}
+	return layers
 }
 
 func (p *progress) get() (string, time.Time) {
@@ -68,6 +111,8 @@ type progressReporter struct {
 	cancel                    context.CancelFunc
 	stopCh                    chan struct{}
 	imagePullProgressDeadline time.Duration
+	// noProgress is set to 1 when the pull was cancelled for making no progress.
+	noProgress int32
 }
 
 // newProgressReporter creates a new progressReporter for specific image with specified reporting interval
@@ -89,18 +134,24 @@ func (p *progressReporter) start() {
 
 		ticker := time.NewTicker(defaultImagePullingProgressReportInterval)
 		defer ticker.Stop()
+		lastEvent := time.Now()
 		for {
-			// TODO(random-liu): Report as events.
 			select {
 			case <-ticker.C:
 				progress, timestamp := p.progress.get()
 				// If there is no progress for p.imagePullProgressDeadline, cancel the operation.
 				if time.Since(timestamp) > p.imagePullProgressDeadline {
 					logger.Errorf("Cancel pulling image %q because of no progress for %v, latest progress: %q", p.image, p.imagePullProgressDeadline, progress)
+					atomic.StoreInt32(&p.noProgress, 1)
 					p.cancel()
 					return
 				}
 				logger.Infof("Pulling image %q: %q", p.image, progress)
+				cri.ReportProgress(p.contex, p.progress.getLayers())
+				if time.Since(lastEvent) >= defaultImagePullingProgressEventInterval {
+					events.Eventf(p.contex, corev1.EventTypeNormal, events.PullProgress, "Pulling image %q: %s", p.image, progress)
+					lastEvent = time.Now()
+				}
 			case <-p.stopCh:
 				progress, _ := p.progress.get()
 				p.cancel()
@@ -111,7 +162,13 @@ func (p *progressReporter) start() {
 	}()
 }
 
-// stop stops the progressReporter
+// stalled reports whether the pull was cancelled for making no progress.
+func (p *progressReporter) stalled() bool {
+	return atomic.LoadInt32(&p.noProgress) == 1
+}
+
+// stop stops the progressReporter, reporting the final progress of the layers.
 func (p *progressReporter) stop() {
+	cri.ReportProgress(p.contex, p.progress.getLayers())
 	close(p.stopCh)
 }
@@ -0,0 +1,54 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"testing"
+
+	dockermessage "github.com/docker/docker/pkg/jsonmessage"
+	"github.com/google/go-cmp/cmp"
+
+	"knative.dev/cache-imagewarm/pkg/warmer/cri"
+)
+
+func TestProgressLayers(t *testing.T) {
+	messages := []dockermessage.JSONMessage{
+		{ID: "v1", Status: "Pulling from knative/helloworld"},
+		{ID: "a1", Status: "Pulling fs layer"},
+		{ID: "b2", Status: "Already exists"},
+		{ID: "c3", Status: "Pulling fs layer"},
+		{ID: "a1", Status: "Downloading", Progress: &dockermessage.JSONProgress{Current: 512, Total: 2048}},
+		{ID: "c3", Status: "Downloading", Progress: &dockermessage.JSONProgress{Current: 100, Total: 1000}},
+		{ID: "c3", Status: "Download complete"},
+		{ID: "c3", Status: "Extracting", Progress: &dockermessage.JSONProgress{Current: 10, Total: 5000}},
+		{Status: "Digest: sha256:3333333333333333333333333333333333333333333333333333333333333333"},
+	}
+
+	p := newProgress()
+	for i := range messages {
+		p.set(&messages[i])
+	}
+
+	want := []cri.LayerProgress{
+		{ID: "a1", Current: 512, Total: 2048},
+		{ID: "b2"},
+		{ID: "c3", Current: 1000, Total: 1000},
+	}
+	if diff := cmp.Diff(want, p.getLayers()); diff != "" {
+		t.Error("getLayers() (-want, +got) =", diff)
+	}
+}
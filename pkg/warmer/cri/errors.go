@@ -0,0 +1,140 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cri
+
+import (
+	"errors"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// PullErrorReason classifies why pulling an image failed. It is used as the
+// reason of the ImageWarm Ready condition.
+type PullErrorReason string
+
+const (
+	// ReasonNotFound is returned when the repository or the tag does not exist.
+	ReasonNotFound PullErrorReason = "ImageNotFound"
+	// ReasonUnauthorized is returned when the registry requires credentials.
+	ReasonUnauthorized PullErrorReason = "Unauthorized"
+	// ReasonForbidden is returned when the credentials do not grant access to the image.
+	ReasonForbidden PullErrorReason = "Forbidden"
+	// ReasonRateLimited is returned when the registry throttles pulls (HTTP 429).
+	ReasonRateLimited PullErrorReason = "RateLimited"
+	// ReasonTimeout is returned when the pull timed out or stopped making progress.
+	ReasonTimeout PullErrorReason = "PullTimeout"
+	// ReasonDiskFull is returned when the node ran out of disk space.
+	ReasonDiskFull PullErrorReason = "DiskFull"
+	// ReasonRuntimeUnavailable is returned when the container runtime cannot be reached.
+	ReasonRuntimeUnavailable PullErrorReason = "RuntimeUnavailable"
+	// ReasonManifestUnknownPlatform is returned when the image has no manifest
+	// for the platform of the node.
+	ReasonManifestUnknownPlatform PullErrorReason = "ManifestUnknownPlatform"
+	// ReasonUnknown is returned for errors that could not be classified.
+	ReasonUnknown PullErrorReason = "Unknown"
+)
+
+// Permanent reports whether pulling again is unlikely to succeed until the
+// image reference or the credentials change.
+func (r PullErrorReason) Permanent() bool {
+	switch r {
+	case ReasonNotFound, ReasonUnauthorized, ReasonForbidden, ReasonManifestUnknownPlatform:
+		return true
+	}
+	return false
+}
+
+// PullError is an error pulling an image, classified by reason.
+type PullError struct {
+	Reason PullErrorReason
+	Err    error
+}
+
+// NewPullError classifies err with reason.
+func NewPullError(reason PullErrorReason, err error) error {
+	return &PullError{Reason: reason, Err: err}
+}
+
+func (e *PullError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PullError) Unwrap() error {
+	return e.Err
+}
+
+// ReasonOf returns the reason err was classified with. The reason of an
+// aggregate is the reason of its last error, i.e. of the last source tried.
+func ReasonOf(err error) PullErrorReason {
+	if agg, ok := err.(utilerrors.Aggregate); ok {
+		if errs := agg.Errors(); len(errs) > 0 {
+			return ReasonOf(errs[len(errs)-1])
+		}
+		return ReasonUnknown
+	}
+	var pullErr *PullError
+	if errors.As(err, &pullErr) {
+		return pullErr.Reason
+	}
+	return ReasonUnknown
+}
+
+// messageReasons maps fragments of the error messages of runtimes and
+// registries to reasons, the more specific ones first.
+var messageReasons = []struct {
+	fragments []string
+	reason    PullErrorReason
+}{{
+	fragments: []string{"no matching manifest", "unknown platform", "does not match the specified platform"},
+	reason:    ReasonManifestUnknownPlatform,
+}, {
+	fragments: []string{"toomanyrequests", "too many requests", "rate limit"},
+	reason:    ReasonRateLimited,
+}, {
+	fragments: []string{"no space left on device", "disk quota exceeded"},
+	reason:    ReasonDiskFull,
+}, {
+	fragments: []string{"cannot connect to the docker daemon", "is the docker daemon running", "containerd.sock: connect"},
+	reason:    ReasonRuntimeUnavailable,
+}, {
+	fragments: []string{"unauthorized", "authentication required", "pull access denied", "incorrect username or password"},
+	reason:    ReasonUnauthorized,
+}, {
+	fragments: []string{"forbidden", "denied"},
+	reason:    ReasonForbidden,
+}, {
+	fragments: []string{"manifest unknown", "not found", "does not exist", "no such image", "name unknown"},
+	reason:    ReasonNotFound,
+}, {
+	fragments: []string{"timeout", "timed out", "deadline exceeded"},
+	reason:    ReasonTimeout,
+}}
+
+// ClassifyMessage classifies an error message returned by a runtime or a
+// registry, for backends that only report errors as strings.
+func ClassifyMessage(message string) PullErrorReason {
+	message = strings.ToLower(message)
+	for _, mr := range messageReasons {
+		for _, fragment := range mr.fragments {
+			if strings.Contains(message, fragment) {
+				return mr.reason
+			}
+		}
+	}
+	return ReasonUnknown
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cri
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestClassifyMessage(t *testing.T) {
+	tests := []struct {
+		message string
+		want    PullErrorReason
+	}{{
+		message: "manifest for gcr.io/knative/helloworld:v9 not found: manifest unknown: manifest unknown",
+		want:    ReasonNotFound,
+	}, {
+		message: "pull access denied for private/helloworld, repository does not exist or may require 'docker login': denied: requested access to the resource is denied",
+		want:    ReasonUnauthorized,
+	}, {
+		message: "Error response from daemon: Head https://gcr.io/v2/project/app/manifests/v1: denied: Permission denied for \"v1\" from request",
+		want:    ReasonForbidden,
+	}, {
+		message: "toomanyrequests: You have reached your pull rate limit.",
+		want:    ReasonRateLimited,
+	}, {
+		message: "write /var/lib/docker/tmp/GetImageBlob123: no space left on device",
+		want:    ReasonDiskFull,
+	}, {
+		message: "Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?",
+		want:    ReasonRuntimeUnavailable,
+	}, {
+		message: "no matching manifest for linux/arm64/v8 in the manifest list entries",
+		want:    ReasonManifestUnknownPlatform,
+	}, {
+		message: "Get https://registry.example.com/v2/: net/http: request canceled while waiting for connection (Client.Timeout exceeded while awaiting headers)",
+		want:    ReasonTimeout,
+	}, {
+		message: "unexpected EOF",
+		want:    ReasonUnknown,
+	}}
+
+	for _, test := range tests {
+		t.Run(string(test.want), func(t *testing.T) {
+			if got := ClassifyMessage(test.message); got != test.want {
+				t.Errorf("ClassifyMessage(%q) = %s, want %s", test.message, got, test.want)
+			}
+		})
+	}
+}
+
+func TestReasonOf(t *testing.T) {
+	notFound := NewPullError(ReasonNotFound, errors.New("manifest unknown"))
+	rateLimited := NewPullError(ReasonRateLimited, errors.New("toomanyrequests"))
+
+	tests := []struct {
+		name string
+		err  error
+		want PullErrorReason
+	}{{
+		name: "unclassified",
+		err:  errors.New("unexpected EOF"),
+		want: ReasonUnknown,
+	}, {
+		name: "classified",
+		err:  notFound,
+		want: ReasonNotFound,
+	}, {
+		name: "wrapped",
+		err:  fmt.Errorf("failed to pull: %w", rateLimited),
+		want: ReasonRateLimited,
+	}, {
+		name: "aggregate reports the last source",
+		err:  utilerrors.NewAggregate([]error{notFound, utilerrors.NewAggregate([]error{rateLimited})}),
+		want: ReasonRateLimited,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ReasonOf(test.err); got != test.want {
+				t.Errorf("ReasonOf() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
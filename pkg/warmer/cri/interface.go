@@ -18,6 +18,7 @@ package cri
 
 import (
 	"context"
+	"io"
 
 	v1 "k8s.io/api/core/v1"
 )
@@ -42,8 +43,14 @@ type ImageService interface {
 	PullImage(ctx context.Context, imageRef string, pullSecret *v1.Secret) error
 	// ListImages lists the existing images.
 	ListImages(ctx context.Context) ([]ImageInfo, error)
+	// ImagesInUse returns the IDs of the images used by running containers.
+	ImagesInUse(ctx context.Context) ([]string, error)
 	// RemoveImage removes the image.
 	RemoveImage(imageRef string) error
+	// TagImage adds the target reference to an image that is already present.
+	TagImage(ctx context.Context, sourceRef, targetRef string) error
+	// LoadImage loads the images of a `docker save` compatible tarball.
+	LoadImage(ctx context.Context, archive io.Reader) error
 }
 
 func (c ImageInfo) ContainsImage(name string, tag string) bool {
@@ -0,0 +1,46 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cri
+
+import "context"
+
+// LayerProgress is the download progress of a layer of the image being pulled.
+type LayerProgress struct {
+	ID string
+	// Current is the number of bytes downloaded.
+	Current int64
+	// Total is the size of the layer, 0 until the runtime knows it.
+	Total int64
+}
+
+// ProgressFunc receives the progress of the layers of the image being pulled.
+type ProgressFunc func(layers []LayerProgress)
+
+type progressFuncKey struct{}
+
+// WithProgressFunc attaches f to ctx, for PullImage to report its progress to.
+func WithProgressFunc(ctx context.Context, f ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressFuncKey{}, f)
+}
+
+// ReportProgress reports the progress of the layers to the ProgressFunc
+// attached to ctx, if any.
+func ReportProgress(ctx context.Context, layers []LayerProgress) {
+	if f, ok := ctx.Value(progressFuncKey{}).(ProgressFunc); ok {
+		f(layers)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package events records the lifecycle of image pulls as Kubernetes Events.
+package events
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"knative.dev/pkg/controller"
+)
+
+// Reasons of the Events recorded about image pulls.
+const (
+	PullStarted   = "PullStarted"
+	PullProgress  = "PullProgress"
+	PullSucceeded = "PullSucceeded"
+	PullFailed    = "PullFailed"
+	PullCancelled = "PullCancelled"
+)
+
+type targetsKey struct{}
+
+// WithTargets attaches the objects the Events about a pull are recorded on,
+// e.g. the ImageWarm and its Node.
+func WithTargets(ctx context.Context, targets ...runtime.Object) context.Context {
+	return context.WithValue(ctx, targetsKey{}, targets)
+}
+
+// Eventf records an Event on every target attached to ctx, through the
+// recorder the reconciler attached to ctx. It is a no-op without either.
+func Eventf(ctx context.Context, eventtype, reason, messageFmt string, args ...interface{}) {
+	recorder := controller.GetEventRecorder(ctx)
+	if recorder == nil {
+		return
+	}
+	targets, _ := ctx.Value(targetsKey{}).([]runtime.Object)
+	for _, target := range targets {
+		recorder.Eventf(target, eventtype, reason, messageFmt, args...)
+	}
+}
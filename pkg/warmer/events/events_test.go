@@ -0,0 +1,50 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/controller"
+)
+
+func TestEventf(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	ctx := controller.WithEventRecorder(context.Background(), recorder)
+
+	// Without targets nothing is recorded.
+	Eventf(ctx, corev1.EventTypeNormal, PullStarted, "Pulling image %q", "helloworld:v1")
+
+	ctx = WithTargets(ctx, &corev1.ObjectReference{Kind: "ImageWarm"}, &corev1.ObjectReference{Kind: "Node"})
+	Eventf(ctx, corev1.EventTypeWarning, PullFailed, "Failed to pull image %q", "helloworld:v1")
+
+	want := `Warning PullFailed Failed to pull image "helloworld:v1"`
+	for i := 0; i < 2; i++ {
+		if got := <-recorder.Events; got != want {
+			t.Errorf("Event = %q, want %q", got, want)
+		}
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("%d more Events recorded, want 2 in total", len(recorder.Events))
+	}
+
+	// Without a recorder nothing is recorded, and nothing breaks.
+	Eventf(WithTargets(context.Background(), &corev1.ObjectReference{}), corev1.EventTypeNormal, PullStarted, "Pulling")
+}
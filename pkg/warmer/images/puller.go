@@ -2,38 +2,137 @@ package images
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"sync"
+	"time"
 
+	"go.opencensus.io/trace"
 	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"knative.dev/pkg/logging"
 
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/tracing"
 	"knative.dev/cache-imagewarm/pkg/warmer/cri"
+	"knative.dev/cache-imagewarm/pkg/warmer/events"
 )
 
-type pullResult struct {
-	imageRef string
-	err      error
+// The kinds of source serving a pull.
+const (
+	SourceRegistry = "registry"
+	SourceMirror   = "mirror"
+	SourcePeer     = "peer"
+	SourceArchive  = "archive"
+)
+
+// PullResult is the outcome of the latest finished pull of an image.
+type PullResult struct {
+	ImageRef string
+	// Endpoint is the mirror endpoint or upstream registry that served the pull.
+	Endpoint string
+	// Source is the kind of Endpoint, SourceRegistry, SourceMirror, SourcePeer
+	// or SourceArchive.
+	Source string
+	Err    error
 }
 
+// ImageLoader loads an image into the runtime without pulling it from a
+// registry, and returns where it was loaded from.
+type ImageLoader func(ctx context.Context, imageService cri.ImageService) (string, error)
+
 type ImagePuller interface {
 	PullImage(context.Context, string, *v1.Secret)
+	// LoadImage queues loading imageRef with loader instead of pulling it.
+	LoadImage(ctx context.Context, imageRef string, loader ImageLoader)
 	// TODO remove pullTask
 	StopPullImage(context.Context, string)
 	Start()
 	ImageExists(ctx context.Context, imageRef string) (bool, error)
+	// PullResult returns the result of the latest finished pull of imageRef.
+	PullResult(imageRef string) (*PullResult, bool)
+	// Progress returns the progress of the layers of imageRef while it is pulled.
+	Progress(imageRef string) ([]cri.LayerProgress, bool)
+}
+
+// Distributor stages images in a node-local registry shared with the warmers
+// on other nodes, so that the runtime pulls them from there.
+type Distributor interface {
+	// Local returns the source the runtime pulls imageRef from once staged.
+	Local(imageRef string) (config.PullSource, bool)
+	// Stage copies imageRef into the node-local registry, from a peer holding it
+	// or from sources, and returns the endpoint the content came from. Copying
+	// from a source holds the pull slot returned by acquireSlot meanwhile.
+	Stage(ctx context.Context, imageRef string, sources []config.PullSource, pullSecret *v1.Secret,
+		acquireSlot func(ctx context.Context, endpoint string) (func(), error)) (string, error)
+	// PeerEndpoint returns the address other nodes can pull imageRef from, if it is held locally.
+	PeerEndpoint(imageRef string) (string, bool)
+}
+
+// PullBudget bounds the pulls from every registry running at once across the cluster.
+type PullBudget interface {
+	// TryAcquire acquires a free pull slot of the registry host, if any,
+	// without waiting for one. The returned func releases the slot.
+	TryAcquire(ctx context.Context, host string) (func(), bool, error)
 }
 
+// errNoPullSlot is returned by acquireSlot when every pull slot of the
+// registry is held. The pull is queued again later rather than failed.
+var errNoPullSlot = errors.New("no free pull slot")
+
 var _ ImagePuller = &serialImagePuller{}
 
-// Maximum number of image pull requests than can be queued.
-const maxImagePullRequests = 10
+const (
+	// initialPullBackoff is the delay before pulling again after a first failure,
+	// doubled on every following failure up to maxPullBackoff.
+	initialPullBackoff = 10 * time.Second
+	// rateLimitedPullBackoff is the initial delay after the registry throttled pulls.
+	rateLimitedPullBackoff = time.Minute
+	maxPullBackoff         = 5 * time.Minute
+
+	// initialSlotBackoff is the delay before queueing a pull again when no
+	// pull slot of its registry was free, doubled on every following attempt
+	// up to maxSlotBackoff.
+	initialSlotBackoff = time.Second
+	maxSlotBackoff     = 30 * time.Second
+)
+
+// retryBackoff returns how long to wait before pulling again after failures
+// consecutive failures, the last one for reason. Permanent failures are
+// retried at the slowest pace, in case the registry changes.
+func retryBackoff(reason cri.PullErrorReason, failures int) time.Duration {
+	if reason.Permanent() {
+		return maxPullBackoff
+	}
+	backoff := initialPullBackoff
+	if reason == cri.ReasonRateLimited {
+		backoff = rateLimitedPullBackoff
+	}
+	for i := 1; i < failures && backoff < maxPullBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxPullBackoff {
+		backoff = maxPullBackoff
+	}
+	return backoff
+}
 
 type serialImagePuller struct {
 	imageService   cri.ImageService
-	pullRequests   chan *imagePullRequest
+	distributor    Distributor
+	budget         PullBudget
 	imagesNeedPull map[string]*imagePullRequest
 
+	// maxPullRequests returns how many pull requests may be queued, those
+	// beyond wait for room.
+	maxPullRequests func() int
+	// queue holds the pull requests waiting for the puller, guarded by
+	// queueCond.L.
+	queue     []*imagePullRequest
+	queueCond *sync.Cond
+
 	sync.RWMutex
 }
 
@@ -56,6 +155,59 @@ func (sip *serialImagePuller) removeImagePullRequest(imageRef string) {
 	sip.Unlock()
 }
 
+func (sip *serialImagePuller) finishImagePullRequest(imageRequest *imagePullRequest, result *PullResult) {
+	sip.Lock()
+	imageRequest.finishPull = true
+	imageRequest.result = result
+	imageRequest.finishTime = time.Now()
+	if result.Err != nil {
+		imageRequest.failures++
+	} else {
+		imageRequest.failures = 0
+	}
+	sip.Unlock()
+}
+
+// retryAfter returns how long to wait before retrying the failed request, if
+// it was made with the same pull secret.
+func (sip *serialImagePuller) retryAfter(imageRequest *imagePullRequest, pullSecret *v1.Secret) time.Duration {
+	sip.RLock()
+	defer sip.RUnlock()
+	if imageRequest.result == nil || imageRequest.result.Err == nil || !sameSecret(imageRequest.pullSecret, pullSecret) {
+		return 0
+	}
+	backoff := retryBackoff(cri.ReasonOf(imageRequest.result.Err), imageRequest.failures)
+	return backoff - time.Since(imageRequest.finishTime)
+}
+
+// sameSecret reports whether both secrets are the same version of the same secret.
+func sameSecret(a, b *v1.Secret) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Namespace == b.Namespace && a.Name == b.Name && a.ResourceVersion == b.ResourceVersion
+}
+
+func (sip *serialImagePuller) PullResult(imageRef string) (*PullResult, bool) {
+	sip.RLock()
+	defer sip.RUnlock()
+	iR, ok := sip.imagesNeedPull[imageRef]
+	if !ok || !iR.finishPull || iR.result == nil {
+		return nil, false
+	}
+	return iR.result, true
+}
+
+func (sip *serialImagePuller) Progress(imageRef string) ([]cri.LayerProgress, bool) {
+	sip.RLock()
+	defer sip.RUnlock()
+	iR, ok := sip.imagesNeedPull[imageRef]
+	if !ok || iR.finishPull || iR.progress == nil {
+		return nil, false
+	}
+	return iR.progress, true
+}
+
 func (sip *serialImagePuller) StopPullImage(ctx context.Context, imageRef string) {
 	logger := logging.FromContext(ctx)
 	logger.Infof("StopPullImage start to remote pull task for image: %s.", imageRef)
@@ -74,11 +226,19 @@ func (sip *serialImagePuller) Start() {
 	go sip.processImagePullRequests()
 }
 
-func NewSerialImagePuller(imageService cri.ImageService) ImagePuller {
+// NewSerialImagePuller creates an ImagePuller pulling one image at a time.
+// distributor is optional, when set images are staged in the node-local peer
+// registry before the runtime pulls them. budget is optional too, when set
+// the pulls from the registries with a pull budget wait for a pull slot.
+// maxPullRequests returns how many pulls may be queued at once.
+func NewSerialImagePuller(imageService cri.ImageService, distributor Distributor, budget PullBudget, maxPullRequests func() int) ImagePuller {
 	imagePuller := &serialImagePuller{
-		imageService:   imageService,
-		pullRequests:   make(chan *imagePullRequest, maxImagePullRequests),
-		imagesNeedPull: make(map[string]*imagePullRequest)}
+		imageService:    imageService,
+		distributor:     distributor,
+		budget:          budget,
+		maxPullRequests: maxPullRequests,
+		queueCond:       sync.NewCond(&sync.Mutex{}),
+		imagesNeedPull:  make(map[string]*imagePullRequest)}
 
 	return imagePuller
 }
@@ -87,9 +247,23 @@ type imagePullRequest struct {
 	imageRef string
 	//spec            cri.ImageInfo
 	pullSecret *v1.Secret
+	// loader is set when the image is loaded rather than pulled
+	loader ImageLoader
 	//pullChan   chan<- pullResult
 	// finishPull specific whether image has been pulled
 	finishPull bool
+	// result is set once finishPull is true
+	result *PullResult
+	// finishTime is when the request finished
+	finishTime time.Time
+	// failures counts the consecutive failed pulls of the image
+	failures int
+	// slotWaits counts the attempts that found no free pull slot
+	slotWaits int
+	// queueSpan traces the time the request waits in the queue
+	queueSpan *trace.Span
+	// progress is the latest progress reported while pulling
+	progress []cri.LayerProgress
 	// cancel pull image
 	cancel context.CancelFunc
 	ctx    context.Context
@@ -99,10 +273,26 @@ type imagePullRequest struct {
 
 // TODO just support serialImagePuller
 func (sip *serialImagePuller) PullImage(ctx context.Context, imageRef string, pullSecret *v1.Secret) {
+	sip.queueImagePullRequest(ctx, imageRef, pullSecret, nil)
+}
+
+func (sip *serialImagePuller) LoadImage(ctx context.Context, imageRef string, loader ImageLoader) {
+	sip.queueImagePullRequest(ctx, imageRef, nil, loader)
+}
+
+func (sip *serialImagePuller) queueImagePullRequest(ctx context.Context, imageRef string, pullSecret *v1.Secret, loader ImageLoader) {
 	logger := logging.FromContext(ctx)
-	if pullRequest, ok := sip.getImagePullRequest(imageRef); ok && pullRequest.finishPull == false {
-		logger.Infof("ImagePuller is pulling Image %s", imageRef)
-		return
+	var failures int
+	if pullRequest, ok := sip.getImagePullRequest(imageRef); ok {
+		if pullRequest.finishPull == false {
+			logger.Infof("ImagePuller is pulling Image %s", imageRef)
+			return
+		}
+		if wait := sip.retryAfter(pullRequest, pullSecret); wait > 0 {
+			logger.Infof("ImagePuller backs off pulling Image %s for %v", imageRef, wait.Round(time.Second))
+			return
+		}
+		failures = pullRequest.failures
 	}
 
 	logger.Infof("ImagePuller start to pull  Image %s", imageRef)
@@ -111,55 +301,284 @@ func (sip *serialImagePuller) PullImage(ctx context.Context, imageRef string, pu
 	pullRequest := &imagePullRequest{
 		imageRef:   imageRef,
 		pullSecret: pullSecret,
+		loader:     loader,
+		failures:   failures,
 		cancel:     cancel,
-		ctx:        ctx,
 	}
+	pullRequest.ctx = cri.WithProgressFunc(ctx, func(layers []cri.LayerProgress) {
+		sip.Lock()
+		pullRequest.progress = layers
+		sip.Unlock()
+	})
 
+	_, pullRequest.queueSpan = trace.StartSpan(ctx, tracing.SpanPullQueueWait)
 	sip.putImagePullRequest(pullRequest)
 
 	// send to do realPull
-	sip.pullRequests <- pullRequest
+	reportQueueDepth(ctx, sip.enqueue(pullRequest))
+}
+
+// enqueue queues the pull request once there is room for it, and returns
+// the number of queued requests.
+func (sip *serialImagePuller) enqueue(pullRequest *imagePullRequest) int {
+	sip.queueCond.L.Lock()
+	defer sip.queueCond.L.Unlock()
+	for len(sip.queue) >= sip.maxPullRequests() {
+		sip.queueCond.Wait()
+	}
+	sip.queue = append(sip.queue, pullRequest)
+	sip.queueCond.Broadcast()
+	return len(sip.queue)
+}
+
+// dequeue waits for a pull request, and returns it along with the number of
+// requests left in the queue.
+func (sip *serialImagePuller) dequeue() (*imagePullRequest, int) {
+	sip.queueCond.L.Lock()
+	defer sip.queueCond.L.Unlock()
+	for len(sip.queue) == 0 {
+		sip.queueCond.Wait()
+	}
+	pullRequest := sip.queue[0]
+	sip.queue[0] = nil
+	sip.queue = sip.queue[1:]
+	sip.queueCond.Broadcast()
+	return pullRequest, len(sip.queue)
 }
 
 func (sip *serialImagePuller) processImagePullRequests() {
 
-	for pullRequest := range sip.pullRequests {
+	for {
+		pullRequest, depth := sip.dequeue()
 		logger := logging.FromContext(pullRequest.ctx)
 		logger.Infof("ImagePuller receive imagePull task,imageRef :%s", pullRequest.imageRef)
+		reportQueueDepth(pullRequest.ctx, depth)
+		pullRequest.queueSpan.End()
 
 		func() {
 			exist, _ := sip.ImageExists(pullRequest.ctx, pullRequest.imageRef)
 			if exist {
-				pullRequest.finishPull = true
-
-				//if err := pullRequest.successHandler(pullRequest.imageRef); err != nil {
-				//	logger.Infof("call handler err %s", err.Error())
-				//} else {
-				//
-				logger.Infof("call handler success !")
-				//}
+				sip.finishImagePullRequest(pullRequest, &PullResult{ImageRef: pullRequest.imageRef})
+				logger.Infof("Image %s already exists, skip pulling", pullRequest.imageRef)
+				return
+			}
 
+			if pullRequest.slotWaits == 0 {
+				events.Eventf(pullRequest.ctx, v1.EventTypeNormal, events.PullStarted, "Pulling image %q", pullRequest.imageRef)
+			}
+			start := time.Now()
+			reportInFlight(pullRequest.ctx, 1)
+			var result *PullResult
+			if pullRequest.loader != nil {
+				endpoint, err := pullRequest.loader(pullRequest.ctx, sip.imageService)
+				result = &PullResult{ImageRef: pullRequest.imageRef, Endpoint: endpoint, Source: SourceArchive, Err: err}
 			} else {
-				err := sip.imageService.PullImage(pullRequest.ctx, pullRequest.imageRef, pullRequest.pullSecret)
-				pullRequest.finishPull = true
-				if err == nil {
-					//if callErr := pullRequest.successHandler(pullRequest.imageRef); callErr != nil {
-					//	logger.Errorf("call handler err %s", callErr.Error())
-					//} else {
-					logger.Infof("call handler success !")
-					//}
-				}
-
+				result = sip.pullFromSources(pullRequest)
+			}
+			reportInFlight(pullRequest.ctx, 0)
+			if errors.Is(result.Err, errNoPullSlot) && pullRequest.ctx.Err() == nil {
+				sip.requeue(pullRequest)
+				return
+			}
+			registry, source := pullTags(pullRequest.imageRef, result)
+			sip.Lock()
+			layers := pullRequest.progress
+			sip.Unlock()
+			reportPull(pullRequest.ctx, registry, source, result.Err, time.Since(start), layers)
+			sip.finishImagePullRequest(pullRequest, result)
+
+			switch {
+			case result.Err == nil:
+				logger.Infof("Pulled image %s from %s", pullRequest.imageRef, result.Endpoint)
+				events.Eventf(pullRequest.ctx, v1.EventTypeNormal, events.PullSucceeded, "Pulled image %q from %s in %v",
+					pullRequest.imageRef, result.Endpoint, time.Since(start).Round(time.Millisecond))
+			case pullRequest.ctx.Err() == context.Canceled && cri.ReasonOf(result.Err) != cri.ReasonTimeout:
+				logger.Infof("Cancelled pulling image %s", pullRequest.imageRef)
+				reportCancellation(pullRequest.ctx)
+				events.Eventf(pullRequest.ctx, v1.EventTypeNormal, events.PullCancelled, "Cancelled pulling image %q", pullRequest.imageRef)
+			default:
+				logger.Errorf("Failed to pull image %s, err: %v", pullRequest.imageRef, result.Err)
+				events.Eventf(pullRequest.ctx, v1.EventTypeWarning, events.PullFailed, "Failed to pull image %q (%s): %v",
+					pullRequest.imageRef, cri.ReasonOf(result.Err), result.Err)
 			}
 		}()
 	}
 }
 
+// pullFromSources pulls the image from every configured mirror in order,
+// falling back to the upstream registry, and stops at the first success.
+func (sip *serialImagePuller) pullFromSources(pullRequest *imagePullRequest) *PullResult {
+	logger := logging.FromContext(pullRequest.ctx)
+	sources := config.FromContextOrDefaults(pullRequest.ctx).Registry.Sources(pullRequest.imageRef)
+
+	var pullErrs []error
+	if sip.distributor != nil {
+		result, err := sip.pullFromPeers(pullRequest, sources)
+		if err == nil {
+			return result
+		}
+		logger.Warnf("Failed to pull image %s through the peer registry, err: %v", pullRequest.imageRef, err)
+		pullErrs = append(pullErrs, err)
+	}
+
+	for _, source := range sources {
+		releaseSlot, err := sip.acquireSlot(pullRequest.ctx, source.Endpoint)
+		if err != nil {
+			pullErrs = append(pullErrs, err)
+			break
+		}
+		err = sip.imageService.PullImage(pullRequest.ctx, source.ImageRef, pullRequest.pullSecret)
+		releaseSlot()
+		if err == nil && source.ImageRef != pullRequest.imageRef && !strings.Contains(pullRequest.imageRef, "@") {
+			// Make the image visible under the reference kubelet asks for. Digest
+			// references cannot be tagged, ImageExists accepts the mirror digest instead.
+			err = sip.imageService.TagImage(pullRequest.ctx, source.ImageRef, pullRequest.imageRef)
+		}
+		if err == nil {
+			return &PullResult{ImageRef: pullRequest.imageRef, Endpoint: source.Endpoint,
+				Source: sourceKind(pullRequest.imageRef, sources, source.Endpoint)}
+		}
+
+		logger.Warnf("Failed to pull image %s from %s, err: %v", pullRequest.imageRef, source.Endpoint, err)
+		pullErrs = append(pullErrs, err)
+		if pullRequest.ctx.Err() != nil {
+			break
+		}
+	}
+	return &PullResult{ImageRef: pullRequest.imageRef, Err: utilerrors.NewAggregate(pullErrs)}
+}
+
+// requeue queues the pull request again once the backoff of its attempts
+// without a free pull slot is over, unless it is cancelled meanwhile. The
+// request stays in flight, so that it is not queued twice.
+func (sip *serialImagePuller) requeue(pullRequest *imagePullRequest) {
+	backoff := initialSlotBackoff
+	for i := 0; i < pullRequest.slotWaits && backoff < maxSlotBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxSlotBackoff {
+		backoff = maxSlotBackoff
+	}
+	pullRequest.slotWaits++
+	logging.FromContext(pullRequest.ctx).Infof("No pull slot free for image %s, queueing it again in %v",
+		pullRequest.imageRef, backoff)
+
+	_, pullRequest.queueSpan = trace.StartSpan(pullRequest.ctx, tracing.SpanPullSlotWait)
+	time.AfterFunc(wait.Jitter(backoff, 0.5), func() {
+		if pullRequest.ctx.Err() != nil {
+			pullRequest.queueSpan.End()
+			return
+		}
+		reportQueueDepth(pullRequest.ctx, sip.enqueue(pullRequest))
+	})
+}
+
+// acquireSlot holds a pull slot of the registry serving endpoint, when the
+// pulls from it are budgeted. The returned func releases the slot.
+//
+// The pulls are processed one at a time, so rather than wait for a slot of a
+// saturated registry, which would hold up the pulls queued behind from any
+// registry, it returns errNoPullSlot and the pull is queued again later.
+func (sip *serialImagePuller) acquireSlot(ctx context.Context, endpoint string) (func(), error) {
+	if sip.budget == nil || config.FromContextOrDefaults(ctx).Registry.PullBudget(endpoint) == 0 {
+		return func() {}, nil
+	}
+	host := config.RegistryHost(endpoint)
+	release, ok, err := sip.budget.TryAcquire(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("registry %s: %w", host, errNoPullSlot)
+	}
+	return release, nil
+}
+
+// pullFromPeers stages the image in the node-local peer registry and pulls it from there.
+func (sip *serialImagePuller) pullFromPeers(pullRequest *imagePullRequest, sources []config.PullSource) (*PullResult, error) {
+	local, ok := sip.distributor.Local(pullRequest.imageRef)
+	if !ok {
+		return nil, fmt.Errorf("image %s cannot be served by the peer registry", pullRequest.imageRef)
+	}
+	endpoint, err := sip.distributor.Stage(pullRequest.ctx, pullRequest.imageRef, sources, pullRequest.pullSecret, sip.acquireSlot)
+	if err != nil {
+		return nil, err
+	}
+	// The peer registry serves anonymously, no need for the pull secret.
+	if err := sip.imageService.PullImage(pullRequest.ctx, local.ImageRef, nil); err != nil {
+		return nil, err
+	}
+	if !strings.Contains(pullRequest.imageRef, "@") {
+		if err := sip.imageService.TagImage(pullRequest.ctx, local.ImageRef, pullRequest.imageRef); err != nil {
+			return nil, err
+		}
+	}
+	return &PullResult{ImageRef: pullRequest.imageRef, Endpoint: endpoint,
+		Source: sourceKind(pullRequest.imageRef, sources, endpoint)}, nil
+}
+
+// sourceKind returns the kind of the endpoint that served imageRef: the
+// upstream registry, one of its mirrors, or else a peer.
+func sourceKind(imageRef string, sources []config.PullSource, endpoint string) string {
+	for _, source := range sources {
+		if source.Endpoint != endpoint {
+			continue
+		}
+		if source.ImageRef == imageRef {
+			return SourceRegistry
+		}
+		return SourceMirror
+	}
+	return SourcePeer
+}
+
+// pullTags returns the metric tags of a finished pull, bounded whatever
+// served it: the host of the mirror or registry, or the registry of the image
+// when a peer or an archive served it or the pull failed.
+func pullTags(imageRef string, result *PullResult) (registry, source string) {
+	source = result.Source
+	if source == "" {
+		source = SourceRegistry
+	}
+	if source == SourceRegistry || source == SourceMirror {
+		registry = config.RegistryHost(result.Endpoint)
+	}
+	if registry == "" {
+		registry = config.ImageRegistry(imageRef)
+	}
+	return registry, source
+}
+
+// ImageExists checks whether the image is present under its own reference or
+// under any of the mirror references it could have been pulled from.
 func (sip *serialImagePuller) ImageExists(ctx context.Context, imageRef string) (bool, error) {
+	defer func(start time.Time) {
+		reportExists(ctx, time.Since(start))
+	}(time.Now())
+
+	sources := config.FromContextOrDefaults(ctx).Registry.Sources(imageRef)
+	if sip.distributor != nil {
+		if local, ok := sip.distributor.Local(imageRef); ok {
+			sources = append(sources, local)
+		}
+	}
+	for _, source := range sources {
+		exists, err := sip.imageRefExists(ctx, source.ImageRef)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (sip *serialImagePuller) imageRefExists(ctx context.Context, imageRef string) (bool, error) {
 	// Trim docker.io and index.docker.io
-	if strings.Contains(imageRef,"docker.io"){
-		splits:=strings.Split(imageRef,"/")
-		imageRef = strings.Join(splits[1:],"/")
+	if strings.Contains(imageRef, "docker.io") {
+		splits := strings.Split(imageRef, "/")
+		imageRef = strings.Join(splits[1:], "/")
 	}
 
 	if strings.Contains(imageRef, "@sha256") {
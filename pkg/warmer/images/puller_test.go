@@ -0,0 +1,169 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/warmer/cri/docker"
+)
+
+func TestPullQueueLimit(t *testing.T) {
+	var limit int64 = 1
+	sip := &serialImagePuller{
+		maxPullRequests: func() int { return int(atomic.LoadInt64(&limit)) },
+		queueCond:       sync.NewCond(&sync.Mutex{}),
+	}
+
+	if depth := sip.enqueue(&imagePullRequest{imageRef: "first"}); depth != 1 {
+		t.Errorf("enqueue() = %d, want 1", depth)
+	}
+	queued := make(chan struct{})
+	go func() {
+		sip.enqueue(&imagePullRequest{imageRef: "second"})
+		close(queued)
+	}()
+	select {
+	case <-queued:
+		t.Fatal("enqueue() did not wait for room in a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if pullRequest, depth := sip.dequeue(); pullRequest.imageRef != "first" || depth != 0 {
+		t.Errorf("dequeue() = %s, %d, want first, 0", pullRequest.imageRef, depth)
+	}
+	<-queued
+
+	// A raised limit lets more requests in.
+	atomic.StoreInt64(&limit, 3)
+	for _, imageRef := range []string{"third", "fourth"} {
+		sip.enqueue(&imagePullRequest{imageRef: imageRef})
+	}
+	if pullRequest, depth := sip.dequeue(); pullRequest.imageRef != "second" || depth != 2 {
+		t.Errorf("dequeue() = %s, %d, want second, 2", pullRequest.imageRef, depth)
+	}
+}
+
+func TestPullFromMirrorWithoutCredentials(t *testing.T) {
+	var mu sync.Mutex
+	auths := map[string]string{}
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/images/create"):
+			mu.Lock()
+			auths[r.URL.Query().Get("fromImage")] = r.Header.Get("X-Registry-Auth")
+			mu.Unlock()
+			w.Write([]byte(`{"status":"Pulling from knative/helloworld"}`))
+		case strings.HasSuffix(r.URL.Path, "/tag"):
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer daemon.Close()
+
+	settings := &config.Settings{
+		DockerRuntimeURI:          "tcp://" + strings.TrimPrefix(daemon.URL, "http://"),
+		DockerTimeout:             time.Minute,
+		ImagePullProgressDeadline: time.Minute,
+	}
+	imageService, err := docker.NewDockerImageService(func() *config.Settings { return settings })
+	if err != nil {
+		t.Fatal("NewDockerImageService() =", err)
+	}
+	sip := &serialImagePuller{imageService: imageService}
+
+	ctx := config.ToContext(context.Background(), &config.Config{
+		Registry: &config.Registry{
+			Mirrors: map[string][]string{"gcr.io": {"mirror.example.com"}},
+		},
+	})
+	// The pull secret only holds credentials of the upstream registry.
+	pullSecret := &corev1.Secret{
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(`{"auths":{"gcr.io":{"username":"user","password":"secret"}}}`),
+		},
+	}
+	result := sip.pullFromSources(&imagePullRequest{
+		ctx:        ctx,
+		imageRef:   "gcr.io/knative-samples/helloworld-go:latest",
+		pullSecret: pullSecret,
+	})
+	if result.Err != nil {
+		t.Fatal("pullFromSources() =", result.Err)
+	}
+	if result.Endpoint != "mirror.example.com" {
+		t.Errorf("Endpoint = %s, want mirror.example.com", result.Endpoint)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if auth, ok := auths["mirror.example.com/knative-samples/helloworld-go"]; !ok || auth != "" {
+		t.Errorf("mirror pull = %t with auth %q, want an anonymous pull", ok, auth)
+	}
+}
+
+// saturatedBudget never has a free pull slot.
+type saturatedBudget struct{}
+
+func (saturatedBudget) TryAcquire(context.Context, string) (func(), bool, error) {
+	return nil, false, nil
+}
+
+func TestRequeueWithoutPullSlot(t *testing.T) {
+	sip := &serialImagePuller{
+		budget:          saturatedBudget{},
+		maxPullRequests: func() int { return 10 },
+		queueCond:       sync.NewCond(&sync.Mutex{}),
+	}
+	ctx, cancel := context.WithCancel(config.ToContext(context.Background(), &config.Config{
+		Registry: &config.Registry{PullBudgets: map[string]int{"registry.example.com": 1}},
+	}))
+	defer cancel()
+	pullRequest := &imagePullRequest{ctx: ctx, cancel: cancel, imageRef: "registry.example.com/helloworld:v1"}
+
+	// No pull is attempted, the image service is not even set.
+	if result := sip.pullFromSources(pullRequest); !errors.Is(result.Err, errNoPullSlot) {
+		t.Fatalf("pullFromSources() = %v, want %v", result.Err, errNoPullSlot)
+	}
+
+	sip.requeue(pullRequest)
+	dequeued := make(chan *imagePullRequest)
+	go func() {
+		got, _ := sip.dequeue()
+		dequeued <- got
+	}()
+	select {
+	case got := <-dequeued:
+		if got != pullRequest || got.slotWaits != 1 {
+			t.Errorf("dequeue() = %s after %d waits, want %s after 1", got.imageRef, got.slotWaits, pullRequest.imageRef)
+		}
+	case <-time.After(2 * initialSlotBackoff):
+		t.Fatal("the pull request was not queued again")
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"knative.dev/pkg/metrics"
+
+	"knative.dev/cache-imagewarm/pkg/warmer/cri"
+)
+
+const resultSuccess = "Success"
+
+var (
+	pullLatencyM = stats.Float64(
+		"image_pull_latencies",
+		"Time taken to pull an image",
+		stats.UnitMilliseconds)
+	pullBytesM = stats.Int64(
+		"image_pull_bytes",
+		"Bytes of image layers downloaded",
+		stats.UnitBytes)
+	pullQueueDepthM = stats.Int64(
+		"image_pull_queue_depth",
+		"Number of image pulls waiting in the queue",
+		stats.UnitDimensionless)
+	pullsInFlightM = stats.Int64(
+		"image_pulls_in_flight",
+		"Number of images being pulled",
+		stats.UnitDimensionless)
+	pullCancellationsM = stats.Int64(
+		"image_pull_cancellations",
+		"Number of image pulls cancelled",
+		stats.UnitDimensionless)
+	existsLatencyM = stats.Float64(
+		"image_exists_latencies",
+		"Time taken to check whether an image is present on the node",
+		stats.UnitMilliseconds)
+
+	// registryKey is the host of the registry or mirror that served the pull,
+	// or the registry of the image when a peer or an archive served it or the
+	// pull failed.
+	registryKey = tag.MustNewKey("registry")
+	// sourceKey is the kind of source that served the pull, or was expected
+	// to: registry, mirror, peer or archive.
+	sourceKey = tag.MustNewKey("source")
+	// resultKey is Success, or the cri.PullErrorReason of the failure.
+	resultKey = tag.MustNewKey("result")
+)
+
+func init() {
+	register()
+}
+
+func register() {
+	if err := metrics.RegisterResourceView(
+		&view.View{
+			Description: pullLatencyM.Description(),
+			Measure:     pullLatencyM,
+			Aggregation: view.Distribution(metrics.Buckets125(100, 3600000)...), // 100ms to 1h
+			TagKeys:     []tag.Key{registryKey, sourceKey, resultKey},
+		},
+		&view.View{
+			Description: pullBytesM.Description(),
+			Measure:     pullBytesM,
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{registryKey, sourceKey},
+		},
+		&view.View{
+			Description: pullQueueDepthM.Description(),
+			Measure:     pullQueueDepthM,
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Description: pullsInFlightM.Description(),
+			Measure:     pullsInFlightM,
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Description: pullCancellationsM.Description(),
+			Measure:     pullCancellationsM,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Description: existsLatencyM.Description(),
+			Measure:     existsLatencyM,
+			Aggregation: view.Distribution(metrics.Buckets125(1, 10000)...), // 1ms to 10s
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// reportPull records the duration of a finished pull and the bytes it downloaded.
+func reportPull(ctx context.Context, registry, source string, err error, duration time.Duration, layers []cri.LayerProgress) {
+	result := resultSuccess
+	if err != nil {
+		result = string(cri.ReasonOf(err))
+	}
+	ctx, tagErr := tag.New(ctx, tag.Upsert(registryKey, registry), tag.Upsert(sourceKey, source), tag.Upsert(resultKey, result))
+	if tagErr != nil {
+		return
+	}
+
+	var bytes int64
+	for _, layer := range layers {
+		bytes += layer.Current
+	}
+	metrics.RecordBatch(ctx,
+		pullLatencyM.M(float64(duration/time.Millisecond)),
+		pullBytesM.M(bytes))
+}
+
+func reportQueueDepth(ctx context.Context, depth int) {
+	metrics.Record(ctx, pullQueueDepthM.M(int64(depth)))
+}
+
+func reportInFlight(ctx context.Context, inFlight int) {
+	metrics.Record(ctx, pullsInFlightM.M(int64(inFlight)))
+}
+
+func reportCancellation(ctx context.Context) {
+	metrics.Record(ctx, pullCancellationsM.M(1))
+}
+
+func reportExists(ctx context.Context, duration time.Duration) {
+	metrics.Record(ctx, existsLatencyM.M(float64(duration/time.Millisecond)))
+}
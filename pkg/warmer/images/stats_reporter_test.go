@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"knative.dev/pkg/metrics"
+	"knative.dev/pkg/metrics/metricstest"
+
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/warmer/cri"
+)
+
+func TestReportPull(t *testing.T) {
+	metrics.InitForTesting()
+	layers := []cri.LayerProgress{{ID: "a", Current: 100, Total: 100}, {ID: "b", Current: 20, Total: 50}}
+
+	tests := []struct {
+		name     string
+		err      error
+		wantTags map[string]string
+	}{{
+		name:     "success",
+		wantTags: map[string]string{"registry": "gcr.io", "source": "mirror", "result": "Success"},
+	}, {
+		name:     "failure",
+		err:      cri.NewPullError(cri.ReasonUnauthorized, errors.New("denied")),
+		wantTags: map[string]string{"registry": "gcr.io", "source": "mirror", "result": string(cri.ReasonUnauthorized)},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetMetrics()
+			reportPull(context.Background(), "gcr.io", SourceMirror, test.err, 2*time.Second, layers)
+
+			metricstest.CheckDistributionData(t, "image_pull_latencies", test.wantTags, 1, 2000, 2000)
+			metricstest.CheckSumData(t, "image_pull_bytes", map[string]string{"registry": "gcr.io", "source": "mirror"}, 120)
+		})
+	}
+}
+
+func TestPullTags(t *testing.T) {
+	const imageRef = "gcr.io/knative-samples/helloworld-go:latest"
+	sources := []config.PullSource{
+		{Endpoint: "mirror.example.com/gcr", ImageRef: "mirror.example.com/gcr/knative-samples/helloworld-go:latest"},
+		{Endpoint: "gcr.io", ImageRef: imageRef},
+	}
+
+	tests := []struct {
+		name         string
+		imageRef     string
+		result       *PullResult
+		wantRegistry string
+		wantSource   string
+	}{{
+		name:         "registry",
+		result:       &PullResult{Endpoint: "gcr.io", Source: sourceKind(imageRef, sources, "gcr.io")},
+		wantRegistry: "gcr.io",
+		wantSource:   SourceRegistry,
+	}, {
+		name:         "mirror",
+		result:       &PullResult{Endpoint: "mirror.example.com/gcr", Source: sourceKind(imageRef, sources, "mirror.example.com/gcr")},
+		wantRegistry: "mirror.example.com",
+		wantSource:   SourceMirror,
+	}, {
+		name:         "peer",
+		result:       &PullResult{Endpoint: "10.0.0.2:5001", Source: sourceKind(imageRef, sources, "10.0.0.2:5001")},
+		wantRegistry: "gcr.io",
+		wantSource:   SourcePeer,
+	}, {
+		name:         "archive",
+		result:       &PullResult{Endpoint: "hostPath:/var/lib/cache-imagewarm/archives/helloworld.tar", Source: SourceArchive},
+		wantRegistry: "gcr.io",
+		wantSource:   SourceArchive,
+	}, {
+		name:         "failure",
+		imageRef:     "nginx:1.19",
+		result:       &PullResult{Err: errors.New("denied")},
+		wantRegistry: "docker.io",
+		wantSource:   SourceRegistry,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ref := test.imageRef
+			if ref == "" {
+				ref = imageRef
+			}
+			registry, source := pullTags(ref, test.result)
+			if registry != test.wantRegistry || source != test.wantSource {
+				t.Errorf("pullTags() = %s, %s, want %s, %s", registry, source, test.wantRegistry, test.wantSource)
+			}
+		})
+	}
+}
+
+func resetMetrics() {
+	metricstest.Unregister("image_pull_latencies", "image_pull_bytes", "image_pull_queue_depth",
+		"image_pulls_in_flight", "image_pull_cancellations", "image_exists_latencies")
+	register()
+}
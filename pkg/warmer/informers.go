@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package warmer
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/injection"
+
+	"knative.dev/cache-imagewarm/pkg/client/informers/externalversions"
+	servingclient "knative.dev/cache-imagewarm/pkg/client/injection/client"
+	"knative.dev/cache-imagewarm/pkg/client/injection/informers/factory"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+	"knative.dev/cache-imagewarm/pkg/warmer/reconciler"
+)
+
+func init() {
+	// This package imports the informer factory of the clientset, whose init
+	// registers it first, so this one replaces it in the context before the
+	// informers are set up.
+	injection.Default.RegisterInformerFactory(withNodeInformerFactory)
+}
+
+// NodeSelector selects the objects labeled with the node of the warmer.
+func NodeSelector() labels.Selector {
+	return labels.SelectorFromSet(labels.Set{
+		imagewarm.NodeLabelKey: imagewarm.LabelValue(reconciler.NodeName),
+	})
+}
+
+// withNodeInformerFactory injects the informer factory of the clientset
+// scoped to the objects of the node of the warmer by the API server, so that
+// every warmer caches its own ImageWarms and NodeWarmPlans, not the fleet's.
+func withNodeInformerFactory(ctx context.Context) context.Context {
+	opts := []externalversions.SharedInformerOption{
+		externalversions.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = NodeSelector().String()
+		}),
+	}
+	if injection.HasNamespaceScope(ctx) {
+		opts = append(opts, externalversions.WithNamespace(injection.GetNamespaceScope(ctx)))
+	}
+	return context.WithValue(ctx, factory.Key{},
+		externalversions.NewSharedInformerFactoryWithOptions(servingclient.Get(ctx), controller.GetResyncPeriod(ctx), opts...))
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/logging"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	clientset "knative.dev/cache-imagewarm/pkg/client/clientset/versioned"
+	imagewarminformers "knative.dev/cache-imagewarm/pkg/client/informers/externalversions/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+	"knative.dev/cache-imagewarm/pkg/warmer/cri"
+)
+
+const (
+	// syncPeriod is how often the inventory is compared with the runtime.
+	syncPeriod = time.Minute
+	// lastUsedResolution bounds how often the last used time of an image in
+	// use is refreshed, to keep updates of the inventory to actual changes.
+	lastUsedResolution = 10 * time.Minute
+)
+
+// Publisher keeps the NodeImageInventory of a node in sync with the images
+// held by its container runtime.
+type Publisher struct {
+	nodeName          string
+	imageService      cri.ImageService
+	client            clientset.Interface
+	kubeClient        kubernetes.Interface
+	imageWarmInformer imagewarminformers.ImageWarmInformer
+	planInformer      imagewarminformers.NodeWarmPlanInformer
+
+	trigger chan struct{}
+	// current is the inventory as last read or written by the publisher.
+	current *v1alpha1.NodeImageInventory
+}
+
+// NewPublisher creates a Publisher for the inventory of nodeName, whose images
+// are owned by the ImageWarms and the NodeWarmPlan entries of the node.
+func NewPublisher(nodeName string, imageService cri.ImageService, client clientset.Interface,
+	kubeClient kubernetes.Interface, imageWarmInformer imagewarminformers.ImageWarmInformer,
+	planInformer imagewarminformers.NodeWarmPlanInformer) *Publisher {
+	return &Publisher{
+		nodeName:          nodeName,
+		imageService:      imageService,
+		client:            client,
+		kubeClient:        kubeClient,
+		imageWarmInformer: imageWarmInformer,
+		planInformer:      planInformer,
+		trigger:           make(chan struct{}, 1),
+	}
+}
+
+// Start syncs the inventory periodically and whenever triggered, until ctx is done.
+func (p *Publisher) Start(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+
+	go func() {
+		if !cache.WaitForCacheSync(ctx.Done(), p.imageWarmInformer.Informer().HasSynced, p.planInformer.Informer().HasSynced) {
+			return
+		}
+		ticker := time.NewTicker(syncPeriod)
+		defer ticker.Stop()
+		for {
+			if err := p.sync(ctx); err != nil {
+				logger.Warnf("Failed to publish the image inventory of node %s, err: %v", p.nodeName, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-p.trigger:
+			}
+		}
+	}()
+}
+
+// Trigger requests a sync of the inventory, after the images of the node changed.
+func (p *Publisher) Trigger() {
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Publisher) sync(ctx context.Context) error {
+	infos, err := p.imageService.ListImages(ctx)
+	if err != nil {
+		return err
+	}
+	inUse, err := p.imageService.ImagesInUse(ctx)
+	if err != nil {
+		return err
+	}
+	warms, err := p.imageWarmInformer.Lister().List(labels.SelectorFromSet(map[string]string{
+		imagewarm.NodeLabelKey: imagewarm.LabelValue(p.nodeName),
+	}))
+	if err != nil {
+		return err
+	}
+	plans, err := p.planInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	warms = append(warms, plannedWarms(plans, p.nodeName)...)
+	inventory, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	images := buildImages(infos, sets.NewString(inUse...), warms, inventory.Status.Images, time.Now())
+	reportOwned(ctx, images)
+	if equality.Semantic.DeepEqual(inventory.Status.Images, images) {
+		return nil
+	}
+
+	want := inventory.DeepCopy()
+	want.Status.Images = images
+	want.Status.ObservedGeneration = inventory.Generation
+	updated, err := p.client.CachingV1alpha1().NodeImageInventories().UpdateStatus(ctx, want, metav1.UpdateOptions{})
+	if err != nil {
+		// Read the inventory again on the next sync, it may have been changed.
+		p.current = nil
+		return err
+	}
+	p.current = updated
+	return nil
+}
+
+// get returns the inventory of the node, creating it owned by the node so it
+// is garbage collected along with it.
+func (p *Publisher) get(ctx context.Context) (*v1alpha1.NodeImageInventory, error) {
+	if p.current != nil {
+		return p.current, nil
+	}
+
+	inventory, err := p.client.CachingV1alpha1().NodeImageInventories().Get(ctx, p.nodeName, metav1.GetOptions{})
+	if apierrs.IsNotFound(err) {
+		node, err := p.kubeClient.CoreV1().Nodes().Get(ctx, p.nodeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		inventory, err = p.client.CachingV1alpha1().NodeImageInventories().Create(ctx, &v1alpha1.NodeImageInventory{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: p.nodeName,
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(node, corev1.SchemeGroupVersion.WithKind("Node")),
+				},
+			},
+			Spec: v1alpha1.NodeImageInventorySpec{NodeName: p.nodeName},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	p.current = inventory
+	return inventory, nil
+}
+
+// plannedWarms returns the ImageWarms standing for the entries of the
+// NodeWarmPlans of the node, named after the Images owning them.
+func plannedWarms(plans []*v1alpha1.NodeWarmPlan, nodeName string) []*v1alpha1.ImageWarm {
+	var warms []*v1alpha1.ImageWarm
+	for _, plan := range plans {
+		if plan.Spec.NodeName != nodeName {
+			continue
+		}
+		for k := range plan.Spec.Images {
+			if warm, err := imagewarm.FromPlannedImage(plan, &plan.Spec.Images[k]); err == nil {
+				warms = append(warms, warm)
+			}
+		}
+	}
+	return warms
+}
+
+// buildImages returns the inventory of the images held by the runtime, sorted
+// by ID, carrying over the last used times of the previous inventory.
+func buildImages(infos []cri.ImageInfo, inUse sets.String, warms []*v1alpha1.ImageWarm,
+	previous []v1alpha1.InventoryImage, now time.Time) []v1alpha1.InventoryImage {
+	lastUsed := make(map[string]*metav1.Time, len(previous))
+	for _, image := range previous {
+		lastUsed[image.ID] = image.LastUsedTime
+	}
+
+	images := make([]v1alpha1.InventoryImage, 0, len(infos))
+	for _, info := range infos {
+		image := v1alpha1.InventoryImage{
+			ID:           info.ID,
+			RepoTags:     sets.NewString(info.RepoTags...).List(),
+			RepoDigests:  sets.NewString(info.RepoDigests...).List(),
+			SizeBytes:    info.Size,
+			LastUsedTime: lastUsed[info.ID],
+		}
+		if inUse.Has(info.ID) && (image.LastUsedTime == nil || now.Sub(image.LastUsedTime.Time) >= lastUsedResolution) {
+			image.LastUsedTime = &metav1.Time{Time: now}
+		}
+
+		owners := sets.NewString()
+		for _, warm := range warms {
+			if warm.DeletionTimestamp.IsZero() && image.Matches(warm.Spec.Image) {
+				owners.Insert(warm.Namespace + "/" + warm.Name)
+			}
+		}
+		image.ImageWarms = owners.List()
+
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].ID < images[j].ID
+	})
+	return images
+}
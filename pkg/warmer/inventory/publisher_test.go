@@ -0,0 +1,179 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/warmer/cri"
+)
+
+const (
+	helloID = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	pauseID = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	digest  = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+)
+
+func imageWarm(name, image string) *v1alpha1.ImageWarm {
+	return &v1alpha1.ImageWarm{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec:       v1alpha1.ImageWarmSpec{Image: image},
+	}
+}
+
+func TestBuildImages(t *testing.T) {
+	now := time.Now()
+	recently := metav1.NewTime(now.Add(-time.Minute))
+	longAgo := metav1.NewTime(now.Add(-time.Hour))
+
+	infos := []cri.ImageInfo{{
+		ID:          pauseID,
+		RepoTags:    []string{"k8s.gcr.io/pause:3.2"},
+		RepoDigests: []string{"k8s.gcr.io/pause@" + digest},
+		Size:        100,
+	}, {
+		ID:       helloID,
+		RepoTags: []string{"gcr.io/knative/helloworld:v1", "helloworld:latest"},
+		Size:     200,
+	}}
+
+	tests := []struct {
+		name     string
+		inUse    sets.String
+		warms    []*v1alpha1.ImageWarm
+		previous []v1alpha1.InventoryImage
+		want     []v1alpha1.InventoryImage
+	}{{
+		name: "new images",
+		want: []v1alpha1.InventoryImage{{
+			ID:        helloID,
+			RepoTags:  []string{"gcr.io/knative/helloworld:v1", "helloworld:latest"},
+			SizeBytes: 200,
+		}, {
+			ID:          pauseID,
+			RepoTags:    []string{"k8s.gcr.io/pause:3.2"},
+			RepoDigests: []string{"k8s.gcr.io/pause@" + digest},
+			SizeBytes:   100,
+		}},
+	}, {
+		name: "owned by tag and digest",
+		warms: []*v1alpha1.ImageWarm{
+			imageWarm("hello", "gcr.io/knative/helloworld:v1"),
+			imageWarm("hello-latest", "docker.io/library/helloworld"),
+			imageWarm("pause", "mirror.example.com/pause@"+digest),
+			imageWarm("other", "gcr.io/knative/helloworld:v2"),
+		},
+		want: []v1alpha1.InventoryImage{{
+			ID:         helloID,
+			RepoTags:   []string{"gcr.io/knative/helloworld:v1", "helloworld:latest"},
+			SizeBytes:  200,
+			ImageWarms: []string{"default/hello", "default/hello-latest"},
+		}, {
+			ID:          pauseID,
+			RepoTags:    []string{"k8s.gcr.io/pause:3.2"},
+			RepoDigests: []string{"k8s.gcr.io/pause@" + digest},
+			SizeBytes:   100,
+			ImageWarms:  []string{"default/pause"},
+		}},
+	}, {
+		name:  "last used time is refreshed at its resolution",
+		inUse: sets.NewString(helloID, pauseID),
+		previous: []v1alpha1.InventoryImage{
+			{ID: helloID, LastUsedTime: &recently},
+			{ID: pauseID, LastUsedTime: &longAgo},
+		},
+		want: []v1alpha1.InventoryImage{{
+			ID:           helloID,
+			RepoTags:     []string{"gcr.io/knative/helloworld:v1", "helloworld:latest"},
+			SizeBytes:    200,
+			LastUsedTime: &recently,
+		}, {
+			ID:           pauseID,
+			RepoTags:     []string{"k8s.gcr.io/pause:3.2"},
+			RepoDigests:  []string{"k8s.gcr.io/pause@" + digest},
+			SizeBytes:    100,
+			LastUsedTime: &metav1.Time{Time: now},
+		}},
+	}, {
+		name: "last used time is kept once unused",
+		previous: []v1alpha1.InventoryImage{
+			{ID: helloID, LastUsedTime: &longAgo},
+		},
+		want: []v1alpha1.InventoryImage{{
+			ID:           helloID,
+			RepoTags:     []string{"gcr.io/knative/helloworld:v1", "helloworld:latest"},
+			SizeBytes:    200,
+			LastUsedTime: &longAgo,
+		}, {
+			ID:          pauseID,
+			RepoTags:    []string{"k8s.gcr.io/pause:3.2"},
+			RepoDigests: []string{"k8s.gcr.io/pause@" + digest},
+			SizeBytes:   100,
+		}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inUse := test.inUse
+			if inUse == nil {
+				inUse = sets.NewString()
+			}
+			got := buildImages(infos, inUse, test.warms, test.previous, now)
+			if diff := cmp.Diff(test.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Error("buildImages() (-want, +got) =", diff)
+			}
+		})
+	}
+}
+
+func TestPlannedWarms(t *testing.T) {
+	plans := []*v1alpha1.NodeWarmPlan{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1-3"},
+		Spec: v1alpha1.NodeWarmPlanSpec{NodeName: "node-1", Images: []v1alpha1.PlannedImage{
+			{Owner: "default/helloworld", Image: "gcr.io/knative/helloworld:v1"},
+			{Owner: "invalid", Image: "sleep:v1"},
+		}},
+	}, {
+		ObjectMeta: metav1.ObjectMeta{Name: "node-2-3"},
+		Spec: v1alpha1.NodeWarmPlanSpec{NodeName: "node-2", Images: []v1alpha1.PlannedImage{
+			{Owner: "default/pause", Image: "k8s.gcr.io/pause:3.2"},
+		}},
+	}}
+	infos := []cri.ImageInfo{{
+		ID:       helloID,
+		RepoTags: []string{"gcr.io/knative/helloworld:v1"},
+		Size:     200,
+	}}
+
+	got := buildImages(infos, sets.NewString(), plannedWarms(plans, "node-1"), nil, time.Now())
+	want := []v1alpha1.InventoryImage{{
+		ID:         helloID,
+		RepoTags:   []string{"gcr.io/knative/helloworld:v1"},
+		SizeBytes:  200,
+		ImageWarms: []string{"default/helloworld"},
+	}}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Error("buildImages() (-want, +got) =", diff)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"knative.dev/pkg/metrics"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+)
+
+var (
+	ownedImagesM = stats.Int64(
+		"owned_images",
+		"Number of images on the node held for ImageWarms or NodeWarmPlan entries",
+		stats.UnitDimensionless)
+	ownedBytesM = stats.Int64(
+		"owned_image_bytes",
+		"Disk space taken by the images on the node held for ImageWarms or NodeWarmPlan entries",
+		stats.UnitBytes)
+)
+
+func init() {
+	if err := metrics.RegisterResourceView(
+		&view.View{
+			Description: ownedImagesM.Description(),
+			Measure:     ownedImagesM,
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Description: ownedBytesM.Description(),
+			Measure:     ownedBytesM,
+			Aggregation: view.LastValue(),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// reportOwned records the number and size of the images owned by ImageWarms
+// or NodeWarmPlan entries.
+func reportOwned(ctx context.Context, images []v1alpha1.InventoryImage) {
+	var count, bytes int64
+	for _, image := range images {
+		if len(image.ImageWarms) > 0 {
+			count++
+			bytes += image.SizeBytes
+		}
+	}
+	metrics.RecordBatch(ctx, ownedImagesM.M(count), ownedBytesM.M(bytes))
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package warmer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"knative.dev/pkg/logging"
+
+	clientset "knative.dev/cache-imagewarm/pkg/client/clientset/versioned"
+	imagewarmerinformer "knative.dev/cache-imagewarm/pkg/client/injection/informers/caching/v1alpha1/imagewarm"
+	nodewarmplaninformer "knative.dev/cache-imagewarm/pkg/client/injection/informers/caching/v1alpha1/nodewarmplan"
+	"knative.dev/cache-imagewarm/pkg/resync"
+	"knative.dev/cache-imagewarm/pkg/warmer/images"
+	"knative.dev/cache-imagewarm/pkg/warmer/peer"
+	"knative.dev/cache-imagewarm/pkg/warmer/reconciler"
+)
+
+const (
+	// PeerPortEnv enables peer-to-peer distribution, serving the node-local registry on this port.
+	PeerPortEnv = "PEER_PORT"
+	// PeerAddressEnv is the node address advertised to the warmers on other nodes.
+	PeerAddressEnv = "PEER_ADDRESS"
+	// PeerStoreDirEnv is the directory holding the blobs served to peers.
+	PeerStoreDirEnv = "PEER_STORE_DIR"
+	// PeerStoreMaxSizeEnv caps the size of the blobs in PEER_STORE_DIR, as a quantity like 20Gi.
+	PeerStoreMaxSizeEnv = "PEER_STORE_MAX_SIZE"
+
+	defaultPeerStoreDir     = "/var/lib/cache-imagewarm/blobs"
+	defaultPeerStoreMaxSize = "20Gi"
+
+	// peerStoreCollectPeriod is how often the images no longer warmed on the
+	// node are removed from the peer store.
+	peerStoreCollectPeriod = 10 * time.Minute
+)
+
+// newPeerDistributor starts the node-local peer registry when PEER_PORT is
+// set, and returns nil otherwise. Peers are found in the ImageWarms and the
+// NodeWarmPlans of the other nodes, listed from the API server once per pull
+// wave.
+//
+// The runtime pulls every staged image on loopback, while the warmers on
+// other nodes reach PEER_ADDRESS and are only served the images pulled
+// without credentials, so the peer registry never exposes private images.
+// Both speak plaintext HTTP. The images the node no longer warms are
+// collected from the store periodically, which is capped at PEER_STORE_MAX_SIZE.
+func newPeerDistributor(ctx context.Context, client clientset.Interface) (images.Distributor, error) {
+	logger := logging.FromContext(ctx)
+
+	port := os.Getenv(PeerPortEnv)
+	if port == "" {
+		return nil, nil
+	}
+	address := os.Getenv(PeerAddressEnv)
+	if address == "" {
+		return nil, fmt.Errorf("%s must be set when %s is set", PeerAddressEnv, PeerPortEnv)
+	}
+	dir := os.Getenv(PeerStoreDirEnv)
+	if dir == "" {
+		dir = defaultPeerStoreDir
+	}
+
+	maxSize := os.Getenv(PeerStoreMaxSizeEnv)
+	if maxSize == "" {
+		maxSize = defaultPeerStoreMaxSize
+	}
+	maxBytes, err := resource.ParseQuantity(maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s, err: %w", PeerStoreMaxSizeEnv, err)
+	}
+
+	store, err := peer.NewStore(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create peer store in %s, err: %w", dir, err)
+	}
+
+	// The runtime shares the host network with the warmer, and treats loopback
+	// registries as insecure so it can pull over plain HTTP.
+	localAddress := net.JoinHostPort("127.0.0.1", port)
+	advertiseAddress := net.JoinHostPort(address, port)
+	logger = logger.Named("peer")
+	servePeerRegistry(ctx, logger, localAddress, peer.NewHandler(store, logger))
+	servePeerRegistry(ctx, logger, advertiseAddress, peer.NewPeerHandler(store, logger))
+
+	distributor := peer.NewDistributor(store, localAddress, advertiseAddress,
+		peer.MergePeers(peer.ImageWarmPeers(client, reconciler.NodeName),
+			peer.NodeWarmPlanPeers(client, reconciler.NodeName)))
+	warmedImages := nodeImages(ctx)
+	resync.Every(ctx, func() time.Duration { return peerStoreCollectPeriod }, func() {
+		imageRefs, err := warmedImages()
+		if err != nil {
+			logger.Errorf("Failed to list the images warmed on the node, not collecting the peer store. err: %v", err)
+			return
+		}
+		if err := distributor.Collect(imageRefs, maxBytes.Value()); err != nil {
+			logger.Errorf("Failed to collect the peer store, err: %v", err)
+		}
+	})
+	return distributor, nil
+}
+
+// nodeImages returns a function listing the images the ImageWarms and the
+// NodeWarmPlans of the node warm, from the informers scoped to the node.
+func nodeImages(ctx context.Context) func() ([]string, error) {
+	imageWarmLister := imagewarmerinformer.Get(ctx).Lister()
+	planLister := nodewarmplaninformer.Get(ctx).Lister()
+	return func() ([]string, error) {
+		warms, err := imageWarmLister.List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		var imageRefs []string
+		for _, i := range warms {
+			imageRefs = append(imageRefs, i.Spec.Image)
+		}
+		plans, err := planLister.List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		for _, plan := range plans {
+			for _, entry := range plan.Spec.Images {
+				imageRefs = append(imageRefs, entry.Image)
+			}
+		}
+		return imageRefs, nil
+	}
+}
+
+// servePeerRegistry serves handler on addr until ctx is done.
+func servePeerRegistry(ctx context.Context, logger *zap.SugaredLogger, addr string, handler http.Handler) {
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		logger.Infof("Serving peer registry on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("Peer registry on %s stopped, err: %v", server.Addr, err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"knative.dev/pkg/logging"
+
+	clientset "knative.dev/cache-imagewarm/pkg/client/clientset/versioned"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+)
+
+// peerListingTTL is how long a listing of the peers of an image is reused,
+// so that the pulls of a wave share a single List instead of listing on
+// every pull.
+const peerListingTTL = 30 * time.Second
+
+// listPeersFunc lists the peer endpoints of an image.
+type listPeersFunc func(ctx context.Context, imageRef string) ([]string, error)
+
+// listOptions selects the objects of the image with selector on the API
+// server, and lists them from its watch cache.
+func listOptions(selector labels.Selector) metav1.ListOptions {
+	return metav1.ListOptions{LabelSelector: selector.String(), ResourceVersion: "0"}
+}
+
+// ImageWarmPeers returns a PeerFunc listing the warmers on other nodes that
+// completed an ImageWarm for the same image and advertise a peer endpoint.
+// Only the ImageWarms of the image are listed, selected by their label.
+// Peers are shuffled so that the load spreads across them.
+func ImageWarmPeers(client clientset.Interface, nodeName string) PeerFunc {
+	return cachePeers(func(ctx context.Context, imageRef string) ([]string, error) {
+		warms, err := client.CachingV1alpha1().ImageWarms(metav1.NamespaceAll).List(ctx,
+			listOptions(imagewarm.ImageSelector(imageRef)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the ImageWarms of image %s: %w", imageRef, err)
+		}
+
+		var peers peerList
+		for _, warm := range warms.Items {
+			if warm.Spec.NodeName == nodeName || warm.Spec.Image != imageRef || !warm.Status.IsReady() {
+				continue
+			}
+			peers.add(warm.Status.PeerEndpoint)
+		}
+		return peers, nil
+	})
+}
+
+// NodeWarmPlanPeers returns a PeerFunc listing the warmers on other nodes
+// whose NodeWarmPlan holds the same image, ready, and advertises a peer
+// endpoint for it. Only the plans holding the image are listed, selected by
+// their labels.
+func NodeWarmPlanPeers(client clientset.Interface, nodeName string) PeerFunc {
+	return cachePeers(func(ctx context.Context, imageRef string) ([]string, error) {
+		plans, err := client.CachingV1alpha1().NodeWarmPlans().List(ctx,
+			listOptions(imagewarm.PlannedImageSelector(imageRef)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the NodeWarmPlans of image %s: %w", imageRef, err)
+		}
+
+		var peers peerList
+		for _, plan := range plans.Items {
+			if plan.Spec.NodeName == nodeName {
+				continue
+			}
+			for _, image := range plan.Status.Images {
+				if image.Image == imageRef && image.Ready == corev1.ConditionTrue {
+					peers.add(image.PeerEndpoint)
+				}
+			}
+		}
+		return peers, nil
+	})
+}
+
+// peerList holds peer endpoints, once each.
+type peerList []string
+
+func (p *peerList) add(endpoint string) {
+	if endpoint == "" {
+		return
+	}
+	for _, e := range *p {
+		if e == endpoint {
+			return
+		}
+	}
+	*p = append(*p, endpoint)
+}
+
+// peerListing is a listing of the peers of an image.
+type peerListing struct {
+	peers   []string
+	expires time.Time
+}
+
+// cachePeers returns a PeerFunc looking the peers of an image up in its
+// listing by list, listed again once older than peerListingTTL.
+func cachePeers(list listPeersFunc) PeerFunc {
+	var (
+		mu       sync.Mutex
+		listings = make(map[string]peerListing)
+	)
+	return func(ctx context.Context, imageRef string) []string {
+		mu.Lock()
+		defer mu.Unlock()
+		now := time.Now()
+		listing, ok := listings[imageRef]
+		if !ok || !now.Before(listing.expires) {
+			// Forget the listings of the images no longer pulled.
+			for image, l := range listings {
+				if !now.Before(l.expires) {
+					delete(listings, image)
+				}
+			}
+			fresh, err := list(ctx, imageRef)
+			if err != nil {
+				logging.FromContext(ctx).Warnf("Failed to find peers, err: %v", err)
+				return nil
+			}
+			listing = peerListing{peers: fresh, expires: now.Add(peerListingTTL)}
+			listings[imageRef] = listing
+		}
+		peers := append([]string(nil), listing.peers...)
+		shuffle(peers)
+		return peers
+	}
+}
+
+// MergePeers returns a PeerFunc listing the peers of all funcs, once each.
+func MergePeers(funcs ...PeerFunc) PeerFunc {
+	return func(ctx context.Context, imageRef string) []string {
+		seen := make(map[string]bool)
+		var peers []string
+		for _, f := range funcs {
+			for _, endpoint := range f(ctx, imageRef) {
+				if !seen[endpoint] {
+					seen[endpoint] = true
+					peers = append(peers, endpoint)
+				}
+			}
+		}
+		shuffle(peers)
+		return peers
+	}
+}
+
+// shuffle spreads the load across the peers.
+func shuffle(peers []string) {
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+}
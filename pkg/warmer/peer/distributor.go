@@ -0,0 +1,318 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"knative.dev/pkg/logging"
+
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/warmer/cri"
+)
+
+// PeerFunc returns the addresses of the peer registries already holding imageRef.
+type PeerFunc func(ctx context.Context, imageRef string) []string
+
+// Distributor stages images in the node-local Store, copying them from peers
+// that already hold them before falling back to the registry sources. Once an
+// image is staged, the runtime pulls it from the local registry endpoint and
+// the other warmers can pull it from this one.
+type Distributor struct {
+	store *Store
+	// mu is held for reading while staging, and for writing while collecting,
+	// so that the blobs of an image being staged are never collected.
+	mu sync.RWMutex
+	// localAddress is where the local runtime reaches the peer registry.
+	localAddress string
+	// advertiseAddress is where the warmers on other nodes reach the peer registry.
+	advertiseAddress string
+	peers            PeerFunc
+	platform         v1.Platform
+}
+
+// NewDistributor creates a Distributor serving the images held in store.
+func NewDistributor(store *Store, localAddress, advertiseAddress string, peers PeerFunc) *Distributor {
+	return &Distributor{
+		store:            store,
+		localAddress:     localAddress,
+		advertiseAddress: advertiseAddress,
+		peers:            peers,
+		platform:         v1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH},
+	}
+}
+
+func parseReference(imageRef string) (repo, identifier string, err error) {
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return "", "", err
+	}
+	return ref.Context().RepositoryStr(), ref.Identifier(), nil
+}
+
+// Local returns the source the local runtime pulls imageRef from once staged.
+func (d *Distributor) Local(imageRef string) (config.PullSource, bool) {
+	repo, identifier, err := parseReference(imageRef)
+	if err != nil {
+		return config.PullSource{}, false
+	}
+	return config.PullSource{
+		Endpoint: d.localAddress,
+		ImageRef: d.localAddress + "/" + repo + referenceSeparator(identifier) + identifier,
+	}, true
+}
+
+// PeerEndpoint returns the address other warmers can pull imageRef from, if
+// it is held locally and shared with peers.
+func (d *Distributor) PeerEndpoint(imageRef string) (string, bool) {
+	repo, identifier, err := parseReference(imageRef)
+	if err != nil {
+		return "", false
+	}
+	_, _, digest, err := d.store.Manifest(repo, identifier)
+	if err != nil || !d.store.IsShared(repo, digest) {
+		return "", false
+	}
+	return d.advertiseAddress, true
+}
+
+// Stage copies imageRef into the local Store and returns the endpoint the
+// content came from. Peers are tried first, then sources in order, each
+// holding the pull slot returned by acquireSlot. Only the images pulled
+// anonymously are shared with the peers in turn.
+//
+// Peers are not trusted with tags: a tag is resolved to a digest from the
+// sources first, and peers are only asked for the manifest of that digest.
+func (d *Distributor) Stage(ctx context.Context, imageRef string, sources []config.PullSource, pullSecret *corev1.Secret,
+	acquireSlot func(ctx context.Context, endpoint string) (func(), error)) (string, error) {
+	logger := logging.FromContext(ctx)
+
+	repo, identifier, err := parseReference(imageRef)
+	if err != nil {
+		return "", err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.store.HasManifest(repo, identifier) {
+		return d.localAddress, nil
+	}
+
+	var errs []error
+	if peers := d.peers(ctx, imageRef); len(peers) > 0 {
+		digest, err := resolve(ctx, identifier, sources, pullSecret)
+		if err != nil {
+			logger.Warnf("Failed to resolve image %s, not staging it from peers, err: %v", imageRef, err)
+			errs = append(errs, err)
+			peers = nil
+		}
+		for _, peer := range peers {
+			src, err := name.ParseReference(peer+"/"+repo+"@"+digest.String(), name.Insecure)
+			if err == nil {
+				err = d.replicate(ctx, src, repo, identifier, authn.Anonymous, true, digest)
+			}
+			if err == nil {
+				logger.Infof("Staged image %s from peer %s", imageRef, peer)
+				return peer, nil
+			}
+			logger.Warnf("Failed to stage image %s from peer %s, err: %v", imageRef, peer, err)
+			errs = append(errs, err)
+		}
+	}
+
+	for _, source := range sources {
+		releaseSlot, err := acquireSlot(ctx, source.Endpoint)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		src, err := name.ParseReference(source.ImageRef)
+		if err == nil {
+			auth := registryAuth(pullSecret, src.Context().RegistryStr())
+			err = d.replicate(ctx, src, repo, identifier, auth, auth == authn.Anonymous, v1.Hash{})
+		}
+		releaseSlot()
+		if err == nil {
+			logger.Infof("Staged image %s from %s", imageRef, source.Endpoint)
+			return source.Endpoint, nil
+		}
+		logger.Warnf("Failed to stage image %s from %s, err: %v", imageRef, source.Endpoint, err)
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return "", fmt.Errorf("no source to stage image %s from", imageRef)
+	}
+	return "", utilerrors.NewAggregate(errs)
+}
+
+// Collect removes the images other than imageRefs from the local Store, and
+// the least recently staged of imageRefs until the Store fits in maxBytes,
+// when positive.
+func (d *Distributor) Collect(imageRefs []string, maxBytes int64) error {
+	referenced := make(map[string]bool, len(imageRefs))
+	for _, imageRef := range imageRefs {
+		if repo, identifier, err := parseReference(imageRef); err == nil {
+			referenced[repo+referenceSeparator(identifier)+identifier] = true
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.store.Collect(func(repo, identifier string) bool {
+		return referenced[repo+referenceSeparator(identifier)+identifier]
+	}, maxBytes)
+}
+
+// resolve returns the digest identifier stands for: itself when it is a
+// digest, or else the digest the first source answering serves the tag as.
+func resolve(ctx context.Context, identifier string, sources []config.PullSource, pullSecret *corev1.Secret) (v1.Hash, error) {
+	if digest, err := v1.NewHash(identifier); err == nil {
+		return digest, nil
+	}
+	var errs []error
+	for _, source := range sources {
+		src, err := name.ParseReference(source.ImageRef)
+		if err == nil {
+			var desc *v1.Descriptor
+			desc, err = remote.Head(src, remote.WithContext(ctx), remote.WithAuth(registryAuth(pullSecret, src.Context().RegistryStr())))
+			if err == nil {
+				return desc.Digest, nil
+			}
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return v1.Hash{}, fmt.Errorf("no source to resolve tag %s from", identifier)
+	}
+	return v1.Hash{}, utilerrors.NewAggregate(errs)
+}
+
+// registryAuth looks up the credentials for registry in the pull secret, the
+// same way the runtime does.
+func registryAuth(pullSecret *corev1.Secret, registry string) authn.Authenticator {
+	if pullSecret == nil {
+		return authn.Anonymous
+	}
+	authInfos, err := cri.ConvertToRegistryAuths(*pullSecret, registry)
+	if err != nil || len(authInfos) == 0 {
+		return authn.Anonymous
+	}
+	return &authn.Basic{Username: authInfos[0].Username, Password: authInfos[0].Password}
+}
+
+// replicate copies the manifest identified by src, and every blob it
+// references, into the store under repo and identifier, shared with peers
+// when share is set. Indexes are narrowed to the manifest matching this
+// node's platform. A manifest whose digest is not want, when set, is rejected.
+func (d *Distributor) replicate(ctx context.Context, src name.Reference, repo, identifier string, auth authn.Authenticator, share bool, want v1.Hash) error {
+	desc, err := remote.Get(src, remote.WithContext(ctx), remote.WithAuth(auth), remote.WithPlatform(d.platform))
+	if err != nil {
+		return err
+	}
+	if want != (v1.Hash{}) && desc.Digest != want {
+		return fmt.Errorf("manifest %s has digest %s, want %s", src, desc.Digest, want)
+	}
+
+	img, err := desc.Image()
+	if err != nil {
+		return err
+	}
+	if !desc.MediaType.IsIndex() {
+		return d.storeImage(repo, identifier, img, share)
+	}
+
+	// Keep the index so digest references resolve, plus this platform's image.
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	if err := d.storeImage(repo, digest.String(), img, share); err != nil {
+		return err
+	}
+	indexDigest, err := d.store.PutManifest(repo, identifier, desc.MediaType, desc.Manifest)
+	if err != nil || !share {
+		return err
+	}
+	return d.store.Share(repo, indexDigest)
+}
+
+// storeImage writes the config and layers of img before its manifest, so that
+// a linked manifest always has all of its blobs available.
+func (d *Distributor) storeImage(repo, identifier string, img v1.Image, share bool) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+	var blobs []v1.Hash
+	for _, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, digest)
+		if d.store.HasBlob(digest) {
+			continue
+		}
+		rc, err := layer.Compressed()
+		if err != nil {
+			return err
+		}
+		err = d.store.PutBlob(digest, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	configName, err := img.ConfigName()
+	if err != nil {
+		return err
+	}
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return err
+	}
+	if err := d.store.PutBlob(configName, bytes.NewReader(rawConfig)); err != nil {
+		return err
+	}
+
+	mediaType, err := img.MediaType()
+	if err != nil {
+		return err
+	}
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		return err
+	}
+	digest, err := d.store.PutManifest(repo, identifier, mediaType, rawManifest)
+	if err != nil || !share {
+		return err
+	}
+	return d.store.Share(repo, append(blobs, configName, digest)...)
+}
@@ -0,0 +1,495 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clienttesting "k8s.io/client-go/testing"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/client/clientset/versioned/fake"
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+)
+
+type daemon struct {
+	address     string
+	distributor *Distributor
+}
+
+func newTestStore(t *testing.T) *Store {
+	dir, err := ioutil.TempDir("", "peer")
+	if err != nil {
+		t.Fatal("TempDir() =", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal("NewStore() =", err)
+	}
+	return store
+}
+
+// startDaemons starts n in-process warmers, each serving its own store and
+// discovering the others through the images they hold.
+func startDaemons(t *testing.T, n int) []*daemon {
+	daemons := make([]*daemon, n)
+	for i := range daemons {
+		store := newTestStore(t)
+		local := httptest.NewServer(NewHandler(store, logtesting.TestLogger(t)))
+		t.Cleanup(local.Close)
+		server := httptest.NewServer(NewPeerHandler(store, logtesting.TestLogger(t)))
+		t.Cleanup(server.Close)
+
+		self := i
+		address := strings.TrimPrefix(server.URL, "http://")
+		peers := func(_ context.Context, imageRef string) []string {
+			var addresses []string
+			for j, d := range daemons {
+				if endpoint, ok := d.distributor.PeerEndpoint(imageRef); ok && j != self {
+					addresses = append(addresses, endpoint)
+				}
+			}
+			return addresses
+		}
+		daemons[i] = &daemon{
+			address:     address,
+			distributor: NewDistributor(store, strings.TrimPrefix(local.URL, "http://"), address, peers),
+		}
+	}
+	return daemons
+}
+
+// slots records the endpoints pull slots are acquired for.
+type slots struct {
+	acquired []string
+}
+
+func (s *slots) acquire(_ context.Context, endpoint string) (func(), error) {
+	s.acquired = append(s.acquired, endpoint)
+	return func() {}, nil
+}
+
+func TestStageFromPeers(t *testing.T) {
+	ctx := logtesting.TestContextWithLogger(t)
+
+	upstream := httptest.NewServer(registry.New())
+	defer upstream.Close()
+	upstreamHost := strings.TrimPrefix(upstream.URL, "http://")
+	imageRef := upstreamHost + "/knative/helloworld:v1"
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal("random.Image() =", err)
+	}
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		t.Fatal("ParseReference() =", err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal("remote.Write() =", err)
+	}
+	sources := []config.PullSource{{Endpoint: upstreamHost, ImageRef: imageRef}}
+
+	daemons := startDaemons(t, 3)
+
+	// The first daemon has no peers holding the image and uses the registry,
+	// holding one of its pull slots.
+	slots := &slots{}
+	got, err := daemons[0].distributor.Stage(ctx, imageRef, sources, nil, slots.acquire)
+	if err != nil {
+		t.Fatal("Stage() =", err)
+	}
+	if got != upstreamHost {
+		t.Errorf("Stage() served by %q, want upstream %q", got, upstreamHost)
+	}
+	if want := []string{upstreamHost}; !reflect.DeepEqual(slots.acquired, want) {
+		t.Errorf("Stage() acquired slots of %v, want %v", slots.acquired, want)
+	}
+
+	// The others only resolve the tag upstream and are served by their peers.
+	slots.acquired = nil
+	for _, d := range daemons[1:] {
+		got, err := d.distributor.Stage(ctx, imageRef, sources, nil, slots.acquire)
+		if err != nil {
+			t.Fatal("Stage() =", err)
+		}
+		if got == upstreamHost || got == d.address {
+			t.Errorf("Stage() served by %q, want a peer", got)
+		}
+	}
+	if len(slots.acquired) != 0 {
+		t.Errorf("Stage() from peers acquired slots of %v, want none", slots.acquired)
+	}
+
+	// Every daemon now serves the image to the runtime.
+	want, err := img.Digest()
+	if err != nil {
+		t.Fatal("Digest() =", err)
+	}
+	for _, d := range daemons {
+		local, ok := d.distributor.Local(imageRef)
+		if !ok {
+			t.Fatalf("Local(%q) = false", imageRef)
+		}
+		localRef, err := name.ParseReference(local.ImageRef)
+		if err != nil {
+			t.Fatal("ParseReference() =", err)
+		}
+		pulled, err := remote.Image(localRef)
+		if err != nil {
+			t.Fatal("remote.Image() =", err)
+		}
+		if err := validate.Image(pulled); err != nil {
+			t.Error("validate.Image() =", err)
+		}
+		if got, err := pulled.Digest(); err != nil || got != want {
+			t.Errorf("Digest() = %v, %v, want %v", got, err, want)
+		}
+	}
+}
+
+func TestStageRejectsRetaggedPeer(t *testing.T) {
+	ctx := logtesting.TestContextWithLogger(t)
+
+	upstream := httptest.NewServer(registry.New())
+	defer upstream.Close()
+	upstreamHost := strings.TrimPrefix(upstream.URL, "http://")
+	imageRef := upstreamHost + "/knative/helloworld:v1"
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		t.Fatal("ParseReference() =", err)
+	}
+	sources := []config.PullSource{{Endpoint: upstreamHost, ImageRef: imageRef}}
+
+	daemons := startDaemons(t, 2)
+
+	// The first daemon holds what the tag pointed at before it moved.
+	stale, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal("random.Image() =", err)
+	}
+	if err := remote.Write(ref, stale); err != nil {
+		t.Fatal("remote.Write() =", err)
+	}
+	if _, err := daemons[0].distributor.Stage(ctx, imageRef, sources, nil, (&slots{}).acquire); err != nil {
+		t.Fatal("Stage() =", err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal("random.Image() =", err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal("remote.Write() =", err)
+	}
+	got, err := daemons[1].distributor.Stage(ctx, imageRef, sources, nil, (&slots{}).acquire)
+	if err != nil {
+		t.Fatal("Stage() =", err)
+	}
+	if got != upstreamHost {
+		t.Errorf("Stage() served by %q, want upstream %q", got, upstreamHost)
+	}
+
+	want, err := img.Digest()
+	if err != nil {
+		t.Fatal("Digest() =", err)
+	}
+	local, _ := daemons[1].distributor.Local(imageRef)
+	localRef, err := name.ParseReference(local.ImageRef)
+	if err != nil {
+		t.Fatal("ParseReference() =", err)
+	}
+	if got, err := remote.Head(localRef); err != nil || got.Digest != want {
+		t.Errorf("Head() = %v, %v, want digest %v", got, err, want)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	ctx := logtesting.TestContextWithLogger(t)
+
+	upstream := httptest.NewServer(registry.New())
+	defer upstream.Close()
+	upstreamHost := strings.TrimPrefix(upstream.URL, "http://")
+
+	d := startDaemons(t, 1)[0].distributor
+	imageRefs := []string{upstreamHost + "/knative/kept:v1", upstreamHost + "/knative/dropped:v1"}
+	layers := make(map[string][]v1.Layer, len(imageRefs))
+	for _, imageRef := range imageRefs {
+		img, err := random.Image(1024, 2)
+		if err != nil {
+			t.Fatal("random.Image() =", err)
+		}
+		ref, err := name.ParseReference(imageRef)
+		if err != nil {
+			t.Fatal("ParseReference() =", err)
+		}
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatal("remote.Write() =", err)
+		}
+		if layers[imageRef], err = img.Layers(); err != nil {
+			t.Fatal("Layers() =", err)
+		}
+		sources := []config.PullSource{{Endpoint: upstreamHost, ImageRef: imageRef}}
+		if _, err := d.Stage(ctx, imageRef, sources, nil, (&slots{}).acquire); err != nil {
+			t.Fatal("Stage() =", err)
+		}
+	}
+
+	held := func(imageRef string) bool {
+		repo, identifier, _ := parseReference(imageRef)
+		if !d.store.HasManifest(repo, identifier) {
+			return false
+		}
+		for _, layer := range layers[imageRef] {
+			digest, _ := layer.Digest()
+			if !d.store.HasBlob(digest) {
+				t.Errorf("Blob %s of %s collected, want it held with its manifest", digest, imageRef)
+			}
+		}
+		return true
+	}
+
+	if err := d.Collect(imageRefs[:1], 0); err != nil {
+		t.Fatal("Collect() =", err)
+	}
+	if !held(imageRefs[0]) {
+		t.Errorf("Collect() removed %s, want it kept", imageRefs[0])
+	}
+	if held(imageRefs[1]) {
+		t.Errorf("Collect() kept %s, want it removed", imageRefs[1])
+	}
+	for _, layer := range layers[imageRefs[1]] {
+		if digest, _ := layer.Digest(); d.store.HasBlob(digest) {
+			t.Errorf("Collect() kept blob %s, want it removed", digest)
+		}
+	}
+
+	// The kept image does not fit in a single byte.
+	if err := d.Collect(imageRefs[:1], 1); err != nil {
+		t.Fatal("Collect() =", err)
+	}
+	if held(imageRefs[0]) {
+		t.Errorf("Collect() kept %s past the size cap, want it removed", imageRefs[0])
+	}
+}
+
+func TestPrivateImagesNotShared(t *testing.T) {
+	ctx := logtesting.TestContextWithLogger(t)
+
+	upstream := httptest.NewServer(registry.New())
+	defer upstream.Close()
+	upstreamHost := strings.TrimPrefix(upstream.URL, "http://")
+	imageRef := upstreamHost + "/knative/private:v1"
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal("random.Image() =", err)
+	}
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		t.Fatal("ParseReference() =", err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal("remote.Write() =", err)
+	}
+	sources := []config.PullSource{{Endpoint: upstreamHost, ImageRef: imageRef}}
+	pullSecret := &corev1.Secret{
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(`{"auths":{"` + upstreamHost + `":{"username":"user","password":"secret"}}}`),
+		},
+	}
+
+	daemons := startDaemons(t, 2)
+	if _, err := daemons[0].distributor.Stage(ctx, imageRef, sources, pullSecret, (&slots{}).acquire); err != nil {
+		t.Fatal("Stage() =", err)
+	}
+	if endpoint, ok := daemons[0].distributor.PeerEndpoint(imageRef); ok {
+		t.Errorf("PeerEndpoint() = %s, want the private image not advertised", endpoint)
+	}
+
+	// The runtime pulls the image on loopback, the peers are not served it.
+	local, _ := daemons[0].distributor.Local(imageRef)
+	localRef, err := name.ParseReference(local.ImageRef)
+	if err != nil {
+		t.Fatal("ParseReference() =", err)
+	}
+	if _, err := remote.Image(localRef); err != nil {
+		t.Error("remote.Image(local) =", err)
+	}
+	peerRef, err := name.ParseReference(daemons[0].address + "/knative/private:v1")
+	if err != nil {
+		t.Fatal("ParseReference() =", err)
+	}
+	if _, err := remote.Image(peerRef); err == nil {
+		t.Error("remote.Image(peer) = nil, want the private manifest hidden")
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal("Layers() =", err)
+	}
+	digest, err := layers[0].Digest()
+	if err != nil {
+		t.Fatal("Digest() =", err)
+	}
+	layer, err := remote.Layer(peerRef.Context().Digest(digest.String()))
+	if err == nil {
+		_, err = layer.Compressed()
+	}
+	if err == nil {
+		t.Error("remote.Layer(peer) = nil, want the private blob hidden")
+	}
+
+	upstream.Close()
+	if _, err := daemons[1].distributor.Stage(ctx, imageRef, sources, pullSecret, (&slots{}).acquire); err == nil {
+		t.Error("Stage() = nil, want the private image not staged from a peer")
+	}
+}
+
+func TestStoreRejectsEscapingRepositories(t *testing.T) {
+	store := newTestStore(t)
+	for _, repo := range []string{"../../etc", "knative/../../..", "knative/./helloworld", "/knative", "knative//helloworld"} {
+		if _, err := store.PutManifest(repo, "v1", "application/json", []byte("{}")); err == nil {
+			t.Errorf("PutManifest(%q) = nil, want an error", repo)
+		}
+		if store.HasManifest(repo, "v1") {
+			t.Errorf("HasManifest(%q) = true, want false", repo)
+		}
+	}
+	for _, identifier := range []string{"..", "v1/../../x"} {
+		if _, _, _, err := store.Manifest("knative/helloworld", identifier); err == nil {
+			t.Errorf("Manifest(%q) = nil, want an error", identifier)
+		}
+	}
+}
+
+func TestHandlerRejectsWrites(t *testing.T) {
+	store := newTestStore(t)
+	server := httptest.NewServer(NewHandler(store, logtesting.TestLogger(t)))
+	defer server.Close()
+
+	ref, err := name.ParseReference(strings.TrimPrefix(server.URL, "http://") + "/knative/helloworld:v1")
+	if err != nil {
+		t.Fatal("ParseReference() =", err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal("random.Image() =", err)
+	}
+	if err := remote.Write(ref, img); err == nil {
+		t.Error("remote.Write() = nil, want the peer registry to reject writes")
+	}
+}
+
+func TestDiscoveryPeers(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		warmOn("node-2", "10.0.0.2:5000", true),
+		warmOn("node-3", "10.0.0.3:5000", false),
+		planOn("node-1", "10.0.0.1:5000", corev1.ConditionTrue),
+		planOn("node-2", "10.0.0.2:5000", corev1.ConditionTrue),
+		planOn("node-4", "10.0.0.4:5000", corev1.ConditionTrue),
+		planOn("node-5", "10.0.0.5:5000", corev1.ConditionUnknown),
+	)
+
+	peers := MergePeers(ImageWarmPeers(client, "node-1"), NodeWarmPlanPeers(client, "node-1"))(
+		logtesting.TestContextWithLogger(t), "helloworld:v1")
+	sort.Strings(peers)
+	if want := []string{"10.0.0.2:5000", "10.0.0.4:5000"}; !reflect.DeepEqual(peers, want) {
+		t.Errorf("peers = %v, want %v", peers, want)
+	}
+}
+
+func TestDiscoveryListsOncePerWave(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		warmOn("node-2", "10.0.0.2:5000", true),
+		planOn("node-3", "10.0.0.3:5000", corev1.ConditionTrue),
+	)
+	peers := MergePeers(ImageWarmPeers(client, "node-1"), NodeWarmPlanPeers(client, "node-1"))
+
+	ctx := logtesting.TestContextWithLogger(t)
+	for i := 0; i < 3; i++ {
+		if got := peers(ctx, "helloworld:v1"); len(got) != 2 {
+			t.Errorf("peers = %v, want 2 peers", got)
+		}
+		if got := peers(ctx, "other:v1"); len(got) != 0 {
+			t.Errorf("peers = %v, want none", got)
+		}
+	}
+
+	lists := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() != "list" {
+			continue
+		}
+		lists++
+		if selector := action.(clienttesting.ListAction).GetListRestrictions().Labels; selector.Empty() {
+			t.Errorf("listed the %s of every image, want those of one image", action.GetResource().Resource)
+		}
+	}
+	if lists != 4 {
+		t.Errorf("listed %d times, want the ImageWarms and the NodeWarmPlans listed once per image", lists)
+	}
+}
+
+func warmOn(node, endpoint string, ready bool) *v1alpha1.ImageWarm {
+	warm := &v1alpha1.ImageWarm{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "helloworld-" + node,
+			Labels:    map[string]string{imagewarm.ImageLabelKey: imagewarm.ImageHash("helloworld:v1")},
+		},
+		Spec:   v1alpha1.ImageWarmSpec{Image: "helloworld:v1", NodeName: node},
+		Status: v1alpha1.ImageWarmStatus{PeerEndpoint: endpoint},
+	}
+	if ready {
+		warm.Status.MarkReadyTrue()
+	}
+	return warm
+}
+
+func planOn(node, endpoint string, ready corev1.ConditionStatus) *v1alpha1.NodeWarmPlan {
+	plan := &v1alpha1.NodeWarmPlan{
+		ObjectMeta: metav1.ObjectMeta{Name: node},
+		Spec: v1alpha1.NodeWarmPlanSpec{NodeName: node, Images: []v1alpha1.PlannedImage{{
+			Owner: "default/helloworld", Image: "helloworld:v1",
+		}}},
+		Status: v1alpha1.NodeWarmPlanStatus{Images: []v1alpha1.PlannedImageStatus{{
+			Owner: "default/helloworld", Image: "helloworld:v1", Ready: ready, PeerEndpoint: endpoint,
+		}}},
+	}
+	imagewarm.LabelPlannedImages(plan)
+	return plan
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"go.uber.org/zap"
+)
+
+// NewHandler returns a read-only handler speaking the registry v2 API for the
+// manifests and blobs held in store, so that the local runtime can pull from it.
+// It must only be reachable from the node.
+func NewHandler(store *Store, logger *zap.SugaredLogger) http.Handler {
+	return &handler{store: store, logger: logger}
+}
+
+// NewPeerHandler returns a handler like NewHandler for the warmers on other
+// nodes, serving only the content the store shares with peers.
+func NewPeerHandler(store *Store, logger *zap.SugaredLogger) http.Handler {
+	return &handler{store: store, logger: logger, sharedOnly: true}
+}
+
+type handler struct {
+	store  *Store
+	logger *zap.SugaredLogger
+	// sharedOnly hides the manifests and blobs not shared with peers.
+	sharedOnly bool
+}
+
+type registryError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Errors []registryError `json:"errors"`
+	}{Errors: []registryError{{Code: code, Message: message}}})
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "the peer registry is read-only")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	if path == r.URL.Path {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "not a registry API path")
+		return
+	}
+	if path == "" {
+		// API version check.
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		return
+	}
+
+	if i := strings.LastIndex(path, "/manifests/"); i > 0 {
+		h.serveManifest(w, r, path[:i], path[i+len("/manifests/"):])
+		return
+	}
+	if i := strings.LastIndex(path, "/blobs/"); i > 0 {
+		h.serveBlob(w, r, path[:i], path[i+len("/blobs/"):])
+		return
+	}
+	writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "unknown registry API path")
+}
+
+func (h *handler) serveManifest(w http.ResponseWriter, r *http.Request, repo, identifier string) {
+	if _, err := name.NewRepository(repo); err != nil {
+		writeError(w, http.StatusBadRequest, "NAME_INVALID", err.Error())
+		return
+	}
+	if _, err := name.ParseReference(repo + referenceSeparator(identifier) + identifier); err != nil {
+		writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+		return
+	}
+
+	mediaType, raw, digest, err := h.store.Manifest(repo, identifier)
+	if err == nil && h.sharedOnly && !h.store.IsShared(repo, digest) {
+		err = fmt.Errorf("manifest %s of %s is not shared", digest, repo)
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+		return
+	}
+
+	w.Header().Set("Content-Type", string(mediaType))
+	w.Header().Set("Content-Length", strconv.Itoa(len(raw)))
+	w.Header().Set("Docker-Content-Digest", digest.String())
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(raw)
+}
+
+func (h *handler) serveBlob(w http.ResponseWriter, r *http.Request, repo, identifier string) {
+	if _, err := name.NewRepository(repo); err != nil {
+		writeError(w, http.StatusBadRequest, "NAME_INVALID", err.Error())
+		return
+	}
+	digest, err := v1.NewHash(identifier)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+		return
+	}
+	if h.sharedOnly && !h.store.IsShared(repo, digest) {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown")
+		return
+	}
+
+	blob, size, err := h.store.Blob(digest)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown")
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Docker-Content-Digest", digest.String())
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, blob); err != nil {
+		h.logger.Warnf("Failed to serve blob %s of %s, err: %v", digest, repo, err)
+	}
+}
+
+// referenceSeparator returns the separator between a repository and identifier.
+func referenceSeparator(identifier string) string {
+	if strings.Contains(identifier, ":") {
+		return "@"
+	}
+	return ":"
+}
@@ -0,0 +1,386 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Store is a content addressable blob store on the node's disk. Manifests are
+// kept as blobs too, and are additionally linked from their repository and
+// tag or digest so they can be served through the registry API.
+type Store struct {
+	root string
+}
+
+// NewStore creates a Store rooted at dir.
+func NewStore(dir string) (*Store, error) {
+	for _, sub := range []string{"blobs", "repositories", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{root: dir}, nil
+}
+
+func (s *Store) blobPath(digest v1.Hash) string {
+	return filepath.Join(s.root, "blobs", digest.Algorithm, digest.Hex)
+}
+
+func (s *Store) linkPath(repo, identifier string) (string, error) {
+	return s.repositoryPath(repo, "_manifests", identifier)
+}
+
+func (s *Store) sharedPath(repo string, digest v1.Hash) (string, error) {
+	return s.repositoryPath(repo, "_shared", digest.Algorithm, digest.Hex)
+}
+
+// repositoryPath joins elem to the directory of repo, rejecting the
+// repositories and elements that would resolve outside of it.
+func (s *Store) repositoryPath(repo string, elem ...string) (string, error) {
+	for _, component := range strings.Split(repo, "/") {
+		if component == "" || component == "." || component == ".." {
+			return "", fmt.Errorf("invalid repository %q", repo)
+		}
+	}
+	for _, e := range elem {
+		if e == "" || e == "." || e == ".." || strings.ContainsAny(e, `/\`) {
+			return "", fmt.Errorf("invalid path element %q of repository %q", e, repo)
+		}
+	}
+	dir := filepath.Join(s.root, "repositories")
+	path := filepath.Join(append([]string{dir, filepath.FromSlash(repo)}, elem...)...)
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("repository %q escapes the store", repo)
+	}
+	return path, nil
+}
+
+// HasBlob reports whether the blob with the given digest is held locally.
+func (s *Store) HasBlob(digest v1.Hash) bool {
+	_, err := os.Stat(s.blobPath(digest))
+	return err == nil
+}
+
+// Blob opens the blob with the given digest. The caller must close it.
+func (s *Store) Blob(digest v1.Hash) (*os.File, int64, error) {
+	f, err := os.Open(s.blobPath(digest))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// PutBlob writes the content of r to the store, verifying it against digest.
+func (s *Store) PutBlob(digest v1.Hash, r io.Reader) error {
+	if s.HasBlob(digest) {
+		return nil
+	}
+	tmp, err := ioutil.TempFile(filepath.Join(s.root, "tmp"), digest.Hex)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	got, _, err := v1.SHA256(io.TeeReader(r, tmp))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if got != digest {
+		return fmt.Errorf("blob digest mismatch, want %s, got %s", digest, got)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.blobPath(digest)), 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.blobPath(digest))
+}
+
+// PutManifest stores a raw manifest and links it from repo under identifier,
+// which is either a tag or the manifest digest.
+func (s *Store) PutManifest(repo, identifier string, mediaType types.MediaType, raw []byte) (v1.Hash, error) {
+	digest, _, err := v1.SHA256(bytes.NewReader(raw))
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	if err := s.PutBlob(digest, bytes.NewReader(raw)); err != nil {
+		return v1.Hash{}, err
+	}
+
+	link := fmt.Sprintf("%s\n%s\n", digest, mediaType)
+	for _, id := range []string{identifier, digest.String()} {
+		path, err := s.linkPath(repo, id)
+		if err != nil {
+			return v1.Hash{}, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return v1.Hash{}, err
+		}
+		if err := ioutil.WriteFile(path, []byte(link), 0644); err != nil {
+			return v1.Hash{}, err
+		}
+	}
+	return digest, nil
+}
+
+// Manifest returns the manifest linked from repo under identifier.
+func (s *Store) Manifest(repo, identifier string) (types.MediaType, []byte, v1.Hash, error) {
+	path, err := s.linkPath(repo, identifier)
+	if err != nil {
+		return "", nil, v1.Hash{}, err
+	}
+	link, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, v1.Hash{}, err
+	}
+	parts := strings.SplitN(strings.TrimSpace(string(link)), "\n", 2)
+	if len(parts) != 2 {
+		return "", nil, v1.Hash{}, fmt.Errorf("malformed manifest link for %s:%s", repo, identifier)
+	}
+	digest, err := v1.NewHash(parts[0])
+	if err != nil {
+		return "", nil, v1.Hash{}, err
+	}
+	raw, err := ioutil.ReadFile(s.blobPath(digest))
+	if err != nil {
+		return "", nil, v1.Hash{}, err
+	}
+	return types.MediaType(parts[1]), raw, digest, nil
+}
+
+// HasManifest reports whether repo has a manifest linked under identifier.
+func (s *Store) HasManifest(repo, identifier string) bool {
+	path, err := s.linkPath(repo, identifier)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Share marks the manifests and blobs with the given digests as servable to
+// the peers under repo. Content pulled with credentials is never shared, so
+// peers cannot read it without the pull secret.
+func (s *Store) Share(repo string, digests ...v1.Hash) error {
+	for _, digest := range digests {
+		path, err := s.sharedPath(repo, digest)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsShared reports whether the manifest or blob with the given digest can be
+// served to the peers under repo.
+func (s *Store) IsShared(repo string, digest v1.Hash) bool {
+	path, err := s.sharedPath(repo, digest)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// link is a manifest linked from a repository.
+type link struct {
+	repo, identifier string
+	digest           v1.Hash
+	modified         time.Time
+}
+
+// links returns every manifest link of the store.
+func (s *Store) links() ([]link, error) {
+	dir := filepath.Join(s.root, "repositories")
+	var links []link
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Base(filepath.Dir(path)) != "_manifests" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(filepath.Dir(path)))
+		if err != nil {
+			return err
+		}
+		repo, identifier := filepath.ToSlash(rel), info.Name()
+		_, _, digest, err := s.Manifest(repo, identifier)
+		if err != nil {
+			// A link to a collected manifest, swept below.
+			digest = v1.Hash{}
+		}
+		links = append(links, link{repo: repo, identifier: identifier, digest: digest, modified: info.ModTime()})
+		return nil
+	})
+	return links, err
+}
+
+// references returns the blobs the manifest with the given digest needs under
+// repo, itself included: the config and layers of an image, and the images of
+// an index that are held locally.
+func (s *Store) references(repo string, digest v1.Hash) ([]v1.Hash, error) {
+	mediaType, raw, _, err := s.Manifest(repo, digest.String())
+	if err != nil {
+		return nil, err
+	}
+	refs := []v1.Hash{digest}
+	if mediaType.IsIndex() {
+		index, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		for _, desc := range index.Manifests {
+			if !s.HasManifest(repo, desc.Digest.String()) {
+				continue
+			}
+			children, err := s.references(repo, desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, children...)
+		}
+		return refs, nil
+	}
+	manifest, err := v1.ParseManifest(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	refs = append(refs, manifest.Config.Digest)
+	for _, layer := range manifest.Layers {
+		refs = append(refs, layer.Digest)
+	}
+	return refs, nil
+}
+
+// Collect removes the manifests that referenced reports are no longer used on
+// the node, then the blobs no manifest left references. When maxBytes is
+// positive, the least recently staged manifests are removed too until the
+// blobs fit in it. Collect must not run while images are staged.
+func (s *Store) Collect(referenced func(repo, identifier string) bool, maxBytes int64) error {
+	links, err := s.links()
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].modified.After(links[j].modified)
+	})
+
+	// Keep the newest references first, as long as their blobs fit.
+	kept := make(map[string]map[v1.Hash]bool, len(links))
+	blobs := make(map[v1.Hash]int64)
+	var size int64
+	for _, l := range links {
+		if l.digest == (v1.Hash{}) || !referenced(l.repo, l.identifier) {
+			continue
+		}
+		refs, err := s.references(l.repo, l.digest)
+		if err != nil {
+			continue
+		}
+		var added int64
+		addedBlobs := make(map[v1.Hash]int64)
+		for _, ref := range refs {
+			if _, ok := blobs[ref]; ok {
+				continue
+			}
+			if info, err := os.Stat(s.blobPath(ref)); err == nil {
+				addedBlobs[ref] = info.Size()
+				added += info.Size()
+			}
+		}
+		if maxBytes > 0 && size+added > maxBytes {
+			continue
+		}
+		size += added
+		for ref, n := range addedBlobs {
+			blobs[ref] = n
+		}
+		if kept[l.repo] == nil {
+			kept[l.repo] = make(map[v1.Hash]bool)
+		}
+		for _, ref := range refs {
+			kept[l.repo][ref] = true
+		}
+	}
+
+	for _, l := range links {
+		// Tags are only kept while referenced, digests while their manifest is.
+		if _, err := v1.NewHash(l.identifier); kept[l.repo][l.digest] && (err == nil || referenced(l.repo, l.identifier)) {
+			continue
+		}
+		path, err := s.linkPath(l.repo, l.identifier)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := s.sweep(filepath.Join(s.root, "repositories"), func(path string) bool {
+		if filepath.Base(filepath.Dir(filepath.Dir(path))) != "_shared" {
+			return true
+		}
+		repo, err := filepath.Rel(filepath.Join(s.root, "repositories"), filepath.Dir(filepath.Dir(filepath.Dir(path))))
+		if err != nil {
+			return true
+		}
+		digest := v1.Hash{Algorithm: filepath.Base(filepath.Dir(path)), Hex: filepath.Base(path)}
+		return kept[filepath.ToSlash(repo)][digest]
+	}); err != nil {
+		return err
+	}
+	return s.sweep(filepath.Join(s.root, "blobs"), func(path string) bool {
+		_, ok := blobs[v1.Hash{Algorithm: filepath.Base(filepath.Dir(path)), Hex: filepath.Base(path)}]
+		return ok
+	})
+}
+
+// sweep removes the files under dir that keep rejects.
+func (s *Store) sweep(dir string, keep func(path string) bool) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || keep(path) {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
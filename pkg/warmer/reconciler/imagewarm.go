@@ -19,8 +19,13 @@ package reconciler
 import (
 	"context"
 	"os"
+	"time"
 
-	corev1 "k8s.io/client-go/listers/core/v1"
+	"go.opencensus.io/trace"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/reconciler"
 
@@ -28,10 +33,17 @@ import (
 	imagewarmclientset "knative.dev/cache-imagewarm/pkg/client/clientset/versioned"
 	"knative.dev/cache-imagewarm/pkg/client/injection/reconciler/caching/v1alpha1/imagewarm"
 	imagewarmlisters "knative.dev/cache-imagewarm/pkg/client/listers/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/config"
+	"knative.dev/cache-imagewarm/pkg/tracing"
+	"knative.dev/cache-imagewarm/pkg/warmer/archive"
+	"knative.dev/cache-imagewarm/pkg/warmer/cri"
+	"knative.dev/cache-imagewarm/pkg/warmer/events"
 	"knative.dev/cache-imagewarm/pkg/warmer/images"
+	"knative.dev/cache-imagewarm/pkg/warmer/inventory"
 )
 
-const GlobalPullSecret = "pullsecret"
+// progressUpdateInterval throttles the updates of the pull progress in the ImageWarm status.
+const progressUpdateInterval = 30 * time.Second
 
 var NodeName string
 
@@ -42,6 +54,11 @@ func init() {
 	}
 }
 
+// SecretGetter gets the Secret namespace/name.
+type SecretGetter interface {
+	Get(ctx context.Context, namespace, name string) (*corev1.Secret, error)
+}
+
 // Reconciler implements addressableservicereconciler.Interface for
 // AddressableService resources.
 type Reconciler struct {
@@ -52,9 +69,22 @@ type Reconciler struct {
 
 	ImageWarmClient imagewarmclientset.Interface
 
-	Secretlister corev1.SecretLister
+	// Secrets gets the pull secrets referenced by the ImageWarms.
+	Secrets SecretGetter
 
 	ImagePuller images.ImagePuller
+
+	// Distributor is set when images are shared with the warmers on other nodes.
+	Distributor images.Distributor
+
+	// ArchiveLoader loads the images of ImageWarms specifying an archive.
+	ArchiveLoader *archive.Loader
+
+	// Inventory publishes the images held by the node.
+	Inventory *inventory.Publisher
+
+	// NodeEvents records the Events about pulls on the Node as well as on the ImageWarm.
+	NodeEvents bool
 }
 
 // Check that our Reconciler implements Interface
@@ -70,6 +100,7 @@ func (r *Reconciler) FinalizeKind(ctx context.Context, i *v1alpha1.ImageWarm) re
 	logger.Infof("ImageCache  %s/%s for image:%s is being deleted, we will gc image for it.", i.Namespace, i.Name, i.Spec.Image)
 
 	r.ImagePuller.StopPullImage(ctx, i.Spec.Image)
+	r.Inventory.Trigger()
 
 	return nil
 }
@@ -79,37 +110,137 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, i *v1alpha1.ImageWarm) r
 	logger := logging.FromContext(ctx)
 
 	logger.Infof("Reconcile ImageCache %s/%s, image:%s", i.Namespace, i.Name, i.Spec.Image)
+	ctx, span := tracing.StartSpanFromAnnotations(ctx, tracing.SpanImageWarmReconcile, i.Annotations)
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("namespace", i.Namespace),
+		trace.StringAttribute("name", i.Name),
+		trace.StringAttribute("node", NodeName))
 
 	if !i.DeletionTimestamp.IsZero() {
 		logger.Infof("ImageCache %s/%s is being deleted, so we will not pull image for it.", i.Namespace, i.Name)
 		return nil
 	}
 
+	r.warm(ctx, i, i.DeepCopy())
+	return nil
+}
+
+// warm pulls, or loads, the image of the ImageWarm unless the node holds it,
+// and reports how far it got in the status of the ImageWarm. The Events about
+// the pull are recorded on target.
+func (r *Reconciler) warm(ctx context.Context, i *v1alpha1.ImageWarm, target runtime.Object) {
+	logger := logging.FromContext(ctx)
+
 	if exists, _ := r.ImagePuller.ImageExists(ctx, i.Spec.Image); exists {
 		logger.Infof("Image %s for image %s/%s exists, no need to pull ! ", i.Spec.Image, i.Namespace, i.Name)
 		// TODO reconcile image.status in another reconciler
+		if result, ok := r.ImagePuller.PullResult(i.Spec.Image); ok && result.Err == nil && result.Endpoint != "" {
+			i.Status.Endpoint = result.Endpoint
+		}
+		if r.Distributor != nil {
+			i.Status.PeerEndpoint, _ = r.Distributor.PeerEndpoint(i.Spec.Image)
+		}
+		i.Status.Progress = nil
 		if !i.IsReady() {
 			i.Status.MarkReadyTrue()
+			r.Inventory.Trigger()
 		}
-		return nil
+		return
+	}
+
+	ctx = r.withEventTargets(ctx, target)
+	if i.Spec.Archive != nil {
+		// No webhook validates the ImageWarms, the archive is checked here
+		// before anything is read from the node or downloaded.
+		if err := i.Spec.Archive.Validate(ctx); err != nil {
+			i.Status.MarkReadyFalse("InvalidArchive", err.ViaField("spec", "archive").Error())
+			return
+		}
+		markPulling(i, "ImageLoadFailed", r.ImagePuller)
+		imageRef, namespace, imageArchive := i.Spec.Image, i.Namespace, i.Spec.Archive.DeepCopy()
+		r.ImagePuller.LoadImage(ctx, imageRef, func(ctx context.Context, imageService cri.ImageService) (string, error) {
+			return r.ArchiveLoader.Load(ctx, imageService, imageRef, namespace, imageArchive)
+		})
+		r.reportProgress(i)
+		return
 	}
 
 	var secretName string
 
 	// use Default Secret
 	if len(i.Spec.ImagePullSecrets) == 0 {
-		secretName = GlobalPullSecret
+		secretName = config.FromContextOrDefaults(ctx).Settings.GlobalPullSecret
 	} else {
 		secretName = i.Spec.ImagePullSecrets[0].Name
 	}
 
-	secret, err := r.Secretlister.Secrets(i.Namespace).Get(secretName)
-	if err != nil {
-		logger.Warnf("get secret for imagecache %s/%s,err: %s", i.Namespace, i.Name, err.Error())
+	var secret *corev1.Secret
+	if secretName != "" {
+		_, credentialSpan := trace.StartSpan(ctx, tracing.SpanCredentialLookup)
+		credentialSpan.AddAttributes(trace.StringAttribute("secret", secretName))
+		var err error
+		secret, err = r.Secrets.Get(ctx, i.Namespace, secretName)
+		if err != nil {
+			logger.Warnf("get secret for imagecache %s/%s,err: %s", i.Namespace, i.Name, err.Error())
+			credentialSpan.SetStatus(trace.Status{Code: trace.StatusCodeNotFound, Message: err.Error()})
+		}
+		credentialSpan.End()
 	}
 
-	r.ImagePuller.PullImage(ctx, i.Spec.Image, secret)
 	// TODO reconcile image.status in another reconciler
-	i.Status.MarkReadyUnknown()
-	return nil
+	markPulling(i, "ImagePullFailed", r.ImagePuller)
+	r.ImagePuller.PullImage(ctx, i.Spec.Image, secret)
+	r.reportProgress(i)
+}
+
+// reportProgress summarizes the progress of the pull in the status, at most
+// once per progressUpdateInterval, and clears it when the image is not pulled.
+func (r *Reconciler) reportProgress(i *v1alpha1.ImageWarm) {
+	layers, ok := r.ImagePuller.Progress(i.Spec.Image)
+	if !ok {
+		i.Status.Progress = nil
+		return
+	}
+	if i.Status.Progress != nil && time.Since(i.Status.Progress.UpdateTime.Time) < progressUpdateInterval {
+		return
+	}
+
+	progress := make([]v1alpha1.LayerProgress, 0, len(layers))
+	for _, layer := range layers {
+		progress = append(progress, v1alpha1.LayerProgress{
+			ID:              layer.ID,
+			BytesDownloaded: layer.Current,
+			BytesTotal:      layer.Total,
+		})
+	}
+	i.Status.SetProgress(progress, metav1.Now())
+}
+
+// markPulling reports the failure of the previous attempt, classified by
+// cri.PullErrorReason or else reported as failedReason, before the image is
+// pulled again. The failure is kept while retrying, Unknown is reported otherwise.
+func markPulling(i *v1alpha1.ImageWarm, failedReason string, puller images.ImagePuller) {
+	if result, ok := puller.PullResult(i.Spec.Image); ok && result.Err != nil {
+		reason := cri.ReasonOf(result.Err)
+		if reason != cri.ReasonUnknown {
+			failedReason = string(reason)
+		}
+		i.Status.MarkReadyFalse(failedReason, result.Err.Error())
+		return
+	}
+	if !i.Status.GetCondition(v1alpha1.ImageWarmConditionReady).IsFalse() {
+		i.Status.MarkReadyUnknown()
+	}
+}
+
+// withEventTargets attaches the objects the Events about pulling an image are
+// recorded on, target and the Node when NodeEvents is set.
+func (r *Reconciler) withEventTargets(ctx context.Context, target runtime.Object) context.Context {
+	targets := []runtime.Object{target}
+	if r.NodeEvents {
+		// Kubelet records the Events of a Node with its name as UID.
+		targets = append(targets, &corev1.ObjectReference{Kind: "Node", Name: NodeName, UID: types.UID(NodeName)})
+	}
+	return events.WithTargets(ctx, targets...)
 }
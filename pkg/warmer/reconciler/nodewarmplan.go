@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconciler
+
+import (
+	"context"
+
+	"go.opencensus.io/trace"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/reconciler"
+
+	"knative.dev/cache-imagewarm/pkg/apis/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/client/injection/reconciler/caching/v1alpha1/nodewarmplan"
+	listers "knative.dev/cache-imagewarm/pkg/client/listers/caching/v1alpha1"
+	"knative.dev/cache-imagewarm/pkg/reconciler/imagewarm"
+	"knative.dev/cache-imagewarm/pkg/tracing"
+)
+
+// PlanReconciler implements nodewarmplan.Interface for the NodeWarmPlans of
+// the node, warming each of their images as Warmer warms the image of an
+// ImageWarm.
+type PlanReconciler struct {
+	Warmer *Reconciler
+	// PlanLister lists the NodeWarmPlans of the node, the shards its entries
+	// are spread across.
+	PlanLister listers.NodeWarmPlanLister
+}
+
+// Check that our PlanReconciler implements Interface
+var _ nodewarmplan.Interface = (*PlanReconciler)(nil)
+
+// ReconcileKind implements Interface.ReconcileKind.
+func (r *PlanReconciler) ReconcileKind(ctx context.Context, p *v1alpha1.NodeWarmPlan) reconciler.Event {
+	logger := logging.FromContext(ctx)
+
+	if p.Spec.NodeName != NodeName {
+		return nil
+	}
+	logger.Infof("Reconcile NodeWarmPlan %s, %d images", p.Name, len(p.Spec.Images))
+
+	target := p.DeepCopy()
+	planned := sets.NewString()
+	statuses := make([]v1alpha1.PlannedImageStatus, 0, len(p.Spec.Images))
+	for k := range p.Spec.Images {
+		entry := &p.Spec.Images[k]
+		warm, err := imagewarm.FromPlannedImage(p, entry)
+		if err != nil {
+			logger.Warnf("Skipping image %s of invalid owner %q in NodeWarmPlan %s, err: %v", entry.Image, entry.Owner, p.Name, err)
+			continue
+		}
+		planned.Insert(entry.Image)
+
+		warmCtx, span := trace.StartSpan(ctx, tracing.SpanImageWarmReconcile)
+		span.AddAttributes(
+			trace.StringAttribute("namespace", warm.Namespace),
+			trace.StringAttribute("name", warm.Name),
+			trace.StringAttribute("node", NodeName))
+		r.Warmer.warm(warmCtx, warm, target)
+		span.End()
+
+		statuses = append(statuses, imagewarm.PlannedImageStatusOf(entry.Owner, warm))
+	}
+
+	// The images no longer planned, in any shard, are no longer pulled, as
+	// when their ImageWarm is deleted.
+	shards, err := r.PlanLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, shard := range shards {
+		if shard.Spec.NodeName == NodeName && shard.Name != p.Name {
+			for _, entry := range shard.Spec.Images {
+				planned.Insert(entry.Image)
+			}
+		}
+	}
+	for _, status := range p.Status.Images {
+		if !planned.Has(status.Image) {
+			logger.Infof("Image %s of %s was removed from NodeWarmPlan %s, we will stop pulling it.", status.Image, status.Owner, p.Name)
+			r.Warmer.ImagePuller.StopPullImage(ctx, status.Image)
+			r.Warmer.Inventory.Trigger()
+		}
+	}
+
+	p.Status.Images = statuses
+	p.Status.PropagateImagesStatus()
+	return nil
+}